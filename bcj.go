@@ -0,0 +1,528 @@
+package lzma
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var errBCJProperties = errors.New("lzma: invalid BCJ properties")
+
+// DecodeBCJStartOffset decodes the properties of BCJ filters of 7z and xz
+// files: none or the start offset as 32-bit little-endian value.
+func DecodeBCJStartOffset(props []byte) (uint32, error) {
+	switch len(props) {
+	case 0:
+		return 0, nil
+	case 4:
+		return binary.LittleEndian.Uint32(props), nil
+	default:
+		return 0, errBCJProperties
+	}
+}
+
+// newBCJDecompressor creates the decompressor for bodgit/sevenzip of BCJ
+// filter whose converter is made by newConv.
+func newBCJDecompressor(props []byte, readers []io.ReadCloser, newConv func(uint32) converter) (io.ReadCloser, error) {
+	if len(readers) != 1 {
+		return nil, errNeedOneReader
+	}
+
+	startOffset, err := DecodeBCJStartOffset(props)
+	if err != nil {
+		return nil, err
+	}
+
+	return &readCloser{
+		c: readers[0],
+		r: newFilterReader(readers[0], newConv(startOffset)),
+	}, nil
+}
+
+// branchConverter keeps the position of the stateless converters, fn gets
+// the position of buf in the stream.
+type branchConverter struct {
+	pos uint32
+	fn  func(buf []byte, pos uint32, encoding bool) int
+}
+
+func (c *branchConverter) convert(buf []byte, encoding bool) int {
+	n := c.fn(buf, c.pos, encoding)
+	c.pos += uint32(n)
+
+	return n
+}
+
+func newARMConverter(startOffset uint32) converter {
+	return &branchConverter{pos: startOffset, fn: armConvert}
+}
+
+func newARMThumbConverter(startOffset uint32) converter {
+	return &branchConverter{pos: startOffset, fn: armThumbConvert}
+}
+
+func newPPCConverter(startOffset uint32) converter {
+	return &branchConverter{pos: startOffset, fn: ppcConvert}
+}
+
+func newSPARCConverter(startOffset uint32) converter {
+	return &branchConverter{pos: startOffset, fn: sparcConvert}
+}
+
+func newIA64Converter(startOffset uint32) converter {
+	return &branchConverter{pos: startOffset, fn: ia64Convert}
+}
+
+func newARM64Converter(startOffset uint32) converter {
+	return &branchConverter{pos: startOffset, fn: arm64Convert}
+}
+
+func newRISCVConverter(startOffset uint32) converter {
+	return &branchConverter{pos: startOffset, fn: riscvConvert}
+}
+
+// armConvert converts BL instructions of ARM.
+func armConvert(buf []byte, pos uint32, encoding bool) int {
+	i := 0
+
+	for ; i+4 <= len(buf); i += 4 {
+		if buf[i+3] != 0xEB {
+			continue
+		}
+
+		src := (uint32(buf[i+2])<<16 | uint32(buf[i+1])<<8 | uint32(buf[i])) << 2
+
+		var dest uint32
+		if encoding {
+			dest = src + pos + uint32(i) + 8
+		} else {
+			dest = src - (pos + uint32(i) + 8)
+		}
+
+		dest >>= 2
+		buf[i+2] = byte(dest >> 16)
+		buf[i+1] = byte(dest >> 8)
+		buf[i] = byte(dest)
+	}
+
+	return i
+}
+
+// armThumbConvert converts BL instruction pairs of ARM Thumb.
+func armThumbConvert(buf []byte, pos uint32, encoding bool) int {
+	i := 0
+
+	for ; i+4 <= len(buf); i += 2 {
+		if buf[i+1]&0xF8 != 0xF0 || buf[i+3]&0xF8 != 0xF8 {
+			continue
+		}
+
+		src := (uint32(buf[i+1]&7)<<19 | uint32(buf[i])<<11 | uint32(buf[i+3]&7)<<8 | uint32(buf[i+2])) << 1
+
+		var dest uint32
+		if encoding {
+			dest = src + pos + uint32(i) + 4
+		} else {
+			dest = src - (pos + uint32(i) + 4)
+		}
+
+		dest >>= 1
+		buf[i+1] = 0xF0 | byte(dest>>19)&7
+		buf[i] = byte(dest >> 11)
+		buf[i+3] = 0xF8 | byte(dest>>8)&7
+		buf[i+2] = byte(dest)
+		i += 2
+	}
+
+	return i
+}
+
+// ppcConvert converts big-endian "bl" instructions of PowerPC.
+func ppcConvert(buf []byte, pos uint32, encoding bool) int {
+	i := 0
+
+	for ; i+4 <= len(buf); i += 4 {
+		if buf[i]>>2 != 0x12 || buf[i+3]&3 != 1 {
+			continue
+		}
+
+		src := binary.BigEndian.Uint32(buf[i:]) & 0x03FFFFFC
+
+		var dest uint32
+		if encoding {
+			dest = src + pos + uint32(i)
+		} else {
+			dest = src - (pos + uint32(i))
+		}
+
+		buf[i] = 0x48 | byte(dest>>24)&3
+		buf[i+1] = byte(dest >> 16)
+		buf[i+2] = byte(dest >> 8)
+		buf[i+3] = buf[i+3]&3 | byte(dest)
+	}
+
+	return i
+}
+
+// sparcConvert converts "call" instructions of SPARC.
+func sparcConvert(buf []byte, pos uint32, encoding bool) int {
+	i := 0
+
+	for ; i+4 <= len(buf); i += 4 {
+		if !(buf[i] == 0x40 && buf[i+1]&0xC0 == 0x00) && !(buf[i] == 0x7F && buf[i+1]&0xC0 == 0xC0) {
+			continue
+		}
+
+		src := binary.BigEndian.Uint32(buf[i:]) << 2
+
+		var dest uint32
+		if encoding {
+			dest = src + pos + uint32(i)
+		} else {
+			dest = src - (pos + uint32(i))
+		}
+
+		dest >>= 2
+		dest = (0-(dest>>22&1))<<22&0x3FFFFFFF | dest&0x3FFFFF | 0x40000000
+
+		binary.BigEndian.PutUint32(buf[i:], dest)
+	}
+
+	return i
+}
+
+// ia64BranchSlots is the mask of the slots which may hold branch
+// instruction, indexed by the template of the bundle.
+var ia64BranchSlots = [32]byte{
+	0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0,
+	4, 4, 6, 6, 0, 0, 7, 7,
+	4, 4, 0, 0, 4, 4, 0, 0,
+}
+
+// ia64Convert converts IP-relative branches in the bundles of IA-64.
+func ia64Convert(buf []byte, pos uint32, encoding bool) int {
+	i := 0
+
+	for ; i+16 <= len(buf); i += 16 {
+		mask := ia64BranchSlots[buf[i]&0x1F]
+
+		for slot, bitPos := 0, 5; slot < 3; slot, bitPos = slot+1, bitPos+41 {
+			if mask>>slot&1 == 0 {
+				continue
+			}
+
+			bytePos := i + bitPos>>3
+			bitRes := uint(bitPos & 7)
+
+			var instr uint64
+			for j := 0; j < 6; j++ {
+				instr |= uint64(buf[bytePos+j]) << (8 * j)
+			}
+
+			norm := instr >> bitRes
+			if norm>>37&0xF != 0x5 || norm>>9&0x7 != 0 {
+				continue
+			}
+
+			src := uint32(norm>>13&0xFFFFF) | uint32(norm>>36&1)<<20
+			src <<= 4
+
+			var dest uint32
+			if encoding {
+				dest = src + pos + uint32(i)
+			} else {
+				dest = src - (pos + uint32(i))
+			}
+
+			dest >>= 4
+
+			norm &^= 0x8FFFFF << 13
+			norm |= uint64(dest&0xFFFFF) << 13
+			norm |= uint64(dest&0x100000) << (36 - 20)
+
+			instr &= 1<<bitRes - 1
+			instr |= norm << bitRes
+
+			for j := 0; j < 6; j++ {
+				buf[bytePos+j] = byte(instr >> (8 * j))
+			}
+		}
+	}
+
+	return i
+}
+
+// arm64Convert converts BL and ADRP instructions of ARM64. ADRP is
+// converted only if the address is within +/-512 MiB.
+func arm64Convert(buf []byte, pos uint32, encoding bool) int {
+	i := 0
+
+	for ; i+4 <= len(buf); i += 4 {
+		pc := pos + uint32(i)
+		instr := binary.LittleEndian.Uint32(buf[i:])
+
+		switch {
+		case instr>>26 == 0x25:
+			pc >>= 2
+			if !encoding {
+				pc = -pc
+			}
+
+			instr = 0x94000000 | (instr+pc)&0x03FFFFFF
+		case instr&0x9F000000 == 0x90000000:
+			src := instr>>29&3 | instr>>3&0x001FFFFC
+			if (src+0x00020000)&0x001C0000 != 0 {
+				continue
+			}
+
+			pc >>= 12
+			if !encoding {
+				pc = -pc
+			}
+
+			dest := src + pc
+			instr &= 0x9000001F
+			instr |= (dest & 3) << 29
+			instr |= (dest & 0x0003FFFC) << 3
+			instr |= -(dest & 0x00020000) & 0x00E00000
+		default:
+			continue
+		}
+
+		binary.LittleEndian.PutUint32(buf[i:], instr)
+	}
+
+	return i
+}
+
+// riscvAUIPCPair reports whether inst2 uses the register set by auipc and
+// its opcode has the lowest two bits set.
+func riscvAUIPCPair(auipc, inst2 uint32) bool {
+	return (auipc<<8^(inst2-3))&0xF8003 == 0
+}
+
+// riscvSpecialAUIPC reports whether AUIPC with rd x0 or x2 looks like the
+// converted pair: rd is x2, bits 12 and 13 are set and rs1 is neither x0
+// nor x2.
+func riscvSpecialAUIPC(auipc uint32) bool {
+	return (auipc-0x3117)<<18 < auipc>>27&0x1D
+}
+
+// riscvConvert converts JAL instructions and AUIPC pairs of RISC-V. The
+// pair becomes AUIPC with rd x2 holding the second instruction, followed by
+// the big-endian address. The original AUIPC of this form is swapped into
+// the form of the pair.
+func riscvConvert(buf []byte, pos uint32, encoding bool) int {
+	if len(buf) < 8 {
+		return 0
+	}
+
+	i := 0
+
+	for ; i <= len(buf)-8; i += 2 {
+		pc := pos + uint32(i)
+
+		if buf[i] == 0xEF {
+			b1, b2, b3 := uint32(buf[i+1]), uint32(buf[i+2]), uint32(buf[i+3])
+			if b1&0x0D != 0 {
+				continue
+			}
+
+			if encoding {
+				addr := (b1&0xF0)<<8 | (b2&0x0F)<<16 | (b2&0x10)<<7 | (b2&0xE0)>>4 | (b3&0x7F)<<4 | (b3&0x80)<<13
+				addr += pc
+
+				buf[i+1] = byte(b1&0x0F | addr>>13&0xF0)
+				buf[i+2] = byte(addr >> 9)
+				buf[i+3] = byte(addr >> 1)
+			} else {
+				addr := (b1&0xF0)<<13 | b2<<9 | b3<<1
+				addr -= pc
+
+				buf[i+1] = byte(b1&0x0F | addr>>8&0xF0)
+				buf[i+2] = byte(addr>>16&0x0F | addr>>7&0x10 | addr<<4&0xE0)
+				buf[i+3] = byte(addr>>4&0x7F | addr>>13&0x80)
+			}
+
+			i += 4 - 2
+
+			continue
+		}
+
+		if buf[i]&0x7F != 0x17 {
+			continue
+		}
+
+		inst := binary.LittleEndian.Uint32(buf[i:])
+
+		var inst2 uint32
+
+		if inst&0xE80 != 0 {
+			// rd is neither x0 nor x2
+			inst2 = binary.LittleEndian.Uint32(buf[i+4:])
+			if !riscvAUIPCPair(inst, inst2) {
+				i += 6 - 2
+
+				continue
+			}
+
+			if encoding {
+				addr := inst&0xFFFFF000 + inst2>>20 - inst2>>19&0x1000 + pc
+
+				binary.LittleEndian.PutUint32(buf[i:], 0x17|2<<7|inst2<<12)
+				binary.BigEndian.PutUint32(buf[i+4:], addr)
+			} else {
+				binary.LittleEndian.PutUint32(buf[i:], 0x17|2<<7|inst2<<12)
+				binary.LittleEndian.PutUint32(buf[i+4:], inst&0xFFFFF000|inst2>>20)
+			}
+		} else {
+			if !riscvSpecialAUIPC(inst) {
+				i += 4 - 2
+
+				continue
+			}
+
+			rs1 := inst >> 27
+
+			if encoding {
+				addr := binary.LittleEndian.Uint32(buf[i+4:])
+
+				binary.LittleEndian.PutUint32(buf[i:], 0x17|rs1<<7|addr&0xFFFFF000)
+				binary.LittleEndian.PutUint32(buf[i+4:], inst>>12|addr<<20)
+			} else {
+				addr := binary.BigEndian.Uint32(buf[i+4:]) - pc
+
+				binary.LittleEndian.PutUint32(buf[i:], 0x17|rs1<<7|(addr+0x800)&0xFFFFF000)
+				binary.LittleEndian.PutUint32(buf[i+4:], inst>>12|addr<<20)
+			}
+		}
+
+		i += 8 - 2
+	}
+
+	return i
+}
+
+// NewARMReader creates reader decoding ARM BCJ filter.
+func NewARMReader(inStream io.Reader, startOffset uint32) io.Reader {
+	return newFilterReader(inStream, newARMConverter(startOffset))
+}
+
+// NewARMWriter creates writer encoding ARM BCJ filter.
+func NewARMWriter(outStream io.Writer, startOffset uint32) io.WriteCloser {
+	return newFilterWriter(outStream, newARMConverter(startOffset))
+}
+
+// NewARMDecompressorForSevenZip decompressor constructor for bodgit/sevenzip.
+//
+// sevenzip.RegisterDecompressor([]byte{0x03, 0x03, 0x05, 0x01}, sevenzip.Decompressor(lzma.NewARMDecompressorForSevenZip))
+func NewARMDecompressorForSevenZip(props []byte, _ uint64, readers []io.ReadCloser) (io.ReadCloser, error) {
+	return newBCJDecompressor(props, readers, newARMConverter)
+}
+
+// NewARMThumbReader creates reader decoding ARM Thumb BCJ filter.
+func NewARMThumbReader(inStream io.Reader, startOffset uint32) io.Reader {
+	return newFilterReader(inStream, newARMThumbConverter(startOffset))
+}
+
+// NewARMThumbWriter creates writer encoding ARM Thumb BCJ filter.
+func NewARMThumbWriter(outStream io.Writer, startOffset uint32) io.WriteCloser {
+	return newFilterWriter(outStream, newARMThumbConverter(startOffset))
+}
+
+// NewARMThumbDecompressorForSevenZip decompressor constructor for
+// bodgit/sevenzip.
+//
+// sevenzip.RegisterDecompressor([]byte{0x03, 0x03, 0x07, 0x01}, sevenzip.Decompressor(lzma.NewARMThumbDecompressorForSevenZip))
+func NewARMThumbDecompressorForSevenZip(props []byte, _ uint64, readers []io.ReadCloser) (io.ReadCloser, error) {
+	return newBCJDecompressor(props, readers, newARMThumbConverter)
+}
+
+// NewPPCReader creates reader decoding PowerPC BCJ filter.
+func NewPPCReader(inStream io.Reader, startOffset uint32) io.Reader {
+	return newFilterReader(inStream, newPPCConverter(startOffset))
+}
+
+// NewPPCWriter creates writer encoding PowerPC BCJ filter.
+func NewPPCWriter(outStream io.Writer, startOffset uint32) io.WriteCloser {
+	return newFilterWriter(outStream, newPPCConverter(startOffset))
+}
+
+// NewPPCDecompressorForSevenZip decompressor constructor for bodgit/sevenzip.
+//
+// sevenzip.RegisterDecompressor([]byte{0x03, 0x03, 0x02, 0x05}, sevenzip.Decompressor(lzma.NewPPCDecompressorForSevenZip))
+func NewPPCDecompressorForSevenZip(props []byte, _ uint64, readers []io.ReadCloser) (io.ReadCloser, error) {
+	return newBCJDecompressor(props, readers, newPPCConverter)
+}
+
+// NewSPARCReader creates reader decoding SPARC BCJ filter.
+func NewSPARCReader(inStream io.Reader, startOffset uint32) io.Reader {
+	return newFilterReader(inStream, newSPARCConverter(startOffset))
+}
+
+// NewSPARCWriter creates writer encoding SPARC BCJ filter.
+func NewSPARCWriter(outStream io.Writer, startOffset uint32) io.WriteCloser {
+	return newFilterWriter(outStream, newSPARCConverter(startOffset))
+}
+
+// NewSPARCDecompressorForSevenZip decompressor constructor for
+// bodgit/sevenzip.
+//
+// sevenzip.RegisterDecompressor([]byte{0x03, 0x03, 0x08, 0x05}, sevenzip.Decompressor(lzma.NewSPARCDecompressorForSevenZip))
+func NewSPARCDecompressorForSevenZip(props []byte, _ uint64, readers []io.ReadCloser) (io.ReadCloser, error) {
+	return newBCJDecompressor(props, readers, newSPARCConverter)
+}
+
+// NewIA64Reader creates reader decoding IA-64 BCJ filter.
+func NewIA64Reader(inStream io.Reader, startOffset uint32) io.Reader {
+	return newFilterReader(inStream, newIA64Converter(startOffset))
+}
+
+// NewIA64Writer creates writer encoding IA-64 BCJ filter.
+func NewIA64Writer(outStream io.Writer, startOffset uint32) io.WriteCloser {
+	return newFilterWriter(outStream, newIA64Converter(startOffset))
+}
+
+// NewIA64DecompressorForSevenZip decompressor constructor for bodgit/sevenzip.
+//
+// sevenzip.RegisterDecompressor([]byte{0x03, 0x03, 0x04, 0x01}, sevenzip.Decompressor(lzma.NewIA64DecompressorForSevenZip))
+func NewIA64DecompressorForSevenZip(props []byte, _ uint64, readers []io.ReadCloser) (io.ReadCloser, error) {
+	return newBCJDecompressor(props, readers, newIA64Converter)
+}
+
+// NewARM64Reader creates reader decoding ARM64 BCJ filter.
+func NewARM64Reader(inStream io.Reader, startOffset uint32) io.Reader {
+	return newFilterReader(inStream, newARM64Converter(startOffset))
+}
+
+// NewARM64Writer creates writer encoding ARM64 BCJ filter.
+func NewARM64Writer(outStream io.Writer, startOffset uint32) io.WriteCloser {
+	return newFilterWriter(outStream, newARM64Converter(startOffset))
+}
+
+// NewARM64DecompressorForSevenZip decompressor constructor for
+// bodgit/sevenzip.
+//
+// sevenzip.RegisterDecompressor([]byte{0x0A}, sevenzip.Decompressor(lzma.NewARM64DecompressorForSevenZip))
+func NewARM64DecompressorForSevenZip(props []byte, _ uint64, readers []io.ReadCloser) (io.ReadCloser, error) {
+	return newBCJDecompressor(props, readers, newARM64Converter)
+}
+
+// NewRISCVReader creates reader decoding RISC-V BCJ filter.
+func NewRISCVReader(inStream io.Reader, startOffset uint32) io.Reader {
+	return newFilterReader(inStream, newRISCVConverter(startOffset))
+}
+
+// NewRISCVWriter creates writer encoding RISC-V BCJ filter.
+func NewRISCVWriter(outStream io.Writer, startOffset uint32) io.WriteCloser {
+	return newFilterWriter(outStream, newRISCVConverter(startOffset))
+}
+
+// NewRISCVDecompressorForSevenZip decompressor constructor for
+// bodgit/sevenzip.
+//
+// sevenzip.RegisterDecompressor([]byte{0x0B}, sevenzip.Decompressor(lzma.NewRISCVDecompressorForSevenZip))
+func NewRISCVDecompressorForSevenZip(props []byte, _ uint64, readers []io.ReadCloser) (io.ReadCloser, error) {
+	return newBCJDecompressor(props, readers, newRISCVConverter)
+}
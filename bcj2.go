@@ -0,0 +1,365 @@
+package lzma
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BCJ2 splits x86 code into four streams: the main stream without the
+// addresses of converted CALL and JMP instructions, the absolute addresses of
+// CALL and of JMP (big-endian) and the range coded flags telling which
+// instructions are converted.
+const (
+	bcj2Main = iota
+	bcj2Call
+	bcj2Jump
+	bcj2RangeCoder
+	bcj2Streams
+)
+
+// bcj2Limit is the maximum distance of the converted branch, further ones
+// are likely not the branch instructions.
+const bcj2Limit = 1 << 24
+
+var (
+	errNeedFourReaders = errors.New("lzma: BCJ2 needs exactly four readers")
+	errBCJ2Truncated   = errors.New("lzma: BCJ2 stream is truncated")
+)
+
+// bcj2IsJ reports whether b is the opcode of CALL, JMP or Jcc which follows
+// prev.
+func bcj2IsJ(prev, b byte) bool {
+	return b&0xFE == 0xE8 || prev == 0x0F && b&0xF0 == 0x80
+}
+
+// bcj2Probs are the probabilities of the flags: E8 after every byte, E9 and
+// Jcc.
+type bcj2Probs [256 + 2]prob
+
+func (p *bcj2Probs) init() {
+	initProbs(p[:])
+}
+
+func (p *bcj2Probs) get(prev, b byte) *prob {
+	switch b {
+	case 0xE8:
+		return &p[prev]
+	case 0xE9:
+		return &p[256]
+	default:
+		return &p[257]
+	}
+}
+
+// BCJ2Reader decodes BCJ2 filter from its four streams.
+type BCJ2Reader struct {
+	main     io.ByteReader
+	call     io.Reader
+	jump     io.Reader
+	rangeDec *rangeDecoder
+	probs    bcj2Probs
+
+	prev       byte
+	pos        uint64
+	unpackSize uint64
+
+	// addr[start:] is the address left from the previous Read.
+	addr  [4]byte
+	start int
+}
+
+// NewBCJ2Reader creates BCJ2 decoder. The unpackSize stops decoding exactly
+// after the given number of bytes, ^uint64(0) reads up to the end of the
+// main stream.
+func NewBCJ2Reader(main, call, jump, rangeCoder io.Reader, unpackSize uint64) (*BCJ2Reader, error) {
+	r := &BCJ2Reader{
+		main:       byteReader(main),
+		call:       call,
+		jump:       jump,
+		rangeDec:   newRangeDecoder(byteReader(rangeCoder)),
+		unpackSize: unpackSize,
+		start:      4,
+	}
+	r.probs.init()
+
+	err := r.rangeDec.Init()
+	if err != nil {
+		return nil, fmt.Errorf("lzma: BCJ2 range coder: %w", err)
+	}
+
+	return r, nil
+}
+
+func byteReader(r io.Reader) io.ByteReader {
+	if br, ok := r.(io.ByteReader); ok {
+		return br
+	}
+
+	return bufio.NewReader(r)
+}
+
+func (r *BCJ2Reader) Read(p []byte) (n int, err error) {
+	for n < len(p) {
+		if r.pos == r.unpackSize {
+			return n, io.EOF
+		}
+
+		if r.start < len(r.addr) {
+			p[n] = r.addr[r.start]
+			r.start++
+			n++
+			r.pos++
+
+			continue
+		}
+
+		b, err := r.main.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) && r.unpackSize != ^uint64(0) {
+				err = errBCJ2Truncated
+			}
+
+			return n, err
+		}
+
+		p[n] = b
+		n++
+		r.pos++
+
+		if !bcj2IsJ(r.prev, b) || r.pos == r.unpackSize {
+			r.prev = b
+
+			continue
+		}
+
+		bit, err := r.rangeDec.DecodeBit(r.probs.get(r.prev, b))
+		if err != nil {
+			return n, bcj2EOF(err)
+		}
+
+		if bit == 0 {
+			r.prev = b
+
+			continue
+		}
+
+		src := r.jump
+		if b == 0xE8 {
+			src = r.call
+		}
+
+		_, err = io.ReadFull(src, r.addr[:])
+		if err != nil {
+			return n, bcj2EOF(err)
+		}
+
+		dest := binary.BigEndian.Uint32(r.addr[:]) - uint32(r.pos+4)
+		binary.LittleEndian.PutUint32(r.addr[:], dest)
+		r.start = 0
+		r.prev = byte(dest >> 24)
+	}
+
+	return n, nil
+}
+
+func bcj2EOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return errBCJ2Truncated
+	}
+
+	return err
+}
+
+// NewBCJ2DecompressorForSevenZip decompressor constructor for bodgit/sevenzip.
+// The readers are the main, call, jump and range coder streams.
+//
+// sevenzip.RegisterDecompressor([]byte{0x03, 0x03, 0x01, 0x1B}, sevenzip.Decompressor(lzma.NewBCJ2DecompressorForSevenZip))
+func NewBCJ2DecompressorForSevenZip(_ []byte, unpackSize uint64, readers []io.ReadCloser) (io.ReadCloser, error) {
+	if len(readers) != bcj2Streams {
+		return nil, errNeedFourReaders
+	}
+
+	r, err := NewBCJ2Reader(readers[bcj2Main], readers[bcj2Call], readers[bcj2Jump], readers[bcj2RangeCoder], unpackSize)
+	if err != nil {
+		return nil, err
+	}
+
+	closers := make(multiCloser, len(readers))
+	for i := range readers {
+		closers[i] = readers[i]
+	}
+
+	return &readCloser{
+		c: closers,
+		r: r,
+	}, nil
+}
+
+// multiCloser closes all closers and returns the first error.
+type multiCloser []io.Closer
+
+func (m multiCloser) Close() error {
+	var first error
+
+	for _, c := range m {
+		err := c.Close()
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+// BCJ2Writer encodes BCJ2 filter to four streams.
+type BCJ2Writer struct {
+	streams  [bcj2Streams]*bufio.Writer
+	rangeEnc *rangeEncoder
+	probs    bcj2Probs
+
+	prev byte
+	pos  uint32
+
+	// buf[:n] waits for the address of the last instruction.
+	buf    []byte
+	n      int
+	closed bool
+}
+
+// NewBCJ2Writer creates BCJ2 encoder writing to the main, call, jump and
+// range coder streams.
+func NewBCJ2Writer(main, call, jump, rangeCoder io.Writer) *BCJ2Writer {
+	w := &BCJ2Writer{
+		buf: make([]byte, filterBufSize),
+	}
+
+	for i, out := range []io.Writer{main, call, jump, rangeCoder} {
+		w.streams[i] = bufio.NewWriter(out)
+	}
+
+	w.rangeEnc = newRangeEncoder(w.streams[bcj2RangeCoder])
+	w.probs.init()
+
+	return w
+}
+
+func (w *BCJ2Writer) Write(p []byte) (n int, err error) {
+	if w.closed {
+		return 0, errFilterClosed
+	}
+
+	for len(p) > 0 {
+		k := copy(w.buf[w.n:], p)
+		w.n += k
+		n += k
+		p = p[k:]
+
+		if w.n < len(w.buf) {
+			break
+		}
+
+		err = w.encode(false)
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// encode encodes the buffered data, the instruction without the whole
+// address is kept unless it is the end of the stream.
+func (w *BCJ2Writer) encode(final bool) error {
+	main := w.streams[bcj2Main]
+
+	i := 0
+
+	for i < w.n {
+		b := w.buf[i]
+
+		if !bcj2IsJ(w.prev, b) {
+			_ = main.WriteByte(b)
+			w.prev = b
+			i++
+
+			continue
+		}
+
+		if i+5 > w.n && !final {
+			break
+		}
+
+		_ = main.WriteByte(b)
+		p := w.probs.get(w.prev, b)
+
+		if i+5 > w.n {
+			w.rangeEnc.EncodeBit(p, 0)
+			w.prev = b
+			i++
+
+			continue
+		}
+
+		src := binary.LittleEndian.Uint32(w.buf[i+1:])
+		dest := src + w.pos + uint32(i) + 5
+
+		if dest+bcj2Limit >= 2*bcj2Limit {
+			w.rangeEnc.EncodeBit(p, 0)
+			w.prev = b
+			i++
+
+			continue
+		}
+
+		w.rangeEnc.EncodeBit(p, 1)
+
+		out := w.streams[bcj2Jump]
+		if b == 0xE8 {
+			out = w.streams[bcj2Call]
+		}
+
+		var addr [4]byte
+		binary.BigEndian.PutUint32(addr[:], dest)
+		_, _ = out.Write(addr[:])
+
+		w.prev = w.buf[i+4]
+		i += 5
+	}
+
+	w.pos += uint32(i)
+	w.n = copy(w.buf, w.buf[i:w.n])
+
+	for _, s := range w.streams {
+		err := s.Flush()
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.rangeEnc.Err()
+}
+
+// Close encodes the buffered data and flushes the range coder. It does not
+// close the underlying writers.
+func (w *BCJ2Writer) Close() error {
+	if w.closed {
+		return errFilterClosed
+	}
+
+	w.closed = true
+
+	err := w.encode(true)
+	if err != nil {
+		return err
+	}
+
+	err = w.rangeEnc.Flush()
+	if err != nil {
+		return err
+	}
+
+	return w.streams[bcj2RangeCoder].Flush()
+}
@@ -0,0 +1,167 @@
+package lzma
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+// encodeBCJ2 returns the main, call, jump and range coder streams of data.
+func encodeBCJ2(t *testing.T, data []byte, step int) [4]*bytes.Buffer {
+	t.Helper()
+
+	var streams [4]*bytes.Buffer
+	for i := range streams {
+		streams[i] = &bytes.Buffer{}
+	}
+
+	w := NewBCJ2Writer(streams[0], streams[1], streams[2], streams[3])
+
+	for p := data; len(p) > 0; {
+		n := step
+		if n > len(p) {
+			n = len(p)
+		}
+
+		_, err := w.Write(p[:n])
+		require.NoError(t, err)
+
+		p = p[n:]
+	}
+
+	require.NoError(t, w.Close())
+	require.Error(t, w.Close())
+
+	return streams
+}
+
+func TestBCJ2(t *testing.T) {
+	x86, err := os.ReadFile("testassets/x86.bin")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name string
+
+		data []byte
+		step int
+	}{
+		{
+			name: "empty",
+			data: nil,
+			step: 1,
+		},
+		{
+			name: "x86",
+			data: x86,
+			step: len(x86),
+		},
+		{
+			name: "x86_small_writes",
+			data: x86,
+			step: 3,
+		},
+		{
+			name: "x86_large",
+			data: bytes.Repeat(x86, 10),
+			step: 100000,
+		},
+		{
+			name: "opcode_at_end",
+			data: []byte{0x90, 0xE8, 0x00, 0x01, 0xE8},
+			step: 1,
+		},
+		{
+			name: "jcc",
+			data: []byte{0x0F, 0x84, 0x10, 0x00, 0x00, 0x00, 0xE9, 0xF0, 0xFF, 0xFF, 0xFF, 0xC3},
+			step: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			streams := encodeBCJ2(t, tc.data, tc.step)
+
+			if len(tc.data) > 1000 {
+				r.Less(streams[0].Len(), len(tc.data))
+				r.Positive(streams[1].Len())
+				r.Positive(streams[2].Len())
+			}
+
+			for _, unpackSize := range []uint64{uint64(len(tc.data)), ^uint64(0)} {
+				reader, err := NewBCJ2Reader(
+					iotest.OneByteReader(bytes.NewReader(streams[0].Bytes())),
+					bytes.NewReader(streams[1].Bytes()),
+					bytes.NewReader(streams[2].Bytes()),
+					bytes.NewReader(streams[3].Bytes()),
+					unpackSize,
+				)
+				r.NoError(err)
+
+				actual, err := io.ReadAll(reader)
+				r.NoError(err)
+				r.True(bytes.Equal(tc.data, actual))
+			}
+
+			readers := make([]io.ReadCloser, len(streams))
+			for i, s := range streams {
+				readers[i] = io.NopCloser(bytes.NewReader(s.Bytes()))
+			}
+
+			rc, err := NewBCJ2DecompressorForSevenZip(nil, uint64(len(tc.data)), readers)
+			r.NoError(err)
+
+			actual, err := io.ReadAll(rc)
+			r.NoError(err)
+			r.True(bytes.Equal(tc.data, actual))
+			r.NoError(rc.Close())
+		})
+	}
+}
+
+func TestBCJ2Errors(t *testing.T) {
+	r := require.New(t)
+
+	x86, err := os.ReadFile("testassets/x86.bin")
+	r.NoError(err)
+
+	streams := encodeBCJ2(t, x86, len(x86))
+
+	_, err = NewBCJ2DecompressorForSevenZip(nil, 0, []io.ReadCloser{io.NopCloser(streams[0])})
+	r.ErrorIs(err, errNeedFourReaders)
+
+	// no range coder stream
+	_, err = NewBCJ2Reader(streams[0], streams[1], streams[2], bytes.NewReader(nil), ^uint64(0))
+	r.Error(err)
+
+	// truncated call stream
+	reader, err := NewBCJ2Reader(
+		bytes.NewReader(streams[0].Bytes()),
+		bytes.NewReader(streams[1].Bytes()[:streams[1].Len()/2]),
+		bytes.NewReader(streams[2].Bytes()),
+		bytes.NewReader(streams[3].Bytes()),
+		^uint64(0),
+	)
+	r.NoError(err)
+
+	_, err = io.ReadAll(reader)
+	r.ErrorIs(err, errBCJ2Truncated)
+
+	// truncated main stream of known size
+	reader, err = NewBCJ2Reader(
+		bytes.NewReader(streams[0].Bytes()[:100]),
+		bytes.NewReader(streams[1].Bytes()),
+		bytes.NewReader(streams[2].Bytes()),
+		bytes.NewReader(streams[3].Bytes()),
+		uint64(len(x86)),
+	)
+	r.NoError(err)
+
+	_, err = io.ReadAll(reader)
+	r.ErrorIs(err, errBCJ2Truncated)
+}
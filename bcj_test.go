@@ -0,0 +1,131 @@
+package lzma
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBCJFilters(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		original    string
+		compressed  string
+		startOffset uint32
+
+		newReader       func(io.Reader, uint32) io.Reader
+		newWriter       func(io.Writer, uint32) io.WriteCloser
+		newDecompressor func([]byte, uint64, []io.ReadCloser) (io.ReadCloser, error)
+	}{
+		{
+			name:            "arm",
+			original:        "testassets/arm.bin",
+			compressed:      "testassets/arm.lzma2",
+			newReader:       NewARMReader,
+			newWriter:       NewARMWriter,
+			newDecompressor: NewARMDecompressorForSevenZip,
+		},
+		{
+			name:            "arm_start_offset",
+			original:        "testassets/arm.bin",
+			compressed:      "testassets/arm_start.lzma2",
+			startOffset:     4096,
+			newReader:       NewARMReader,
+			newWriter:       NewARMWriter,
+			newDecompressor: NewARMDecompressorForSevenZip,
+		},
+		{
+			name:            "arm_thumb",
+			original:        "testassets/armthumb.bin",
+			compressed:      "testassets/armthumb.lzma2",
+			newReader:       NewARMThumbReader,
+			newWriter:       NewARMThumbWriter,
+			newDecompressor: NewARMThumbDecompressorForSevenZip,
+		},
+		{
+			name:            "powerpc",
+			original:        "testassets/powerpc.bin",
+			compressed:      "testassets/powerpc.lzma2",
+			newReader:       NewPPCReader,
+			newWriter:       NewPPCWriter,
+			newDecompressor: NewPPCDecompressorForSevenZip,
+		},
+		{
+			name:            "sparc",
+			original:        "testassets/sparc.bin",
+			compressed:      "testassets/sparc.lzma2",
+			newReader:       NewSPARCReader,
+			newWriter:       NewSPARCWriter,
+			newDecompressor: NewSPARCDecompressorForSevenZip,
+		},
+		{
+			name:            "ia64",
+			original:        "testassets/ia64.bin",
+			compressed:      "testassets/ia64.lzma2",
+			newReader:       NewIA64Reader,
+			newWriter:       NewIA64Writer,
+			newDecompressor: NewIA64DecompressorForSevenZip,
+		},
+		{
+			name:            "arm64",
+			original:        "testassets/arm64.bin",
+			compressed:      "testassets/arm64.lzma2",
+			newReader:       NewARM64Reader,
+			newWriter:       NewARM64Writer,
+			newDecompressor: NewARM64DecompressorForSevenZip,
+		},
+		{
+			name:            "riscv",
+			original:        "testassets/riscv.bin",
+			compressed:      "testassets/riscv.lzma2",
+			newReader:       NewRISCVReader,
+			newWriter:       NewRISCVWriter,
+			newDecompressor: NewRISCVDecompressorForSevenZip,
+		},
+		{
+			name:            "riscv_start_offset",
+			original:        "testassets/riscv.bin",
+			compressed:      "testassets/riscv_start.lzma2",
+			startOffset:     4096,
+			newReader:       NewRISCVReader,
+			newWriter:       NewRISCVWriter,
+			newDecompressor: NewRISCVDecompressorForSevenZip,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			data, filtered := readFiltered(t, tc.original, tc.compressed)
+			r.False(bytes.Equal(data, filtered))
+
+			actual, err := io.ReadAll(tc.newReader(iotest.OneByteReader(bytes.NewReader(filtered)), tc.startOffset))
+			r.NoError(err)
+			r.True(bytes.Equal(data, actual))
+
+			newWriter := func(w io.Writer) io.WriteCloser { return tc.newWriter(w, tc.startOffset) }
+
+			for _, step := range []int{1, 7, len(data)} {
+				r.True(bytes.Equal(filtered, writeFiltered(t, newWriter, data, step)), step)
+			}
+
+			props := []byte{byte(tc.startOffset), byte(tc.startOffset >> 8), byte(tc.startOffset >> 16), byte(tc.startOffset >> 24)}
+
+			rc, err := tc.newDecompressor(props, uint64(len(data)), []io.ReadCloser{io.NopCloser(bytes.NewReader(filtered))})
+			r.NoError(err)
+
+			actual, err = io.ReadAll(rc)
+			r.NoError(err)
+			r.True(bytes.Equal(data, actual))
+			r.NoError(rc.Close())
+
+			_, err = tc.newDecompressor([]byte{0}, 0, []io.ReadCloser{io.NopCloser(bytes.NewReader(filtered))})
+			r.Error(err)
+		})
+	}
+}
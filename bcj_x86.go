@@ -0,0 +1,137 @@
+package lzma
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// x86Converter converts the relative addresses of x86 CALL (E8) and JMP (E9)
+// instructions to absolute ones and back, as BCJ filter of 7-Zip and xz.
+type x86Converter struct {
+	pos      uint32
+	prevPos  uint32
+	prevMask uint32
+}
+
+func newX86Converter(startOffset uint32) converter {
+	return &x86Converter{
+		pos:     startOffset,
+		prevPos: startOffset - 5,
+	}
+}
+
+// x86MaskAllowed and x86MaskBit are indexed by the mask of E8/E9 bytes seen
+// in the previous three bytes.
+var (
+	x86MaskAllowed = [8]bool{true, true, true, false, true, false, false, false}
+	x86MaskBit     = [8]uint32{0, 1, 2, 2, 3, 3, 3, 3}
+)
+
+// x86Test reports whether b is the most significant byte of a near address.
+func x86Test(b byte) bool {
+	return b == 0 || b == 0xFF
+}
+
+func (c *x86Converter) convert(buf []byte, encoding bool) int {
+	if len(buf) < 5 {
+		return 0
+	}
+
+	if c.pos-c.prevPos > 5 {
+		c.prevPos = c.pos - 5
+	}
+
+	limit := len(buf) - 5
+	i := 0
+
+	for i <= limit {
+		b := buf[i]
+		if b != 0xE8 && b != 0xE9 {
+			i++
+
+			continue
+		}
+
+		offset := c.pos + uint32(i) - c.prevPos
+		c.prevPos = c.pos + uint32(i)
+
+		if offset > 5 {
+			c.prevMask = 0
+		} else {
+			for j := uint32(0); j < offset; j++ {
+				c.prevMask &= 0x77
+				c.prevMask <<= 1
+			}
+		}
+
+		b = buf[i+4]
+		if !x86Test(b) || !x86MaskAllowed[(c.prevMask>>1)&0x7] || c.prevMask>>1 >= 0x10 {
+			i++
+			c.prevMask |= 1
+
+			if x86Test(b) {
+				c.prevMask |= 0x10
+			}
+
+			continue
+		}
+
+		src := binary.LittleEndian.Uint32(buf[i+1:])
+
+		var dest uint32
+
+		for {
+			if encoding {
+				dest = src + (c.pos + uint32(i) + 5)
+			} else {
+				dest = src - (c.pos + uint32(i) + 5)
+			}
+
+			if c.prevMask == 0 {
+				break
+			}
+
+			k := x86MaskBit[c.prevMask>>1] * 8
+			if !x86Test(byte(dest >> (24 - k))) {
+				break
+			}
+
+			src = dest ^ (1<<(32-k) - 1)
+		}
+
+		dest &= 0x01FFFFFF
+		if dest&0x01000000 != 0 {
+			dest |= 0xFF000000
+		}
+
+		binary.LittleEndian.PutUint32(buf[i+1:], dest)
+		i += 5
+		c.prevMask = 0
+	}
+
+	c.pos += uint32(i)
+
+	return i
+}
+
+// NewX86Reader creates reader decoding x86 BCJ filter, it is put in front of
+// Reader1 or Reader2 reading the filtered data. The startOffset is the
+// position of the data in the executable, usually zero.
+func NewX86Reader(inStream io.Reader, startOffset uint32) io.Reader {
+	return newFilterReader(inStream, newX86Converter(startOffset))
+}
+
+// NewX86Writer creates writer encoding x86 BCJ filter, it is put in front of
+// Writer1 or Writer2. Close writes the buffered data and does not close
+// outStream.
+func NewX86Writer(outStream io.Writer, startOffset uint32) io.WriteCloser {
+	return newFilterWriter(outStream, newX86Converter(startOffset))
+}
+
+// NewX86DecompressorForSevenZip decompressor constructor for bodgit/sevenzip.
+// The properties are empty or hold the start offset.
+//
+// sevenzip.RegisterDecompressor([]byte{0x03, 0x03, 0x01, 0x03}, sevenzip.Decompressor(lzma.NewX86DecompressorForSevenZip))
+func NewX86DecompressorForSevenZip(props []byte, _ uint64, readers []io.ReadCloser) (io.ReadCloser, error) {
+	return newBCJDecompressor(props, readers, newX86Converter)
+}
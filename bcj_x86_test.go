@@ -0,0 +1,138 @@
+package lzma
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+// readFiltered returns the original and the filtered data of the filter
+// test asset, the filtered data is made by xz and compressed by LZMA2.
+func readFiltered(t *testing.T, original, compressed string) ([]byte, []byte) {
+	t.Helper()
+
+	data, err := os.ReadFile(original)
+	require.NoError(t, err)
+
+	input, err := os.Open(compressed)
+	require.NoError(t, err)
+	defer input.Close()
+
+	r, err := NewReader2(input, 1<<16)
+	require.NoError(t, err)
+
+	filtered, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, len(data), len(filtered))
+
+	return data, filtered
+}
+
+// writeFiltered writes data to the filter in pieces of the given size.
+func writeFiltered(t *testing.T, newWriter func(io.Writer) io.WriteCloser, data []byte, step int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	w := newWriter(&buf)
+
+	for p := data; len(p) > 0; {
+		n := step
+		if n > len(p) {
+			n = len(p)
+		}
+
+		_, err := w.Write(p[:n])
+		require.NoError(t, err)
+
+		p = p[n:]
+	}
+
+	require.NoError(t, w.Close())
+
+	_, err := w.Write([]byte{0})
+	require.Error(t, err)
+
+	return buf.Bytes()
+}
+
+func TestX86Filter(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		compressed  string
+		startOffset uint32
+	}{
+		{
+			name:       "zero_offset",
+			compressed: "testassets/x86.lzma2",
+		},
+		{
+			name:        "start_offset",
+			compressed:  "testassets/x86_start.lzma2",
+			startOffset: 4096,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			data, filtered := readFiltered(t, "testassets/x86.bin", tc.compressed)
+			r.False(bytes.Equal(data, filtered))
+
+			actual, err := io.ReadAll(NewX86Reader(bytes.NewReader(filtered), tc.startOffset))
+			r.NoError(err)
+			r.True(bytes.Equal(data, actual))
+
+			actual, err = io.ReadAll(NewX86Reader(iotest.OneByteReader(bytes.NewReader(filtered)), tc.startOffset))
+			r.NoError(err)
+			r.True(bytes.Equal(data, actual))
+
+			newWriter := func(w io.Writer) io.WriteCloser { return NewX86Writer(w, tc.startOffset) }
+
+			for _, step := range []int{1, 7, len(data)} {
+				r.True(bytes.Equal(filtered, writeFiltered(t, newWriter, data, step)), step)
+			}
+		})
+	}
+}
+
+func TestX86FilterChain(t *testing.T) {
+	r := require.New(t)
+
+	data, err := os.ReadFile("testassets/x86.bin")
+	r.NoError(err)
+
+	var buf bytes.Buffer
+
+	w2, err := NewWriter2(&buf, 1<<16)
+	r.NoError(err)
+
+	w := NewX86Writer(w2, 0)
+	_, err = w.Write(data)
+	r.NoError(err)
+	r.NoError(w.Close())
+	r.NoError(w2.Close())
+
+	rc, err := NewLZMA2DecompressorForSevenZip([]byte{EncodeDictSize2(w2.DictSize())}, 0, []io.ReadCloser{io.NopCloser(&buf)})
+	r.NoError(err)
+
+	rc, err = NewX86DecompressorForSevenZip(nil, uint64(len(data)), []io.ReadCloser{rc})
+	r.NoError(err)
+
+	actual, err := io.ReadAll(rc)
+	r.NoError(err)
+	r.True(bytes.Equal(data, actual))
+	r.NoError(rc.Close())
+
+	_, err = NewX86DecompressorForSevenZip([]byte{1, 2}, 0, []io.ReadCloser{io.NopCloser(&buf)})
+	r.Error(err)
+
+	_, err = NewX86DecompressorForSevenZip(nil, 0, nil)
+	r.Error(err)
+}
@@ -0,0 +1,326 @@
+package lzma
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Coder creates the decoder and the encoder of a filter from its properties.
+type Coder interface {
+	// NewReader creates reader decoding the data read from inStream.
+	NewReader(inStream io.Reader, props []byte) (io.Reader, error)
+	// NewWriter creates writer encoding the data to outStream, its Close
+	// flushes the data and does not close outStream.
+	NewWriter(outStream io.Writer, props []byte) (io.WriteCloser, error)
+}
+
+// Filter describes the filter of the registry.
+type Filter struct {
+	// Name is the name of the filter in xz options.
+	Name string
+	// XZID is the filter ID of .xz files, zero if there is none.
+	XZID uint64
+	// MethodID is the method ID of .7z files, empty if there is none.
+	MethodID string
+	// Last is set for the compressors, which must be the last in the chain.
+	Last bool
+
+	Coder Coder
+}
+
+// FiltersMax is the maximum number of filters in the chain, as in xz.
+const FiltersMax = 4
+
+// IDs of the builtin filters in .xz files.
+const (
+	XZFilterDelta    = 0x03
+	XZFilterX86      = 0x04
+	XZFilterPPC      = 0x05
+	XZFilterIA64     = 0x06
+	XZFilterARM      = 0x07
+	XZFilterARMThumb = 0x08
+	XZFilterSPARC    = 0x09
+	XZFilterARM64    = 0x0A
+	XZFilterRISCV    = 0x0B
+	XZFilterLZMA2    = 0x21
+	XZFilterLZMA1    = 0x4000000000000001
+)
+
+var (
+	errUnknownFilter = errors.New("lzma: unknown filter")
+	errChainLength   = errors.New("lzma: chain must have 1 to 4 filters")
+	errChainLast     = errors.New("lzma: only the last filter of the chain must be LZMA or LZMA2")
+)
+
+var registry = struct {
+	sync.RWMutex
+	byXZID     map[uint64]Filter
+	byMethodID map[string]Filter
+}{
+	byXZID:     make(map[uint64]Filter),
+	byMethodID: make(map[string]Filter),
+}
+
+// RegisterFilter adds the filter to the registry. It panics if the filter has
+// no coder or its ID is already registered.
+func RegisterFilter(f Filter) {
+	if f.Coder == nil {
+		panic("lzma: RegisterFilter of " + f.Name + " without coder")
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, dup := registry.byXZID[f.XZID]; dup && f.XZID != 0 {
+		panic(fmt.Sprintf("lzma: RegisterFilter called twice for xz filter 0x%X", f.XZID))
+	}
+
+	if _, dup := registry.byMethodID[f.MethodID]; dup && f.MethodID != "" {
+		panic(fmt.Sprintf("lzma: RegisterFilter called twice for 7z method %X", f.MethodID))
+	}
+
+	if f.XZID != 0 {
+		registry.byXZID[f.XZID] = f
+	}
+
+	if f.MethodID != "" {
+		registry.byMethodID[f.MethodID] = f
+	}
+}
+
+// FilterByXZID returns the registered filter by its xz filter ID.
+func FilterByXZID(id uint64) (Filter, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	f, ok := registry.byXZID[id]
+
+	return f, ok
+}
+
+// FilterByMethodID returns the registered filter by its 7z method ID.
+func FilterByMethodID(id string) (Filter, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	f, ok := registry.byMethodID[id]
+
+	return f, ok
+}
+
+// FilterSpec is the filter of the chain given by xz filter ID or, if it is
+// not empty, by 7z method ID, and its properties.
+type FilterSpec struct {
+	XZID     uint64
+	MethodID string
+	Props    []byte
+}
+
+// Chain is the chain of filters in the order of encoding: the first filter
+// gets the original data and the last one compresses it.
+type Chain struct {
+	filters []Filter
+	props   [][]byte
+}
+
+// NewChain looks up the filters of the chain in the registry and validates
+// the chain: it has up to FiltersMax filters and ends with LZMA or LZMA2.
+func NewChain(specs ...FilterSpec) (*Chain, error) {
+	if len(specs) == 0 || len(specs) > FiltersMax {
+		return nil, errChainLength
+	}
+
+	c := &Chain{
+		filters: make([]Filter, len(specs)),
+		props:   make([][]byte, len(specs)),
+	}
+
+	for i, spec := range specs {
+		var (
+			f  Filter
+			ok bool
+		)
+
+		if spec.MethodID != "" {
+			f, ok = FilterByMethodID(spec.MethodID)
+		} else {
+			f, ok = FilterByXZID(spec.XZID)
+		}
+
+		if !ok {
+			return nil, fmt.Errorf("%w: xz ID 0x%X, 7z ID %X", errUnknownFilter, spec.XZID, spec.MethodID)
+		}
+
+		if f.Last != (i == len(specs)-1) {
+			return nil, errChainLast
+		}
+
+		c.filters[i] = f
+		c.props[i] = spec.Props
+	}
+
+	return c, nil
+}
+
+// Filters returns the filters of the chain.
+func (c *Chain) Filters() []Filter {
+	return append([]Filter(nil), c.filters...)
+}
+
+// NewReader creates reader decoding the chain from inStream.
+func (c *Chain) NewReader(inStream io.Reader) (io.Reader, error) {
+	r := inStream
+
+	for i := len(c.filters) - 1; i >= 0; i-- {
+		var err error
+
+		r, err = c.filters[i].Coder.NewReader(r, c.props[i])
+		if err != nil {
+			return nil, fmt.Errorf("lzma: %s: %w", c.filters[i].Name, err)
+		}
+	}
+
+	return r, nil
+}
+
+// NewWriter creates writer encoding the chain to outStream. Close closes
+// the filters in order and does not close outStream.
+func (c *Chain) NewWriter(outStream io.Writer) (io.WriteCloser, error) {
+	writers := make([]io.WriteCloser, len(c.filters))
+	w := outStream
+
+	for i := len(c.filters) - 1; i >= 0; i-- {
+		fw, err := c.filters[i].Coder.NewWriter(w, c.props[i])
+		if err != nil {
+			return nil, fmt.Errorf("lzma: %s: %w", c.filters[i].Name, err)
+		}
+
+		writers[i] = fw
+		w = fw
+	}
+
+	return chainWriter(writers), nil
+}
+
+// chainWriter writes to the first filter of the chain.
+type chainWriter []io.WriteCloser
+
+func (c chainWriter) Write(p []byte) (int, error) {
+	return c[0].Write(p)
+}
+
+func (c chainWriter) Close() error {
+	for _, w := range c {
+		err := w.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// coderFuncs is Coder of the builtin filters.
+type coderFuncs struct {
+	newReader func(io.Reader, []byte) (io.Reader, error)
+	newWriter func(io.Writer, []byte) (io.WriteCloser, error)
+}
+
+func (c coderFuncs) NewReader(inStream io.Reader, props []byte) (io.Reader, error) {
+	return c.newReader(inStream, props)
+}
+
+func (c coderFuncs) NewWriter(outStream io.Writer, props []byte) (io.WriteCloser, error) {
+	return c.newWriter(outStream, props)
+}
+
+// bcjCoder is Coder of BCJ filter whose converter is made by newConv.
+func bcjCoder(newConv func(uint32) converter) Coder {
+	return coderFuncs{
+		newReader: func(inStream io.Reader, props []byte) (io.Reader, error) {
+			startOffset, err := DecodeBCJStartOffset(props)
+			if err != nil {
+				return nil, err
+			}
+
+			return newFilterReader(inStream, newConv(startOffset)), nil
+		},
+		newWriter: func(outStream io.Writer, props []byte) (io.WriteCloser, error) {
+			startOffset, err := DecodeBCJStartOffset(props)
+			if err != nil {
+				return nil, err
+			}
+
+			return newFilterWriter(outStream, newConv(startOffset)), nil
+		},
+	}
+}
+
+var deltaCoder = coderFuncs{
+	newReader: func(inStream io.Reader, props []byte) (io.Reader, error) {
+		distance, err := DecodeDeltaDistance(props)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewDeltaReader(inStream, distance)
+	},
+	newWriter: func(outStream io.Writer, props []byte) (io.WriteCloser, error) {
+		distance, err := DecodeDeltaDistance(props)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewDeltaWriter(outStream, distance)
+	},
+}
+
+// lzmaCoder decodes LZMA stream up to the end marker or the end of input,
+// the writer writes the end marker.
+var lzmaCoder = coderFuncs{
+	newReader: func(inStream io.Reader, props []byte) (io.Reader, error) {
+		return NewRawReader1Props(inStream, props, UnpackSizeUnknown, EndMarkerOptional)
+	},
+	newWriter: func(outStream io.Writer, props []byte) (io.WriteCloser, error) {
+		p, err := DecodeProperties(props)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewRawWriter1(outStream, p, true)
+	},
+}
+
+var lzma2Coder = coderFuncs{
+	newReader: func(inStream io.Reader, props []byte) (io.Reader, error) {
+		return NewRawReader2(inStream, props)
+	},
+	newWriter: func(outStream io.Writer, props []byte) (io.WriteCloser, error) {
+		// 40 is the dictionary of 4 GiB - 1, which only the reader takes.
+		if len(props) != 1 || props[0] >= 40 {
+			return nil, ErrIncorrectProperties
+		}
+
+		return NewWriter2(outStream, int(DecodeDictSize2(props[0])))
+	},
+}
+
+func init() {
+	for _, f := range []Filter{
+		{Name: "lzma1", XZID: XZFilterLZMA1, MethodID: "\x03\x01\x01", Last: true, Coder: lzmaCoder},
+		{Name: "lzma2", XZID: XZFilterLZMA2, MethodID: "\x21", Last: true, Coder: lzma2Coder},
+		{Name: "delta", XZID: XZFilterDelta, MethodID: "\x03", Coder: deltaCoder},
+		{Name: "x86", XZID: XZFilterX86, MethodID: "\x03\x03\x01\x03", Coder: bcjCoder(newX86Converter)},
+		{Name: "powerpc", XZID: XZFilterPPC, MethodID: "\x03\x03\x02\x05", Coder: bcjCoder(newPPCConverter)},
+		{Name: "ia64", XZID: XZFilterIA64, MethodID: "\x03\x03\x04\x01", Coder: bcjCoder(newIA64Converter)},
+		{Name: "arm", XZID: XZFilterARM, MethodID: "\x03\x03\x05\x01", Coder: bcjCoder(newARMConverter)},
+		{Name: "armthumb", XZID: XZFilterARMThumb, MethodID: "\x03\x03\x07\x01", Coder: bcjCoder(newARMThumbConverter)},
+		{Name: "sparc", XZID: XZFilterSPARC, MethodID: "\x03\x03\x08\x05", Coder: bcjCoder(newSPARCConverter)},
+		{Name: "arm64", XZID: XZFilterARM64, MethodID: "\x0A", Coder: bcjCoder(newARM64Converter)},
+		{Name: "riscv", XZID: XZFilterRISCV, MethodID: "\x0B", Coder: bcjCoder(newRISCVConverter)},
+	} {
+		RegisterFilter(f)
+	}
+}
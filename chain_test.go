@@ -0,0 +1,220 @@
+package lzma
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// xorFilter is the third-party filter of the tests.
+type xorFilter struct{}
+
+const xorFilterID = 0x4000
+
+func (xorFilter) NewReader(inStream io.Reader, props []byte) (io.Reader, error) {
+	if len(props) != 1 {
+		return nil, ErrIncorrectProperties
+	}
+
+	return newFilterReader(inStream, xorConverter(props[0])), nil
+}
+
+func (xorFilter) NewWriter(outStream io.Writer, props []byte) (io.WriteCloser, error) {
+	if len(props) != 1 {
+		return nil, ErrIncorrectProperties
+	}
+
+	return newFilterWriter(outStream, xorConverter(props[0])), nil
+}
+
+type xorConverter byte
+
+func (c xorConverter) convert(buf []byte, _ bool) int {
+	for i := range buf {
+		buf[i] ^= byte(c)
+	}
+
+	return len(buf)
+}
+
+func init() {
+	RegisterFilter(Filter{Name: "xor", XZID: xorFilterID, MethodID: "\x40\x00", Coder: xorFilter{}})
+}
+
+func TestChain(t *testing.T) {
+	data, err := os.ReadFile("testassets/x86.bin")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name  string
+		specs []FilterSpec
+	}{
+		{
+			name:  "lzma2",
+			specs: []FilterSpec{{XZID: XZFilterLZMA2, Props: []byte{16}}},
+		},
+		{
+			name: "delta_x86_lzma2",
+			specs: []FilterSpec{
+				{XZID: XZFilterDelta, Props: []byte{3}},
+				{XZID: XZFilterX86},
+				{XZID: XZFilterLZMA2, Props: []byte{16}},
+			},
+		},
+		{
+			name: "method_ids",
+			specs: []FilterSpec{
+				{MethodID: "\x03\x03\x05\x01", Props: []byte{0, 0x10, 0, 0}},
+				{MethodID: "\x03\x01\x01", Props: []byte{0x5D, 0, 0, 1, 0}},
+			},
+		},
+		{
+			name: "third_party",
+			specs: []FilterSpec{
+				{XZID: xorFilterID, Props: []byte{0x5A}},
+				{MethodID: "\x03", Props: []byte{0}},
+				{XZID: XZFilterSPARC},
+				{XZID: XZFilterLZMA1, Props: []byte{0x5D, 0, 0, 1, 0}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			chain, err := NewChain(tc.specs...)
+			r.NoError(err)
+
+			var compressed bytes.Buffer
+
+			w, err := chain.NewWriter(&compressed)
+			r.NoError(err)
+
+			_, err = w.Write(data)
+			r.NoError(err)
+			r.NoError(w.Close())
+
+			reader, err := chain.NewReader(&compressed)
+			r.NoError(err)
+
+			actual, err := io.ReadAll(reader)
+			r.NoError(err)
+			r.True(bytes.Equal(data, actual))
+		})
+	}
+}
+
+func TestChainDecodeXZFilters(t *testing.T) {
+	r := require.New(t)
+
+	data, err := os.ReadFile("testassets/x86.bin")
+	r.NoError(err)
+
+	compressed, err := os.ReadFile("testassets/x86.lzma2")
+	r.NoError(err)
+
+	chain, err := NewChain(FilterSpec{XZID: XZFilterX86}, FilterSpec{XZID: XZFilterLZMA2, Props: []byte{8}})
+	r.NoError(err)
+
+	reader, err := chain.NewReader(bytes.NewReader(compressed))
+	r.NoError(err)
+
+	actual, err := io.ReadAll(reader)
+	r.NoError(err)
+	r.True(bytes.Equal(data, actual))
+}
+
+func TestChainErrors(t *testing.T) {
+	x86 := FilterSpec{XZID: XZFilterX86}
+	lzma2 := FilterSpec{XZID: XZFilterLZMA2, Props: []byte{16}}
+
+	testCases := []struct {
+		name  string
+		specs []FilterSpec
+		err   error
+	}{
+		{
+			name: "empty",
+			err:  errChainLength,
+		},
+		{
+			name:  "too_many",
+			specs: []FilterSpec{x86, x86, x86, x86, lzma2},
+			err:   errChainLength,
+		},
+		{
+			name:  "no_lzma",
+			specs: []FilterSpec{x86},
+			err:   errChainLast,
+		},
+		{
+			name:  "lzma_not_last",
+			specs: []FilterSpec{lzma2, x86},
+			err:   errChainLast,
+		},
+		{
+			name:  "two_lzma",
+			specs: []FilterSpec{lzma2, lzma2},
+			err:   errChainLast,
+		},
+		{
+			name:  "unknown_xz_id",
+			specs: []FilterSpec{{XZID: 0x7F}, lzma2},
+			err:   errUnknownFilter,
+		},
+		{
+			name:  "unknown_method_id",
+			specs: []FilterSpec{{MethodID: "\x03\x03\x01\x1B"}, lzma2},
+			err:   errUnknownFilter,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewChain(tc.specs...)
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+
+	chain, err := NewChain(FilterSpec{XZID: XZFilterDelta, Props: []byte{1, 2}}, lzma2)
+	require.NoError(t, err)
+
+	_, err = chain.NewReader(bytes.NewReader([]byte{0}))
+	require.ErrorIs(t, err, errDeltaDistance)
+
+	_, err = chain.NewWriter(io.Discard)
+	require.ErrorIs(t, err, errDeltaDistance)
+
+	chain, err = NewChain(FilterSpec{XZID: XZFilterLZMA2, Props: []byte{40}})
+	require.NoError(t, err)
+
+	_, err = chain.NewWriter(io.Discard)
+	require.ErrorIs(t, err, ErrIncorrectProperties)
+}
+
+func TestRegisterFilter(t *testing.T) {
+	r := require.New(t)
+
+	f, ok := FilterByXZID(XZFilterARM64)
+	r.True(ok)
+	r.Equal("arm64", f.Name)
+	r.Equal("\x0A", f.MethodID)
+
+	f, ok = FilterByMethodID("\x40\x00")
+	r.True(ok)
+	r.Equal("xor", f.Name)
+
+	r.Panics(func() {
+		RegisterFilter(Filter{Name: "x86_copy", XZID: XZFilterX86, Coder: xorFilter{}})
+	})
+	r.Panics(func() {
+		RegisterFilter(Filter{Name: "delta_copy", MethodID: "\x03", Coder: xorFilter{}})
+	})
+	r.Panics(func() {
+		RegisterFilter(Filter{Name: "no_coder", XZID: 0x4001})
+	})
+}
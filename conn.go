@@ -0,0 +1,159 @@
+package lzma
+
+import (
+	"bufio"
+	"net"
+	"sync"
+)
+
+// ConnConfig holds the options of CompressedConn.
+type ConnConfig struct {
+	// DictSize is the dictionary size of the writer and the reader, zero
+	// selects DefaultDictSize. The peers must use the same size.
+	DictSize int
+	// BufferWrites keeps the written data in the encoder until Flush or
+	// Close, it improves the compression ratio of small writes. By default
+	// every Write is flushed.
+	BufferWrites bool
+}
+
+// CompressedConn is net.Conn which sends the data as LZMA2 stream and reads
+// LZMA2 stream from the peer. The deadlines, the addresses and Close are
+// passed to the underlying connection.
+type CompressedConn struct {
+	net.Conn
+
+	cfg ConnConfig
+
+	rmu sync.Mutex
+	br  *bufio.Reader
+	r   *Reader2
+
+	wmu  sync.Mutex
+	bw   *bufio.Writer
+	w    *Writer2
+	werr error
+}
+
+// Conn wraps c to the connection with LZMA2 compression, every Write is
+// flushed as complete chunks so the peer reads it at once.
+func Conn(c net.Conn) net.Conn {
+	// The default dictionary size is always valid.
+	cc, _ := NewConn(c, ConnConfig{})
+
+	return cc
+}
+
+// NewConn wraps c to the connection with LZMA2 compression and the options.
+func NewConn(c net.Conn, cfg ConnConfig) (*CompressedConn, error) {
+	if cfg.DictSize == 0 {
+		cfg.DictSize = DefaultDictSize
+	}
+
+	bw := bufio.NewWriter(c)
+
+	w, err := NewWriter2(bw, cfg.DictSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CompressedConn{
+		Conn: c,
+		cfg:  cfg,
+		br:   bufio.NewReader(c),
+		bw:   bw,
+		w:    w,
+	}, nil
+}
+
+// Read reads the decompressed data, it returns the data of the complete
+// chunks without waiting for more. The read deadline is safe to hit between
+// the writes of the peer, the timeout in the middle of the chunk breaks the
+// stream.
+func (c *CompressedConn) Read(p []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	// The reader reads the first chunk header on creation, it is created
+	// by the first Read to not block NewConn.
+	if c.r == nil {
+		r, err := NewReader2(c.br, int(c.w.DictSize()))
+		if err != nil {
+			return 0, err
+		}
+
+		c.r = r
+	}
+
+	return c.r.Read(p)
+}
+
+// Write compresses p and flushes it unless ConnConfig.BufferWrites is set.
+// The stream is broken after the error, so the following writes return it.
+func (c *CompressedConn) Write(p []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	if c.werr != nil {
+		return 0, c.werr
+	}
+
+	n, err := c.w.Write(p)
+	if err == nil && !c.cfg.BufferWrites {
+		err = c.flush()
+	}
+
+	c.werr = err
+
+	return n, err
+}
+
+// Flush sends the buffered data as complete chunks.
+func (c *CompressedConn) Flush() error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	if c.werr != nil {
+		return c.werr
+	}
+
+	c.werr = c.flush()
+
+	return c.werr
+}
+
+func (c *CompressedConn) flush() error {
+	err := c.w.Flush()
+	if err != nil {
+		return err
+	}
+
+	return c.bw.Flush()
+}
+
+// Close sends the buffered data and the end of stream marker, the peer reads
+// io.EOF after them, and closes the connection. The write deadline bounds
+// the sending.
+func (c *CompressedConn) Close() error {
+	var err error
+
+	c.wmu.Lock()
+
+	if c.werr == nil {
+		err = c.w.Close()
+		if err == nil {
+			err = c.bw.Flush()
+		}
+
+		c.werr = errWriterClosed
+	}
+
+	c.wmu.Unlock()
+
+	closeErr := c.Conn.Close()
+	if closeErr != nil {
+		return closeErr
+	}
+
+	return err
+}
@@ -0,0 +1,167 @@
+package lzma
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// echo answers with the data read from c until io.EOF and reports the read
+// error.
+func echo(c net.Conn, done chan<- error) {
+	buf := make([]byte, 64*1024)
+
+	for {
+		n, err := c.Read(buf)
+		if n > 0 {
+			_, werr := c.Write(buf[:n])
+			if werr != nil {
+				done <- werr
+
+				return
+			}
+		}
+
+		if err != nil {
+			_ = c.Close()
+			done <- err
+
+			return
+		}
+	}
+}
+
+func TestConn(t *testing.T) {
+	r := require.New(t)
+
+	client, server := net.Pipe()
+
+	done := make(chan error, 1)
+	go echo(Conn(server), done)
+
+	c := Conn(client)
+	r.NoError(c.SetDeadline(time.Now().Add(10 * time.Second)))
+
+	large := make([]byte, 3<<20)
+	for i := range large {
+		large[i] = byte(i * i >> 7)
+	}
+
+	for _, message := range [][]byte{
+		[]byte("hello"),
+		[]byte("x"),
+		bytes.Repeat([]byte("replicated record "), 1000),
+		large,
+		[]byte("bye"),
+	} {
+		// net.Pipe is synchronous, the echo is read while writing.
+		written := make(chan error, 1)
+
+		go func() {
+			_, err := c.Write(message)
+			written <- err
+		}()
+
+		actual := make([]byte, len(message))
+		_, err := io.ReadFull(c, actual)
+		r.NoError(err)
+		r.True(bytes.Equal(message, actual))
+		r.NoError(<-written)
+	}
+
+	r.NoError(c.Close())
+	r.ErrorIs(<-done, io.EOF)
+}
+
+func TestConnBufferWrites(t *testing.T) {
+	r := require.New(t)
+
+	client, server := net.Pipe()
+
+	c, err := NewConn(client, ConnConfig{DictSize: 1 << 20, BufferWrites: true})
+	r.NoError(err)
+
+	s, err := NewConn(server, ConnConfig{DictSize: 1 << 20})
+	r.NoError(err)
+
+	flushed := make(chan error, 1)
+
+	go func() {
+		for i := 0; i < 100; i++ {
+			_, err := c.Write([]byte("record\n"))
+			if err != nil {
+				flushed <- err
+
+				return
+			}
+		}
+
+		// The peer does not get the buffered data until Flush.
+		time.Sleep(50 * time.Millisecond)
+
+		flushed <- c.Flush()
+	}()
+
+	buf := make([]byte, 1000)
+
+	r.NoError(s.SetReadDeadline(time.Now().Add(10 * time.Millisecond)))
+	_, err = s.Read(buf)
+	r.ErrorIs(err, os.ErrDeadlineExceeded)
+
+	r.NoError(s.SetReadDeadline(time.Now().Add(10 * time.Second)))
+	_, err = io.ReadFull(s, buf[:700])
+	r.NoError(err)
+	r.Equal(bytes.Repeat([]byte("record\n"), 100), buf[:700])
+	r.NoError(<-flushed)
+
+	go func() {
+		flushed <- c.Close()
+	}()
+
+	_, err = s.Read(buf)
+	r.ErrorIs(err, io.EOF)
+	r.NoError(<-flushed)
+
+	// The peer has closed the pipe before the end of stream marker.
+	r.ErrorIs(s.Close(), io.ErrClosedPipe)
+}
+
+func TestConnWriteDeadline(t *testing.T) {
+	r := require.New(t)
+
+	client, server := net.Pipe()
+	defer server.Close()
+
+	c := Conn(client)
+	r.NoError(c.SetWriteDeadline(time.Now().Add(-time.Second)))
+
+	_, err := c.Write([]byte("data"))
+	r.ErrorIs(err, os.ErrDeadlineExceeded)
+
+	var netErr net.Error
+	r.True(errors.As(err, &netErr) && netErr.Timeout())
+
+	// The stream is broken after the error.
+	r.NoError(c.SetWriteDeadline(time.Time{}))
+
+	_, err = c.Write([]byte("data"))
+	r.ErrorIs(err, os.ErrDeadlineExceeded)
+
+	r.NoError(c.Close())
+	r.Equal(client.LocalAddr(), c.LocalAddr())
+}
+
+func TestNewConnDictSize(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	_, err := NewConn(client, ConnConfig{DictSize: 1})
+	require.ErrorIs(t, err, ErrDictOutOfRange)
+}
@@ -12,11 +12,15 @@ func (r *Reader1) decompress(needBytesCount uint32) (err error) {
 
 	for r.outWindow.pending < needBytesCount {
 		if s.unpackSizeDefined && s.bytesLeft == 0 {
-			if rCode == 0 {
+			if rCode == 0 && r.endMarker != EndMarkerRequired {
 				err = io.EOF
 
 				break
 			}
+
+			if r.endMarker == EndMarkerForbidden {
+				return ErrResultError
+			}
 		}
 
 		s.posState = r.outWindow.pos & s.posMask
@@ -636,6 +640,7 @@ func (r *Reader1) decompress(needBytesCount uint32) (err error) {
 											return ErrResultError
 										}
 
+										r.markerFound = true
 										err = io.EOF
 
 										break
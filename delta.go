@@ -0,0 +1,113 @@
+package lzma
+
+import (
+	"errors"
+	"io"
+)
+
+// DeltaDistanceMax is the maximum distance of Delta filter.
+const DeltaDistanceMax = 256
+
+var errDeltaDistance = errors.New("lzma: delta distance is out of range")
+
+// deltaConverter stores the difference of the byte and the byte distance
+// bytes before it. It converts all bytes at once.
+type deltaConverter struct {
+	distance int
+	history  [DeltaDistanceMax]byte
+	pos      uint8
+}
+
+func newDeltaConverter(distance int) (*deltaConverter, error) {
+	if distance < 1 || distance > DeltaDistanceMax {
+		return nil, errDeltaDistance
+	}
+
+	return &deltaConverter{distance: distance}, nil
+}
+
+func (c *deltaConverter) convert(buf []byte, encoding bool) int {
+	for i, b := range buf {
+		prev := c.history[uint8(c.distance+int(c.pos))]
+
+		if encoding {
+			buf[i] = b - prev
+		} else {
+			b += prev
+			buf[i] = b
+		}
+
+		c.history[c.pos] = b
+		c.pos--
+	}
+
+	return len(buf)
+}
+
+// DecodeDeltaDistance decodes the properties of Delta filter of 7z and xz
+// files: one byte with the distance minus one.
+func DecodeDeltaDistance(props []byte) (int, error) {
+	if len(props) != 1 {
+		return 0, errDeltaDistance
+	}
+
+	return int(props[0]) + 1, nil
+}
+
+// EncodeDeltaDistance encodes the distance to the properties of Delta
+// filter.
+func EncodeDeltaDistance(distance int) ([]byte, error) {
+	if distance < 1 || distance > DeltaDistanceMax {
+		return nil, errDeltaDistance
+	}
+
+	return []byte{byte(distance - 1)}, nil
+}
+
+// NewDeltaReader creates reader decoding Delta filter with the distance from
+// 1 to DeltaDistanceMax, it is put in front of Reader1 or Reader2.
+func NewDeltaReader(inStream io.Reader, distance int) (io.Reader, error) {
+	c, err := newDeltaConverter(distance)
+	if err != nil {
+		return nil, err
+	}
+
+	return newFilterReader(inStream, c), nil
+}
+
+// NewDeltaWriter creates writer encoding Delta filter, it is put in front of
+// Writer1 or Writer2. Close writes the buffered data and does not close
+// outStream.
+func NewDeltaWriter(outStream io.Writer, distance int) (io.WriteCloser, error) {
+	c, err := newDeltaConverter(distance)
+	if err != nil {
+		return nil, err
+	}
+
+	return newFilterWriter(outStream, c), nil
+}
+
+// NewDeltaDecompressorForSevenZip decompressor constructor for
+// bodgit/sevenzip.
+//
+// sevenzip.RegisterDecompressor([]byte{0x03}, sevenzip.Decompressor(lzma.NewDeltaDecompressorForSevenZip))
+func NewDeltaDecompressorForSevenZip(props []byte, _ uint64, readers []io.ReadCloser) (io.ReadCloser, error) {
+	if len(readers) != 1 {
+		return nil, errNeedOneReader
+	}
+
+	distance, err := DecodeDeltaDistance(props)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := NewDeltaReader(readers[0], distance)
+	if err != nil {
+		return nil, err
+	}
+
+	return &readCloser{
+		c: readers[0],
+		r: r,
+	}, nil
+}
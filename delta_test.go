@@ -0,0 +1,97 @@
+package lzma
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeltaFilter(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		compressed string
+		distance   int
+	}{
+		{
+			name:       "distance_4",
+			compressed: "testassets/delta4.lzma2",
+			distance:   4,
+		},
+		{
+			name:       "distance_256",
+			compressed: "testassets/delta256.lzma2",
+			distance:   256,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			data, filtered := readFiltered(t, "testassets/delta.bin", tc.compressed)
+
+			reader, err := NewDeltaReader(iotest.OneByteReader(bytes.NewReader(filtered)), tc.distance)
+			r.NoError(err)
+
+			actual, err := io.ReadAll(reader)
+			r.NoError(err)
+			r.True(bytes.Equal(data, actual))
+
+			newWriter := func(w io.Writer) io.WriteCloser {
+				dw, err := NewDeltaWriter(w, tc.distance)
+				r.NoError(err)
+
+				return dw
+			}
+
+			for _, step := range []int{1, 7, len(data)} {
+				r.True(bytes.Equal(filtered, writeFiltered(t, newWriter, data, step)), step)
+			}
+
+			props, err := EncodeDeltaDistance(tc.distance)
+			r.NoError(err)
+
+			rc, err := NewDeltaDecompressorForSevenZip(props, uint64(len(data)), []io.ReadCloser{io.NopCloser(bytes.NewReader(filtered))})
+			r.NoError(err)
+
+			actual, err = io.ReadAll(rc)
+			r.NoError(err)
+			r.True(bytes.Equal(data, actual))
+			r.NoError(rc.Close())
+		})
+	}
+}
+
+func TestDeltaDistance(t *testing.T) {
+	r := require.New(t)
+
+	for _, distance := range []int{0, -1, DeltaDistanceMax + 1} {
+		_, err := NewDeltaReader(bytes.NewReader(nil), distance)
+		r.Error(err)
+
+		_, err = NewDeltaWriter(io.Discard, distance)
+		r.Error(err)
+
+		_, err = EncodeDeltaDistance(distance)
+		r.Error(err)
+	}
+
+	for _, distance := range []int{1, DeltaDistanceMax} {
+		props, err := EncodeDeltaDistance(distance)
+		r.NoError(err)
+
+		decoded, err := DecodeDeltaDistance(props)
+		r.NoError(err)
+		r.Equal(distance, decoded)
+	}
+
+	_, err := DecodeDeltaDistance(nil)
+	r.Error(err)
+
+	_, err = NewDeltaDecompressorForSevenZip([]byte{1, 2}, 0, []io.ReadCloser{io.NopCloser(bytes.NewReader(nil))})
+	r.Error(err)
+}
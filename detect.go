@@ -0,0 +1,223 @@
+package lzma
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Format is the format of compressed data detected by NewReader.
+type Format string
+
+// Formats recognized by NewReader. FormatXZ, FormatLzip and Format7z are
+// registered by the xz, lzip and sevenzip packages, so the package must be
+// imported to read its format, otherwise NewReader returns
+// ErrFormatNotRegistered:
+//
+//	import _ "github.com/kulaginds/lzma/xz"
+//
+// The .7z archive must hold a single file and is read into memory, up to
+// 64 MiB.
+const (
+	FormatLZMA  Format = "lzma"
+	FormatLZMA2 Format = "lzma2"
+	FormatXZ    Format = "xz"
+	FormatLzip  Format = "lzip"
+	Format7z    Format = "7z"
+)
+
+type format struct {
+	format    Format
+	magic     string
+	newReader func(io.Reader) (io.Reader, error)
+}
+
+var formats struct {
+	sync.RWMutex
+	list []format
+}
+
+// RegisterFormat registers the format whose data starts with magic for
+// NewReader. The newReader gets the input from its first byte.
+func RegisterFormat(f Format, magic string, newReader func(io.Reader) (io.Reader, error)) {
+	formats.Lock()
+	defer formats.Unlock()
+
+	formats.list = append(formats.list, format{format: f, magic: magic, newReader: newReader})
+}
+
+// builtinFormats are the formats of the subpackages of this module. They are
+// recognized by magic when the package is not imported, so NewReader reports
+// the missing import instead of the raw stream found by the heuristics.
+var builtinFormats = []struct {
+	format Format
+	magic  string
+	pkg    string
+}{
+	{format: FormatXZ, magic: xzMagic, pkg: "github.com/kulaginds/lzma/xz"},
+	{format: FormatLzip, magic: lzipMagic, pkg: "github.com/kulaginds/lzma/lzip"},
+	{format: Format7z, magic: sevenZipMagic, pkg: "github.com/kulaginds/lzma/sevenzip"},
+}
+
+// sevenZipMagic is the signature of .7z archive.
+const sevenZipMagic = "7z\xBC\xAF\x27\x1C"
+
+// sniffLen is the number of bytes peeked by NewReader: .lzma header and the
+// first byte of the range coder.
+const sniffLen = LZMAHeaderLen + 1
+
+// lzma2SniffLen is the number of bytes peeked by NewReader for raw LZMA2: the
+// largest first chunk and the control byte of the next one.
+const lzma2SniffLen = 6 + lzma2ChunkPackedMax + 1
+
+// rawLZMA2DictSize is the dictionary size of raw LZMA2 stream, which does not
+// store it.
+const rawLZMA2DictSize = DefaultDictSize
+
+// NewReader detects the format of inStream and creates its reader. The
+// registered formats are detected by magic, then .lzma is detected by its
+// header and raw LZMA2 by its first chunk and the start of the next one, it
+// is decoded with DefaultDictSize dictionary. The magic of .xz, .lz and .7z
+// gives ErrFormatNotRegistered with the detected format if its package is not
+// imported.
+func NewReader(inStream io.Reader) (io.Reader, Format, error) {
+	br := bufio.NewReader(inStream)
+
+	head, err := br.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, "", err
+	}
+
+	formats.RLock()
+	list := formats.list
+	formats.RUnlock()
+
+	for _, f := range list {
+		if len(head) >= len(f.magic) && string(head[:len(f.magic)]) == f.magic {
+			r, err := f.newReader(br)
+			if err != nil {
+				return nil, f.format, err
+			}
+
+			return r, f.format, nil
+		}
+	}
+
+	for _, f := range builtinFormats {
+		if len(head) >= len(f.magic) && string(head[:len(f.magic)]) == f.magic {
+			return nil, f.format, fmt.Errorf("%w: %s; import %s", ErrFormatNotRegistered, f.format, f.pkg)
+		}
+	}
+
+	if isLZMAHeader(head) {
+		r, err := NewReader1(br)
+		if err != nil {
+			return nil, FormatLZMA, err
+		}
+
+		return r, FormatLZMA, nil
+	}
+
+	if isLZMA2Chunk(head) {
+		// The larger buffer reads from br, which keeps the peeked bytes.
+		lr := bufio.NewReaderSize(br, lzma2SniffLen)
+		if !isLZMA2Stream(lr) {
+			return nil, "", ErrUnknownFormat
+		}
+
+		r, err := NewReader2(lr, rawLZMA2DictSize)
+		if err != nil {
+			return nil, FormatLZMA2, err
+		}
+
+		return r, FormatLZMA2, nil
+	}
+
+	return nil, "", ErrUnknownFormat
+}
+
+// isLZMAHeader reports whether head is plausible .lzma header: valid
+// properties, the unpack size is unknown or less than 256 GiB, as xz checks,
+// and the first byte of the range coder is zero.
+func isLZMAHeader(head []byte) bool {
+	if len(head) < sniffLen {
+		return false
+	}
+
+	_, _, _, err := DecodeProp(head[0])
+	if err != nil {
+		return false
+	}
+
+	_, err = DecodeDictSize(head[1:LZMAPropsLen])
+	if err != nil {
+		return false
+	}
+
+	unpackSize := DecodeUnpackSize(head[LZMAPropsLen:])
+	if unpackSize != UnpackSizeUnknown && unpackSize >= 1<<38 {
+		return false
+	}
+
+	return head[LZMAHeaderLen] == 0
+}
+
+// isLZMA2Stream reports whether br starts with LZMA2 stream, as matchLZMA2 of
+// Scan checks it: the first chunk is plausible, its size fits the input and
+// it is followed by the control byte of the next chunk. The stream must have
+// LZMA chunk, so it does not end after uncompressed chunk and LZMA chunk after
+// it sets the properties.
+func isLZMA2Stream(br *bufio.Reader) bool {
+	head, _ := br.Peek(7)
+	if !isLZMA2Chunk(head) {
+		return false
+	}
+
+	typ := decodeChunkType(head[0])
+	n := chunkLength(typ) + int(binary.BigEndian.Uint16(head[1:])) + 1
+
+	if typ != chunkUncompressedResetDict {
+		n = chunkLength(typ) + int(binary.BigEndian.Uint16(head[3:])) + 1
+	}
+
+	data, _ := br.Peek(n + 1)
+	if len(data) <= n {
+		return false
+	}
+
+	switch control := data[n]; {
+	case control == uncompressedResetDict, control == uncompressedNoResetDict:
+		return true
+	case typ == chunkUncompressedResetDict:
+		return control >= maskLZMAResetStateNewProp<<5
+	default:
+		return control == endOfStreamCode || control >= 0x80
+	}
+}
+
+// isLZMA2Chunk reports whether head starts with the first chunk of LZMA2
+// stream: it resets the dictionary and, if it is LZMA chunk, sets valid
+// properties followed by zero byte of the range coder.
+func isLZMA2Chunk(head []byte) bool {
+	if len(head) < 1 {
+		return false
+	}
+
+	switch typ := decodeChunkType(head[0]); typ {
+	case chunkUncompressedResetDict:
+		return len(head) >= chunkLength(typ)
+	case chunkLZMAResetStateNewPropResetDict:
+		if len(head) < chunkLength(typ)+1 {
+			return false
+		}
+
+		lc, _, lp, err := DecodeProp(head[5])
+
+		return err == nil && lc+lp <= 4 && head[6] == 0
+	}
+
+	return false
+}
@@ -0,0 +1,179 @@
+package lzma
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	RegisterFormat("test", "TEST", func(inStream io.Reader) (io.Reader, error) {
+		return io.MultiReader(strings.NewReader("decoded "), inStream), nil
+	})
+}
+
+func TestNewReader(t *testing.T) {
+	a, err := os.ReadFile("testassets/a.lzma")
+	require.NoError(t, err)
+
+	reader, err := NewReader1(bytes.NewReader(a))
+	require.NoError(t, err)
+
+	a, err = io.ReadAll(reader)
+	require.NoError(t, err)
+
+	_, filtered := readFiltered(t, "testassets/x86.bin", "testassets/x86.lzma2")
+
+	testCases := []struct {
+		name string
+
+		inputFile string
+		format    Format
+		expected  []byte
+		md5       string
+	}{
+		{
+			name:      "lzma",
+			inputFile: "testassets/a.lzma",
+			format:    FormatLZMA,
+			expected:  a,
+		},
+		{
+			name:      "lzma_eos",
+			inputFile: "testassets/a_eos.lzma",
+			format:    FormatLZMA,
+			expected:  a,
+		},
+		{
+			name:      "lzma_large",
+			inputFile: "testassets/randomfile.dat.lzma",
+			format:    FormatLZMA,
+			md5:       randomFileMD5,
+		},
+		{
+			name:      "lzma2",
+			inputFile: "testassets/randomfile.dat.lzma2",
+			format:    FormatLZMA2,
+			md5:       randomFileMD5,
+		},
+		{
+			name:      "lzma2_filtered",
+			inputFile: "testassets/x86.lzma2",
+			format:    FormatLZMA2,
+			expected:  filtered,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			input, err := os.Open(tc.inputFile)
+			r.NoError(err)
+			defer input.Close()
+
+			reader, format, err := NewReader(input)
+			r.NoError(err)
+			r.Equal(tc.format, format)
+
+			actual, err := io.ReadAll(reader)
+			r.NoError(err)
+
+			if tc.md5 != "" {
+				r.Equal(tc.md5, fmt.Sprintf("%x", md5.Sum(actual)))
+			} else {
+				r.True(bytes.Equal(tc.expected, actual))
+			}
+		})
+	}
+}
+
+func TestNewReaderRegistered(t *testing.T) {
+	r := require.New(t)
+
+	reader, format, err := NewReader(strings.NewReader("TEST data"))
+	r.NoError(err)
+	r.Equal(Format("test"), format)
+
+	actual, err := io.ReadAll(reader)
+	r.NoError(err)
+	r.Equal("decoded TEST data", string(actual))
+}
+
+func TestNewReaderNotRegistered(t *testing.T) {
+	testCases := []struct {
+		inputFile string
+		format    Format
+		pkg       string
+	}{
+		{inputFile: "xz/testassets/a.xz", format: FormatXZ, pkg: "github.com/kulaginds/lzma/xz"},
+		{inputFile: "lzip/testassets/a.lz", format: FormatLzip, pkg: "github.com/kulaginds/lzma/lzip"},
+		{inputFile: "sevenzip/testassets/bcj.7z", format: Format7z, pkg: "github.com/kulaginds/lzma/sevenzip"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.format), func(t *testing.T) {
+			r := require.New(t)
+
+			input, err := os.Open(tc.inputFile)
+			r.NoError(err)
+			defer input.Close()
+
+			// The package is not imported by the tests of lzma.
+			_, format, err := NewReader(input)
+			r.ErrorIs(err, ErrFormatNotRegistered)
+			r.ErrorContains(err, tc.pkg)
+			r.Equal(tc.format, format)
+		})
+	}
+}
+
+func TestNewReaderUnknown(t *testing.T) {
+	a, err := os.ReadFile("testassets/a.lzma")
+	require.NoError(t, err)
+
+	badRangeByte := append([]byte(nil), a...)
+	badRangeByte[LZMAHeaderLen] = 1
+
+	badProps := append([]byte(nil), a...)
+	badProps[0] = 225
+
+	hugeSize := append([]byte(nil), a...)
+	hugeSize[LZMAHeaderLen-1] = 1
+
+	lzma2, err := os.ReadFile("testassets/x86.lzma2")
+	require.NoError(t, err)
+
+	// The first chunk is LZMA chunk of 6 bytes of the header and the packed
+	// data.
+	firstChunk := 6 + int(lzma2[3])<<8 + int(lzma2[4]) + 1
+
+	lzma2BadNext := append([]byte(nil), lzma2[:firstChunk]...)
+	lzma2BadNext = append(lzma2BadNext, 0x05)
+
+	for name, data := range map[string][]byte{
+		"empty":           nil,
+		"text":            []byte("plain text is not compressed"),
+		"short_header":    a[:LZMAHeaderLen],
+		"bad_range_byte":  badRangeByte,
+		"bad_props":       badProps,
+		"huge_size":       hugeSize,
+		"lzma2_no_reset":  {0x80, 0, 0, 0, 0, 0, 0},
+		"lzma2_bad_lclp":  {0xE0, 0, 0, 0, 0, EncodeProp(4, 0, 1), 0},
+		"lzma2_short":     {0x01, 0, 0},
+		"lzma2_no_lzma":   {0x01, 0, 0, 'x', 0x00},
+		"lzma2_truncated": lzma2[:firstChunk],
+		"lzma2_bad_next":  lzma2BadNext,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := NewReader(bytes.NewReader(data))
+			require.ErrorIs(t, err, ErrUnknownFormat)
+		})
+	}
+}
@@ -0,0 +1,405 @@
+package lzma
+
+import (
+	"math/bits"
+)
+
+const (
+	kNumReps = 4
+
+	// backLiteral marks the literal symbol in the result of nextSymbol.
+	// Values below kNumReps select a rep match, other values hold the
+	// match distance increased by kNumReps.
+	backLiteral = ^uint32(0)
+
+	// encoderLookahead is the amount of data the encoder keeps unprocessed
+	// until the stream is flushed, so the lazy matching always sees the
+	// longest possible matches.
+	encoderLookahead = maxMatchLen + 1
+
+	encoderDepth   = 48
+	encoderNiceLen = 64
+)
+
+// encoder is LZMA encoder with the fast parsing of LZMA SDK: the longest
+// match wins unless one of the rep matches is nearly as long or the match at
+// the next position is better.
+type encoder struct {
+	s  *state
+	rc *rangeEncoder
+	mf *matchFinder
+
+	dictSize uint32
+
+	// pos is the uncompressed position of the next symbol since the last
+	// dictionary reset.
+	pos uint64
+	// ahead is the number of positions the match finder has already read
+	// past pos.
+	ahead int
+
+	matches     []uint32
+	nextMatches []uint32
+}
+
+func newEncoder(rc *rangeEncoder, props Properties, histSize int) *encoder {
+	return &encoder{
+		s:  newState(props.LC, props.PB, props.LP),
+		rc: rc,
+		mf: newMatchFinder(props.DictSize, histSize, encoderDepth, encoderNiceLen),
+
+		dictSize: props.DictSize,
+
+		matches:     make([]uint32, 0, 2*(maxMatchLen+1)),
+		nextMatches: make([]uint32, 0, 2*(maxMatchLen+1)),
+	}
+}
+
+func (e *encoder) Reset() {
+	e.s.Reset()
+	e.mf.Reset()
+	e.pos = 0
+	e.ahead = 0
+}
+
+// avail returns the number of buffered bytes starting from pos.
+func (e *encoder) avail() int {
+	return e.mf.Avail() + e.ahead
+}
+
+// index returns the index of pos in the match finder buffer.
+func (e *encoder) index() int {
+	return e.mf.cur - e.ahead
+}
+
+func (e *encoder) readMatches() {
+	e.matches = append(e.matches[:0], e.mf.FindMatches()...)
+	e.ahead++
+}
+
+func (e *encoder) readNextMatches() {
+	e.nextMatches = append(e.nextMatches[:0], e.mf.FindMatches()...)
+	e.ahead++
+}
+
+// repLen returns the length of the match at the distance of rep, it is zero
+// when the distance is out of the dictionary.
+func (e *encoder) repLen(rep uint32, i, limit int) int {
+	dist := uint64(rep) + 1
+	if dist > e.pos || dist > uint64(e.dictSize) {
+		return 0
+	}
+
+	buf := e.mf.buf
+	j := i - int(dist)
+	if buf[i] != buf[j] || buf[i+1] != buf[j+1] {
+		return 0
+	}
+
+	return 2 + commonPrefixLen(buf[j+2:j+limit], buf[i+2:i+limit])
+}
+
+func changePair(smallDist, bigDist uint32) bool {
+	return (bigDist >> 7) > smallDist
+}
+
+// nextSymbol chooses the symbol at pos, see GetOptimumFast of LZMA SDK.
+func (e *encoder) nextSymbol() (back uint32, length uint32) {
+	if e.ahead == 0 {
+		e.readMatches()
+	}
+
+	avail := e.avail()
+	if avail < 2 {
+		return backLiteral, 1
+	}
+
+	if avail > maxMatchLen {
+		avail = maxMatchLen
+	}
+
+	i := e.index()
+	reps := [kNumReps]uint32{e.s.rep0, e.s.rep1, e.s.rep2, e.s.rep3}
+
+	repLen, repIndex := 0, 0
+	for k, rep := range reps {
+		l := e.repLen(rep, i, avail)
+		if l >= encoderNiceLen {
+			return uint32(k), uint32(l)
+		}
+
+		if l > repLen {
+			repLen, repIndex = l, k
+		}
+	}
+
+	numPairs := len(e.matches)
+	mainLen, mainDist := uint32(0), uint32(0)
+
+	if numPairs > 0 {
+		mainLen, mainDist = e.matches[numPairs-2], e.matches[numPairs-1]
+
+		if mainLen >= encoderNiceLen {
+			return mainDist + kNumReps, mainLen
+		}
+
+		for numPairs > 2 && mainLen == e.matches[numPairs-4]+1 {
+			if !changePair(e.matches[numPairs-3], mainDist) {
+				break
+			}
+
+			numPairs -= 2
+			mainLen, mainDist = e.matches[numPairs-2], e.matches[numPairs-1]
+		}
+
+		if mainLen == 2 && mainDist >= 0x80 {
+			mainLen = 1
+		}
+	}
+
+	if repLen >= 2 && (uint32(repLen)+1 >= mainLen ||
+		(uint32(repLen)+2 >= mainLen && mainDist >= 1<<9) ||
+		(uint32(repLen)+3 >= mainLen && mainDist >= 1<<15)) {
+		return uint32(repIndex), uint32(repLen)
+	}
+
+	if mainLen < 2 || avail <= 2 {
+		return backLiteral, 1
+	}
+
+	e.readNextMatches()
+
+	if n := len(e.nextMatches); n > 0 {
+		newLen, newDist := e.nextMatches[n-2], e.nextMatches[n-1]
+
+		if (newLen >= mainLen && newDist < mainDist) ||
+			(newLen == mainLen+1 && !changePair(mainDist, newDist)) ||
+			newLen > mainLen+1 ||
+			(newLen+1 >= mainLen && mainLen >= 3 && changePair(newDist, mainDist)) {
+			return backLiteral, 1
+		}
+	}
+
+	limit := int(mainLen) - 1
+	if limit < 2 {
+		limit = 2
+	}
+
+	for _, rep := range reps {
+		if e.repLen(rep, i, limit) >= limit {
+			return backLiteral, 1
+		}
+	}
+
+	return mainDist + kNumReps, mainLen
+}
+
+// skip moves the match finder past the symbol of the given length.
+func (e *encoder) skip(length int) {
+	switch {
+	case length > e.ahead:
+		e.mf.Skip(length - e.ahead)
+		e.ahead = 0
+	case length == e.ahead:
+		e.ahead = 0
+	default:
+		e.matches, e.nextMatches = e.nextMatches, e.matches
+		e.ahead -= length
+	}
+}
+
+// encodeSymbol chooses and encodes the next symbol and returns its length.
+func (e *encoder) encodeSymbol() uint32 {
+	back, length := e.nextSymbol()
+
+	s := e.s
+	posState := uint32(e.pos) & s.posMask
+	state2 := (s.state << kNumPosBitsMax) + posState
+
+	switch {
+	case back == backLiteral:
+		e.rc.EncodeBit(&s.isMatch[state2], 0)
+		e.encodeLiteral()
+		s.state = stateUpdateLiteral(s.state)
+	case back < kNumReps:
+		e.rc.EncodeBit(&s.isMatch[state2], 1)
+		e.rc.EncodeBit(&s.isRep[s.state], 1)
+
+		if back == 0 {
+			e.rc.EncodeBit(&s.isRepG0[s.state], 0)
+			e.rc.EncodeBit(&s.isRep0Long[state2], 1)
+		} else {
+			e.rc.EncodeBit(&s.isRepG0[s.state], 1)
+
+			dist := s.rep1
+			if back == 1 {
+				e.rc.EncodeBit(&s.isRepG1[s.state], 0)
+			} else {
+				e.rc.EncodeBit(&s.isRepG1[s.state], 1)
+
+				if back == 2 {
+					e.rc.EncodeBit(&s.isRepG2[s.state], 0)
+					dist = s.rep2
+				} else {
+					e.rc.EncodeBit(&s.isRepG2[s.state], 1)
+					dist = s.rep3
+					s.rep3 = s.rep2
+				}
+
+				s.rep2 = s.rep1
+			}
+
+			s.rep1 = s.rep0
+			s.rep0 = dist
+		}
+
+		e.encodeLen(&s.repLenDecoderChoice, &s.repLenDecoderChoice2, &s.repLenDecoderLowCoder, &s.repLenDecoderMidCoder, &s.repLenDecoderHighCoder, length-kMatchMinLen, posState)
+		s.state = stateUpdateRep(s.state)
+	default:
+		dist := back - kNumReps
+
+		e.rc.EncodeBit(&s.isMatch[state2], 1)
+		e.rc.EncodeBit(&s.isRep[s.state], 0)
+		e.encodeLen(&s.lenDecoderChoice, &s.lenDecoderChoice2, &s.lenDecoderLowCoder, &s.lenDecoderMidCoder, &s.lenDecoderHighCoder, length-kMatchMinLen, posState)
+		e.encodeDistance(dist, length-kMatchMinLen)
+
+		s.rep3, s.rep2, s.rep1, s.rep0 = s.rep2, s.rep1, s.rep0, dist
+		s.state = stateUpdateMatch(s.state)
+	}
+
+	e.skip(int(length))
+	e.pos += uint64(length)
+
+	return length
+}
+
+func (e *encoder) encodeLiteral() {
+	s := e.s
+	buf := e.mf.buf
+	i := e.index()
+
+	prevByte := uint32(0)
+	if e.pos > 0 {
+		prevByte = uint32(buf[i-1])
+	}
+
+	litState := ((uint32(e.pos) & ((1 << s.lp) - 1)) << s.lc) + (prevByte >> (8 - s.lc))
+	probs := s.litProbs[uint32(0x300)*litState:]
+
+	symbol := uint32(buf[i]) | 0x100
+
+	if s.state >= 7 {
+		matchByte := uint32(buf[i-int(s.rep0)-1])
+
+		for symbol < 0x10000 {
+			matchByte <<= 1
+			matchBit := (matchByte >> 8) & 1
+			bit := (symbol >> 7) & 1
+
+			e.rc.EncodeBit(&probs[((1+matchBit)<<8)+(symbol>>8)], bit)
+			symbol <<= 1
+
+			if matchBit != bit {
+				break
+			}
+		}
+	}
+
+	for symbol < 0x10000 {
+		e.rc.EncodeBit(&probs[symbol>>8], (symbol>>7)&1)
+		symbol <<= 1
+	}
+}
+
+func (e *encoder) encodeLen(choice, choice2 *prob, lowCoder, midCoder *[1 << kNumPosBitsMax][1 << lenLowCoderNumBits]prob, highCoder *[1 << lenHighCoderNumBits]prob, length, posState uint32) {
+	if length < 8 {
+		e.rc.EncodeBit(choice, 0)
+		e.bitTreeEncode(lowCoder[posState][:], lenLowCoderNumBits, length)
+
+		return
+	}
+
+	e.rc.EncodeBit(choice, 1)
+
+	if length < 16 {
+		e.rc.EncodeBit(choice2, 0)
+		e.bitTreeEncode(midCoder[posState][:], lenMidCoderNumBits, length-8)
+
+		return
+	}
+
+	e.rc.EncodeBit(choice2, 1)
+	e.bitTreeEncode(highCoder[:], lenHighCoderNumBits, length-16)
+}
+
+func getPosSlot(dist uint32) uint32 {
+	if dist < kStartPosModelIndex {
+		return dist
+	}
+
+	n := uint32(bits.Len32(dist)) - 1
+
+	return 2*n + ((dist >> (n - 1)) & 1)
+}
+
+func (e *encoder) encodeDistance(dist, length uint32) {
+	lenState := length
+	if lenState > kNumLenToPosStates-1 {
+		lenState = kNumLenToPosStates - 1
+	}
+
+	s := e.s
+	posSlot := getPosSlot(dist)
+	e.bitTreeEncode(s.posSlotDecoderProbs[lenState][:], posSlotDecoderNumBits, posSlot)
+
+	if posSlot < kStartPosModelIndex {
+		return
+	}
+
+	numDirectBits := (posSlot >> 1) - 1
+	base := (2 | (posSlot & 1)) << numDirectBits
+	reduced := dist - base
+
+	if posSlot < kEndPosModelIndex {
+		e.bitTreeReverseEncode(s.posDecoders[base-posSlot:], int(numDirectBits), reduced)
+
+		return
+	}
+
+	e.rc.EncodeDirectBits(reduced>>kNumAlignBits, int(numDirectBits-kNumAlignBits))
+	e.bitTreeReverseEncode(s.alignDecoderProbs[:], kNumAlignBits, reduced&(1<<kNumAlignBits-1))
+}
+
+// encodeEndMarker encodes the match with distance 0xFFFFFFFF that marks the
+// end of stream.
+func (e *encoder) encodeEndMarker() {
+	s := e.s
+	posState := uint32(e.pos) & s.posMask
+	state2 := (s.state << kNumPosBitsMax) + posState
+
+	e.rc.EncodeBit(&s.isMatch[state2], 1)
+	e.rc.EncodeBit(&s.isRep[s.state], 0)
+	e.encodeLen(&s.lenDecoderChoice, &s.lenDecoderChoice2, &s.lenDecoderLowCoder, &s.lenDecoderMidCoder, &s.lenDecoderHighCoder, 0, posState)
+	e.encodeDistance(0xFFFFFFFF, 0)
+}
+
+func (e *encoder) bitTreeEncode(probs []prob, numBits int, symbol uint32) {
+	m := uint32(1)
+
+	for i := numBits - 1; i >= 0; i-- {
+		bit := (symbol >> i) & 1
+		e.rc.EncodeBit(&probs[m], bit)
+		m = (m << 1) | bit
+	}
+}
+
+func (e *encoder) bitTreeReverseEncode(probs []prob, numBits int, symbol uint32) {
+	m := uint32(1)
+
+	for i := 0; i < numBits; i++ {
+		bit := symbol & 1
+		symbol >>= 1
+		e.rc.EncodeBit(&probs[m], bit)
+		m = (m << 1) | bit
+	}
+}
@@ -9,4 +9,6 @@ var (
 	ErrDictOutOfRange      = errors.New("dictionary capacity is out of range")
 	ErrUnexpectedLZMA2Code = errors.New("unexpected lzma2 code")
 	ErrNoLZMAReader        = errors.New("no lzma reader on chunkLZMAResetState")
+	ErrUnknownFormat       = errors.New("unknown compression format")
+	ErrFormatNotRegistered = errors.New("compression format detected but not registered")
 )
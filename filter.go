@@ -0,0 +1,136 @@
+package lzma
+
+import (
+	"errors"
+	"io"
+)
+
+// filterBufSize is the buffer size of filterReader and filterWriter.
+const filterBufSize = 1 << 16
+
+var errFilterClosed = errors.New("lzma: filter is closed")
+
+// converter converts the branch addresses of the instructions in buf, which
+// follows the data converted before. It returns the number of the processed
+// bytes, the rest is given again with the following data. The bytes left at
+// the end of the stream are not converted.
+type converter interface {
+	convert(buf []byte, encoding bool) int
+}
+
+// filterReader decodes the data read from inStream by the converter.
+type filterReader struct {
+	inStream io.Reader
+	conv     converter
+
+	// buf[start:converted] is decoded, buf[converted:end] waits for more
+	// data.
+	buf       []byte
+	start     int
+	converted int
+	end       int
+	err       error
+}
+
+func newFilterReader(inStream io.Reader, conv converter) *filterReader {
+	return &filterReader{
+		inStream: inStream,
+		conv:     conv,
+		buf:      make([]byte, filterBufSize),
+	}
+}
+
+func (r *filterReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	for r.start == r.converted {
+		if r.err != nil {
+			if r.converted == r.end {
+				return 0, r.err
+			}
+
+			r.converted = r.end
+
+			break
+		}
+
+		r.end = copy(r.buf, r.buf[r.converted:r.end])
+		r.start, r.converted = 0, 0
+
+		n, err := r.inStream.Read(r.buf[r.end:])
+		r.end += n
+		r.err = err
+
+		r.converted = r.conv.convert(r.buf[:r.end], false)
+	}
+
+	n := copy(p, r.buf[r.start:r.converted])
+	r.start += n
+
+	return n, nil
+}
+
+// filterWriter encodes the data by the converter and writes it to
+// outStream.
+type filterWriter struct {
+	outStream io.Writer
+	conv      converter
+
+	buf    []byte
+	n      int
+	closed bool
+}
+
+func newFilterWriter(outStream io.Writer, conv converter) *filterWriter {
+	return &filterWriter{
+		outStream: outStream,
+		conv:      conv,
+		buf:       make([]byte, filterBufSize),
+	}
+}
+
+func (w *filterWriter) Write(p []byte) (n int, err error) {
+	if w.closed {
+		return 0, errFilterClosed
+	}
+
+	for len(p) > 0 {
+		k := copy(w.buf[w.n:], p)
+		w.n += k
+		n += k
+		p = p[k:]
+
+		if w.n < len(w.buf) {
+			break
+		}
+
+		converted := w.conv.convert(w.buf[:w.n], true)
+
+		_, err = w.outStream.Write(w.buf[:converted])
+		if err != nil {
+			return n, err
+		}
+
+		w.n = copy(w.buf, w.buf[converted:w.n])
+	}
+
+	return n, nil
+}
+
+// Close converts and writes the buffered data, the last bytes which cannot
+// hold an instruction stay as is. It does not close the underlying writer.
+func (w *filterWriter) Close() error {
+	if w.closed {
+		return errFilterClosed
+	}
+
+	w.closed = true
+
+	w.conv.convert(w.buf[:w.n], true)
+
+	_, err := w.outStream.Write(w.buf[:w.n])
+
+	return err
+}
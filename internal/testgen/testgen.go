@@ -0,0 +1,26 @@
+// Package testgen generates the compressible data for the tests of the
+// packages.
+package testgen
+
+import (
+	"bytes"
+	"math/rand"
+)
+
+// Text returns size bytes of words mixed with random bytes, the seed selects
+// the sequence.
+func Text(size int, seed int64) []byte {
+	rnd := rand.New(rand.NewSource(seed))
+	words := []string{"LZMA ", "Decoder ", "TEST ", "block ", "index\n", "=====\n"}
+
+	var b bytes.Buffer
+	for b.Len() < size {
+		if rnd.Intn(8) == 0 {
+			b.WriteByte(byte(rnd.Intn(256)))
+		} else {
+			b.WriteString(words[rnd.Intn(len(words))])
+		}
+	}
+
+	return b.Bytes()[:size]
+}
@@ -0,0 +1,29 @@
+package lzip
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrFormat             = errors.New("lzip: file format not recognized")
+	ErrCorrupted          = errors.New("lzip: corrupted")
+	ErrUnsupportedVersion = errors.New("lzip: unsupported version")
+)
+
+// MemberError reports the member which failed to decompress.
+type MemberError struct {
+	// Member is the index of the member, Offset is its offset in the input.
+	Member int
+	Offset int64
+
+	Err error
+}
+
+func (e *MemberError) Error() string {
+	return fmt.Sprintf("lzip: member %d at offset %d: %v", e.Member, e.Offset, e.Err)
+}
+
+func (e *MemberError) Unwrap() error {
+	return e.Err
+}
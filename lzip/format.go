@@ -0,0 +1,110 @@
+package lzip
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+const (
+	headerMagic = "LZIP"
+	version     = 1
+
+	headerLen  = 6
+	trailerLen = 20
+
+	// lzip allows dictionary sizes from 4 KiB to 512 MiB.
+	dictSizeMin = 1 << 12
+	dictSizeMax = 1 << 29
+
+	// memberSizeMax is 2 PiB, lzip refuses larger members.
+	memberSizeMax = 1 << 51
+)
+
+// decodeDictSize decodes the dictionary size byte of the header: bits 4-0 are
+// the base 2 logarithm of the base size and bits 7-5 are the number of
+// sixteenths of the base size to subtract.
+func decodeDictSize(b byte) (uint32, error) {
+	base := uint32(1) << (b & 0x1F)
+	size := base - base/16*uint32(b>>5)
+
+	if base < dictSizeMin || base > dictSizeMax || size < dictSizeMin {
+		return 0, ErrCorrupted
+	}
+
+	return size, nil
+}
+
+// encodeDictSize returns the dictionary size byte of the smallest size not
+// less than dictSize.
+func encodeDictSize(dictSize uint32) byte {
+	b := byte(12)
+	for uint32(1)<<b < dictSize && b < 29 {
+		b++
+	}
+
+	base := uint32(1) << b
+	frac := byte(0)
+
+	for frac < 7 && base-base/16*uint32(frac+1) >= dictSize {
+		frac++
+	}
+
+	return frac<<5 | b
+}
+
+// header holds the fields of the member header.
+type header struct {
+	dictSize uint32
+}
+
+func readHeader(inStream io.Reader) (header, error) {
+	var (
+		buf [headerLen]byte
+		h   header
+	)
+
+	_, err := io.ReadFull(inStream, buf[:])
+	if err != nil {
+		return h, err
+	}
+
+	if string(buf[:4]) != headerMagic {
+		return h, ErrFormat
+	}
+
+	if buf[4] != version {
+		return h, ErrUnsupportedVersion
+	}
+
+	h.dictSize, err = decodeDictSize(buf[5])
+
+	return h, err
+}
+
+func appendHeader(buf []byte, h header) []byte {
+	buf = append(buf, headerMagic...)
+
+	return append(buf, version, encodeDictSize(h.dictSize))
+}
+
+// trailer holds the fields of the member trailer.
+type trailer struct {
+	crc        uint32
+	dataSize   uint64
+	memberSize uint64
+}
+
+func parseTrailer(buf []byte) trailer {
+	return trailer{
+		crc:        binary.LittleEndian.Uint32(buf[0:4]),
+		dataSize:   binary.LittleEndian.Uint64(buf[4:12]),
+		memberSize: binary.LittleEndian.Uint64(buf[12:20]),
+	}
+}
+
+func appendTrailer(buf []byte, t trailer) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, t.crc)
+	buf = binary.LittleEndian.AppendUint64(buf, t.dataSize)
+
+	return binary.LittleEndian.AppendUint64(buf, t.memberSize)
+}
@@ -0,0 +1,204 @@
+package lzip
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/kulaginds/lzma"
+)
+
+// Reader decompresses .lz files. All members are decoded one after another,
+// the trailing data after the last member is ignored as lzip does. Errors of
+// the members are reported as *MemberError.
+type Reader struct {
+	inStream *bufio.Reader
+	counter  *countingReader
+
+	member   int
+	start    int64
+	lzma     *lzma.Reader1
+	decoder  *lzma.Reader1
+	crc      hash.Hash32
+	dataSize uint64
+
+	isEndOfStream bool
+}
+
+// NewReader reads the header of the first member and creates the reader.
+func NewReader(inStream io.Reader) (*Reader, error) {
+	counter := &countingReader{r: inStream}
+
+	r := &Reader{
+		inStream: bufio.NewReader(counter),
+		counter:  counter,
+		member:   -1,
+		crc:      crc32.NewIEEE(),
+	}
+
+	err := r.nextMember()
+	if errors.Is(err, io.EOF) {
+		return nil, ErrFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func init() {
+	lzma.RegisterFormat(lzma.FormatLzip, headerMagic, func(inStream io.Reader) (io.Reader, error) {
+		return NewReader(inStream)
+	})
+}
+
+// offset returns the number of bytes consumed from the input.
+func (r *Reader) offset() int64 {
+	return r.counter.n - int64(r.inStream.Buffered())
+}
+
+func (r *Reader) Read(p []byte) (n int, err error) {
+	for {
+		if r.lzma == nil {
+			if r.isEndOfStream {
+				return 0, io.EOF
+			}
+
+			err = r.nextMember()
+			if errors.Is(err, io.EOF) {
+				r.isEndOfStream = true
+
+				return 0, io.EOF
+			}
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		n, err = r.lzma.Read(p)
+		_, _ = r.crc.Write(p[:n])
+		r.dataSize += uint64(n)
+
+		if errors.Is(err, io.EOF) {
+			err = r.closeMember()
+			if err != nil {
+				return n, err
+			}
+
+			if n == 0 {
+				continue
+			}
+		}
+
+		if err != nil {
+			return n, r.memberError(err)
+		}
+
+		return n, nil
+	}
+}
+
+// nextMember reads the header of the next member. It returns io.EOF at the end
+// of input or at the trailing data.
+func (r *Reader) nextMember() error {
+	r.member++
+	r.start = r.offset()
+
+	buf, err := r.inStream.Peek(len(headerMagic))
+	if string(buf) != headerMagic {
+		if len(buf) > 0 || errors.Is(err, io.EOF) {
+			return io.EOF
+		}
+
+		return r.memberError(err)
+	}
+
+	h, err := readHeader(r.inStream)
+	if err != nil {
+		return r.memberError(unexpectedEOF(err))
+	}
+
+	// The decoder of the first member is reset for the next ones, so they
+	// reuse its window and probabilities.
+	props := lzma.Properties{LC: 3, LP: 0, PB: 2, DictSize: h.dictSize}
+
+	if r.decoder == nil {
+		r.decoder, err = lzma.NewRawReader1(r.inStream, props, lzma.UnpackSizeUnknown, lzma.EndMarkerRequired)
+	} else {
+		err = r.decoder.ResetRaw(r.inStream, props, lzma.UnpackSizeUnknown)
+	}
+
+	if err != nil {
+		return r.memberError(unexpectedEOF(err))
+	}
+
+	r.lzma = r.decoder
+
+	r.crc.Reset()
+	r.dataSize = 0
+
+	return nil
+}
+
+// closeMember verifies the trailer of the member.
+func (r *Reader) closeMember() error {
+	r.lzma = nil
+
+	var buf [trailerLen]byte
+
+	_, err := io.ReadFull(r.inStream, buf[:])
+	if err != nil {
+		return r.memberError(unexpectedEOF(err))
+	}
+
+	t := parseTrailer(buf[:])
+
+	switch {
+	case t.memberSize > memberSizeMax:
+		err = fmt.Errorf("%w: member size too large", ErrCorrupted)
+	case t.crc != r.crc.Sum32():
+		err = fmt.Errorf("%w: CRC mismatch", ErrCorrupted)
+	case t.dataSize != r.dataSize:
+		err = fmt.Errorf("%w: data size mismatch", ErrCorrupted)
+	case t.memberSize != uint64(r.offset()-r.start):
+		err = fmt.Errorf("%w: member size mismatch", ErrCorrupted)
+	}
+
+	if err != nil {
+		return r.memberError(err)
+	}
+
+	return nil
+}
+
+func (r *Reader) memberError(err error) error {
+	return &MemberError{
+		Member: r.member,
+		Offset: r.start,
+		Err:    err,
+	}
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+
+	return n, err
+}
@@ -0,0 +1,183 @@
+package lzip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kulaginds/lzma"
+)
+
+func TestReader(t *testing.T) {
+	r := require.New(t)
+
+	expected, err := os.ReadFile("../testassets/a.txt")
+	r.NoError(err)
+	multimember := append(append([]byte{}, expected...), bytes.Repeat(func() []byte {
+		b := make([]byte, 256)
+		for i := range b {
+			b[i] = byte(i)
+		}
+
+		return b
+	}(), 40)...)
+
+	testCases := []struct {
+		name string
+
+		inputFile string
+		expected  []byte
+		member    int
+
+		checkErr1 func(err error, msgAndArgs ...interface{})
+		checkErr2 func(err error, msgAndArgs ...interface{})
+	}{
+		{
+			name:      "one_member",
+			inputFile: "testassets/a.lz",
+			expected:  expected,
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "multiple_members",
+			inputFile: "testassets/a_multimember.lz",
+			expected:  multimember,
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "trailing_data",
+			inputFile: "testassets/a_trailing.lz",
+			expected:  expected,
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "bad_crc",
+			inputFile: "testassets/bad_crc.lz",
+			checkErr1: r.NoError,
+			checkErr2: r.Error,
+		},
+		{
+			name:      "bad_data_size",
+			inputFile: "testassets/bad_data_size.lz",
+			checkErr1: r.NoError,
+			checkErr2: r.Error,
+		},
+		{
+			name:      "bad_member_size",
+			inputFile: "testassets/bad_member_size.lz",
+			checkErr1: r.NoError,
+			checkErr2: r.Error,
+		},
+		{
+			name:      "bad_truncated",
+			inputFile: "testassets/bad_truncated.lz",
+			checkErr1: r.NoError,
+			checkErr2: r.Error,
+		},
+		{
+			name:      "bad_second_member",
+			inputFile: "testassets/bad_second_member.lz",
+			member:    1,
+			checkErr1: r.NoError,
+			checkErr2: r.Error,
+		},
+		{
+			name:      "not_lzip",
+			inputFile: "../testassets/a.lzma",
+			checkErr1: r.Error,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			input, err := os.Open(tc.inputFile)
+			r.NoError(err)
+			defer input.Close()
+
+			reader, err := NewReader(input)
+			tc.checkErr1(err)
+			if err != nil {
+				return
+			}
+
+			actual, err := io.ReadAll(reader)
+			tc.checkErr2(err)
+			if err != nil {
+				var memberErr *MemberError
+				r.ErrorAs(err, &memberErr)
+				r.Equal(tc.member, memberErr.Member)
+
+				return
+			}
+
+			r.Equal(tc.expected, actual)
+		})
+	}
+}
+
+func TestReaderMemberSizeMax(t *testing.T) {
+	r := require.New(t)
+
+	data, err := os.ReadFile("testassets/a.lz")
+	r.NoError(err)
+
+	binary.LittleEndian.PutUint64(data[len(data)-8:], memberSizeMax+1)
+
+	reader, err := NewReader(bytes.NewReader(data))
+	r.NoError(err)
+
+	_, err = io.ReadAll(reader)
+	r.ErrorIs(err, ErrCorrupted)
+	r.ErrorContains(err, "member size too large")
+}
+
+func TestDecodeDictSize(t *testing.T) {
+	r := require.New(t)
+
+	testCases := []struct {
+		b        byte
+		dictSize uint32
+	}{
+		{b: 12, dictSize: 1 << 12},
+		{b: 0xD3, dictSize: 5 << 16},
+		{b: 29, dictSize: 1 << 29},
+		{b: 0xFD, dictSize: 1<<29 - 7<<25},
+	}
+
+	for _, tc := range testCases {
+		dictSize, err := decodeDictSize(tc.b)
+		r.NoError(err)
+		r.Equal(tc.dictSize, dictSize)
+	}
+
+	for _, b := range []byte{11, 30, 0x2C} {
+		_, err := decodeDictSize(b)
+		r.Error(err)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	r := require.New(t)
+
+	input, err := os.Open("testassets/a.lz")
+	r.NoError(err)
+	defer input.Close()
+
+	reader, format, err := lzma.NewReader(input)
+	r.NoError(err)
+	r.Equal(lzma.FormatLzip, format)
+
+	actual, err := io.ReadAll(reader)
+	r.NoError(err)
+
+	expected, err := os.ReadFile("../testassets/a.txt")
+	r.NoError(err)
+	r.Equal(expected, actual)
+}
@@ -0,0 +1,205 @@
+package lzip
+
+import (
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/kulaginds/lzma"
+)
+
+// WriterConfig holds the options of Writer.
+type WriterConfig struct {
+	// DictSize is the dictionary size from 4 KiB to 512 MiB, zero selects
+	// lzma.DefaultDictSize. It is rounded up to the size representable in
+	// the header.
+	DictSize int
+	// MemberSize is the maximum uncompressed size of a member, zero writes
+	// all data in one member.
+	MemberSize int64
+}
+
+// DefaultWriterConfig returns the configuration of lzip utility: 8 MiB
+// dictionary and single member.
+func DefaultWriterConfig() WriterConfig {
+	return WriterConfig{
+		DictSize: lzma.DefaultDictSize,
+	}
+}
+
+var (
+	errWriterClosed       = errors.New("lzip: writer is closed")
+	errNegativeMemberSize = errors.New("lzip: negative member size")
+	errDictOutOfRange     = errors.New("lzip: dictionary size is out of range")
+)
+
+// Writer compresses data to .lz file.
+type Writer struct {
+	outStream *countingWriter
+	cfg       WriterConfig
+	dictSize  uint32
+
+	lzma     *lzma.Writer1
+	crc      hash.Hash32
+	start    int64
+	dataSize uint64
+	inMember bool
+
+	buf    []byte
+	closed bool
+}
+
+// NewWriter creates writer with DefaultWriterConfig.
+func NewWriter(outStream io.Writer) (*Writer, error) {
+	return NewWriterConfig(outStream, DefaultWriterConfig())
+}
+
+// NewWriterConfig creates the writer, the header of the first member is
+// written by the first Write or Close.
+func NewWriterConfig(outStream io.Writer, cfg WriterConfig) (*Writer, error) {
+	if cfg.MemberSize < 0 {
+		return nil, errNegativeMemberSize
+	}
+
+	if cfg.DictSize == 0 {
+		cfg.DictSize = lzma.DefaultDictSize
+	}
+
+	if cfg.DictSize < dictSizeMin || cfg.DictSize > dictSizeMax {
+		return nil, errDictOutOfRange
+	}
+
+	dictSize, err := decodeDictSize(encodeDictSize(uint32(cfg.DictSize)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		outStream: &countingWriter{w: outStream},
+		cfg:       cfg,
+		dictSize:  dictSize,
+		crc:       crc32.NewIEEE(),
+	}, nil
+}
+
+func (w *Writer) Write(p []byte) (n int, err error) {
+	if w.closed {
+		return 0, errWriterClosed
+	}
+
+	for len(p) > 0 {
+		if !w.inMember {
+			err = w.startMember()
+			if err != nil {
+				return n, err
+			}
+		}
+
+		k := len(p)
+		if w.cfg.MemberSize > 0 && uint64(k) > uint64(w.cfg.MemberSize)-w.dataSize {
+			k = int(uint64(w.cfg.MemberSize) - w.dataSize)
+		}
+
+		k, err = w.lzma.Write(p[:k])
+		_, _ = w.crc.Write(p[:k])
+		w.dataSize += uint64(k)
+		n += k
+		p = p[k:]
+
+		if err != nil {
+			return n, err
+		}
+
+		if w.cfg.MemberSize > 0 && w.dataSize == uint64(w.cfg.MemberSize) {
+			err = w.finishMember()
+			if err != nil {
+				return n, err
+			}
+		}
+	}
+
+	return n, nil
+}
+
+func (w *Writer) startMember() error {
+	w.start = w.outStream.n
+	w.buf = appendHeader(w.buf[:0], header{dictSize: w.dictSize})
+
+	_, err := w.outStream.Write(w.buf)
+	if err != nil {
+		return err
+	}
+
+	if w.lzma == nil {
+		props := lzma.Properties{LC: 3, LP: 0, PB: 2, DictSize: w.dictSize}
+
+		w.lzma, err = lzma.NewRawWriter1(w.outStream, props, true)
+		if err != nil {
+			return err
+		}
+	} else {
+		w.lzma.Reset(w.outStream)
+	}
+
+	w.crc.Reset()
+	w.dataSize = 0
+	w.inMember = true
+
+	return nil
+}
+
+// finishMember writes the end marker and the trailer.
+func (w *Writer) finishMember() error {
+	w.inMember = false
+
+	err := w.lzma.Close()
+	if err != nil {
+		return err
+	}
+
+	w.buf = appendTrailer(w.buf[:0], trailer{
+		crc:        w.crc.Sum32(),
+		dataSize:   w.dataSize,
+		memberSize: uint64(w.outStream.n-w.start) + trailerLen,
+	})
+
+	_, err = w.outStream.Write(w.buf)
+
+	return err
+}
+
+// Close finishes the last member, empty input is written as a member with
+// no data. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return errWriterClosed
+	}
+
+	w.closed = true
+
+	if !w.inMember && w.outStream.n == 0 {
+		err := w.startMember()
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.inMember {
+		return w.finishMember()
+	}
+
+	return nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
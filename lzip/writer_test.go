@@ -0,0 +1,132 @@
+package lzip
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kulaginds/lzma/internal/testgen"
+)
+
+// members returns the trailers of the members of the file.
+func members(t *testing.T, compressed []byte) []trailer {
+	t.Helper()
+
+	var trailers []trailer
+
+	for end := len(compressed); end > 0; {
+		tr := parseTrailer(compressed[end-trailerLen : end])
+		require.LessOrEqual(t, tr.memberSize, uint64(end))
+
+		end -= int(tr.memberSize)
+		require.Equal(t, headerMagic, string(compressed[end:end+4]))
+
+		trailers = append([]trailer{tr}, trailers...)
+	}
+
+	return trailers
+}
+
+func TestWriter(t *testing.T) {
+	data := testgen.Text(100000, 1)
+
+	testCases := []struct {
+		name string
+
+		data    []byte
+		cfg     WriterConfig
+		members int
+	}{
+		{
+			name:    "empty",
+			data:    nil,
+			cfg:     DefaultWriterConfig(),
+			members: 1,
+		},
+		{
+			name:    "one_member",
+			data:    data,
+			cfg:     DefaultWriterConfig(),
+			members: 1,
+		},
+		{
+			name:    "small_dictionary",
+			data:    data,
+			cfg:     WriterConfig{DictSize: 5000},
+			members: 1,
+		},
+		{
+			name:    "members",
+			data:    data,
+			cfg:     WriterConfig{DictSize: 1 << 16, MemberSize: 25000},
+			members: 4,
+		},
+		{
+			name:    "members_with_tail",
+			data:    data,
+			cfg:     WriterConfig{DictSize: 1 << 16, MemberSize: 30000},
+			members: 4,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			var buf bytes.Buffer
+
+			w, err := NewWriterConfig(&buf, tc.cfg)
+			r.NoError(err)
+
+			// uneven writes cross the member boundaries
+			for p := tc.data; len(p) > 0; {
+				n := 7000
+				if n > len(p) {
+					n = len(p)
+				}
+
+				_, err = w.Write(p[:n])
+				r.NoError(err)
+				p = p[n:]
+			}
+
+			r.NoError(w.Close())
+
+			trailers := members(t, buf.Bytes())
+			r.Len(trailers, tc.members)
+
+			reader, err := NewReader(bytes.NewReader(buf.Bytes()))
+			r.NoError(err)
+
+			actual, err := io.ReadAll(reader)
+			r.NoError(err)
+			r.Equal(len(tc.data), len(actual))
+			r.True(bytes.Equal(tc.data, actual))
+		})
+	}
+}
+
+func TestWriterDictSize(t *testing.T) {
+	r := require.New(t)
+
+	for _, dictSize := range []uint32{1 << 12, 5000, 1 << 16, 100000, 7 << 20, 1 << 29} {
+		b := encodeDictSize(dictSize)
+
+		decoded, err := decodeDictSize(b)
+		r.NoError(err)
+		r.GreaterOrEqual(decoded, dictSize)
+
+		// the next smaller size is less than dictSize
+		if b>>5 < 7 && b&0x1F > 12 {
+			smaller, err := decodeDictSize(b + 1<<5)
+			if err == nil {
+				r.Less(smaller, dictSize)
+			}
+		}
+	}
+
+	_, err := NewWriterConfig(io.Discard, WriterConfig{DictSize: 1 << 30})
+	r.Error(err)
+}
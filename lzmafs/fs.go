@@ -0,0 +1,399 @@
+package lzmafs
+
+import (
+	"bufio"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kulaginds/lzma"
+	"github.com/kulaginds/lzma/xz"
+)
+
+// Extensions of the compressed files.
+const (
+	extXZ   = ".xz"
+	extLZMA = ".lzma"
+)
+
+// FS presents the .xz and .lzma files of the underlying file system
+// decompressed under the names without the extension, foo.json.xz is read as
+// foo.json. The compressed file keeps its name if the stripped name is taken
+// by another file. It implements fs.StatFS and fs.ReadDirFS.
+type FS struct {
+	fsys fs.FS
+}
+
+// New creates FS over fsys, for example embed.FS.
+func New(fsys fs.FS) *FS {
+	return &FS{fsys: fsys}
+}
+
+// compressedExt returns the extension of the compressed file name or "".
+func compressedExt(name string) string {
+	for _, ext := range []string{extXZ, extLZMA} {
+		if len(name) > len(ext) && strings.HasSuffix(name, ext) {
+			return ext
+		}
+	}
+
+	return ""
+}
+
+// exists reports whether the underlying file system has the file.
+func (f *FS) exists(name string) bool {
+	_, err := fs.Stat(f.fsys, name)
+
+	return err == nil
+}
+
+// hidden reports whether the underlying file is presented without the
+// extension.
+func (f *FS) hidden(name string) bool {
+	ext := compressedExt(name)
+	if ext == "" {
+		return false
+	}
+
+	compressed, ok := f.lookup(strings.TrimSuffix(name, ext))
+
+	return ok && compressed == name
+}
+
+// lookup returns the name of the compressed file presented under name: the
+// name is not taken and the regular file with .xz or, if there is none,
+// .lzma extension exists.
+func (f *FS) lookup(name string) (string, bool) {
+	if f.exists(name) {
+		return "", false
+	}
+
+	for _, ext := range []string{extXZ, extLZMA} {
+		info, err := fs.Stat(f.fsys, name+ext)
+		if err == nil && info.Mode().IsRegular() {
+			return name + ext, true
+		}
+	}
+
+	return "", false
+}
+
+// Open opens the named file using the semantics of fs.FS.
+func (f *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if compressed, ok := f.lookup(name); ok {
+		return f.openCompressed(name, compressed)
+	}
+
+	if f.hidden(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	file, err := f.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return &openDir{File: file, fsys: f, name: name}, nil
+	}
+
+	return file, nil
+}
+
+func (f *FS) openCompressed(name, compressed string) (fs.File, error) {
+	file, err := f.fsys.Open(compressed)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+
+		return nil, err
+	}
+
+	r, size, err := newDecoder(file, info, compressedExt(compressed))
+	if err != nil {
+		_ = file.Close()
+
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	e := &entry{
+		fsys:       f,
+		name:       path.Base(name),
+		compressed: compressed,
+		info:       info,
+		size:       size,
+	}
+
+	of := &openFile{e: e, file: file, r: r}
+
+	if rs, ok := r.(readSeekerAt); ok {
+		return &openSeekFile{openFile: of, rs: rs}, nil
+	}
+
+	return of, nil
+}
+
+// sizeUnknown marks the uncompressed size not stored in the header.
+const sizeUnknown = -1
+
+// newDecoder creates the decoder of the compressed file and returns the
+// uncompressed size if it is known without decoding. The .xz file with
+// io.ReaderAt is read by xz.ReaderAt, which supports ReadAt and Seek.
+func newDecoder(file fs.File, info fs.FileInfo, ext string) (io.Reader, int64, error) {
+	if ext == extXZ {
+		if ra, ok := file.(io.ReaderAt); ok {
+			r, err := xz.NewReaderAt(ra, info.Size())
+			if err != nil {
+				return nil, 0, err
+			}
+
+			return r, r.Size(), nil
+		}
+
+		r, err := xz.NewReader(file)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return r, sizeUnknown, nil
+	}
+
+	br := bufio.NewReader(file)
+
+	size := int64(sizeUnknown)
+	if header, err := br.Peek(lzma.LZMAHeaderLen); err == nil {
+		if unpackSize := lzma.DecodeUnpackSize(header[lzma.LZMAPropsLen:]); unpackSize < 1<<63 {
+			size = int64(unpackSize)
+		}
+	}
+
+	r, err := lzma.NewReader1(br)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return r, size, nil
+}
+
+// uncompressedSize returns the size of the compressed file, it decodes the
+// whole file if the size is not stored in it.
+func (f *FS) uncompressedSize(compressed string) (int64, error) {
+	file, err := f.fsys.Open(compressed)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	r, size, err := newDecoder(file, info, compressedExt(compressed))
+	if err != nil {
+		return 0, err
+	}
+
+	if size == sizeUnknown {
+		size, err = io.Copy(io.Discard, r)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return size, nil
+}
+
+// Stat returns the info of the named file, the size of the compressed file
+// is its uncompressed size.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if compressed, ok := f.lookup(name); ok {
+		info, err := fs.Stat(f.fsys, compressed)
+		if err != nil {
+			return nil, err
+		}
+
+		e := &entry{fsys: f, name: path.Base(name), compressed: compressed, info: info, size: sizeUnknown}
+
+		return e, e.loadSize()
+	}
+
+	if f.hidden(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return fs.Stat(f.fsys, name)
+}
+
+// ReadDir reads the named directory, the compressed files are listed under
+// the stripped names.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	list, err := fs.ReadDir(f.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]fs.DirEntry, 0, len(list))
+
+	for _, d := range list {
+		if !f.hidden(path.Join(name, d.Name())) {
+			entries = append(entries, d)
+
+			continue
+		}
+
+		ext := compressedExt(d.Name())
+
+		info, err := d.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, &entry{
+			fsys:       f,
+			name:       strings.TrimSuffix(d.Name(), ext),
+			compressed: path.Join(name, d.Name()),
+			info:       info,
+			size:       sizeUnknown,
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
+
+// entry is fs.FileInfo and fs.DirEntry of the compressed file, its size is
+// loaded on demand.
+type entry struct {
+	fsys       *FS
+	name       string
+	compressed string
+	info       fs.FileInfo
+	size       int64
+}
+
+func (e *entry) Name() string               { return e.name }
+func (e *entry) Size() int64                { return e.size }
+func (e *entry) Mode() fs.FileMode          { return e.info.Mode() }
+func (e *entry) ModTime() time.Time         { return e.info.ModTime() }
+func (e *entry) IsDir() bool                { return false }
+func (e *entry) Sys() any                   { return nil }
+func (e *entry) Type() fs.FileMode          { return e.info.Mode().Type() }
+func (e *entry) String() string             { return fs.FormatFileInfo(e) }
+func (e *entry) Info() (fs.FileInfo, error) { return e, e.loadSize() }
+
+func (e *entry) loadSize() error {
+	if e.size != sizeUnknown {
+		return nil
+	}
+
+	size, err := e.fsys.uncompressedSize(e.compressed)
+	if err != nil {
+		return &fs.PathError{Op: "stat", Path: e.compressed, Err: err}
+	}
+
+	e.size = size
+
+	return nil
+}
+
+// openFile is the compressed file opened for reading.
+type openFile struct {
+	e    *entry
+	file fs.File
+	r    io.Reader
+}
+
+func (f *openFile) Stat() (fs.FileInfo, error) { return f.e, f.e.loadSize() }
+func (f *openFile) Read(p []byte) (int, error) { return f.r.Read(p) }
+func (f *openFile) Close() error               { return f.file.Close() }
+
+type readSeekerAt interface {
+	io.ReaderAt
+	io.Seeker
+}
+
+// openSeekFile is the compressed file whose decoder supports ReadAt and
+// Seek.
+type openSeekFile struct {
+	*openFile
+
+	rs readSeekerAt
+}
+
+func (f *openSeekFile) ReadAt(p []byte, off int64) (int, error) {
+	return f.rs.ReadAt(p, off)
+}
+
+func (f *openSeekFile) Seek(offset int64, whence int) (int64, error) {
+	return f.rs.Seek(offset, whence)
+}
+
+// openDir lists the directory with the stripped names.
+type openDir struct {
+	fs.File
+
+	fsys    *FS
+	name    string
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *openDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.fsys.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+
+		d.entries = entries
+		d.read = true
+	}
+
+	n := len(d.entries)
+	if count > 0 && n > count {
+		n = count
+	}
+
+	if n == 0 {
+		if count > 0 {
+			return nil, io.EOF
+		}
+
+		return []fs.DirEntry{}, nil
+	}
+
+	list := d.entries[:n:n]
+	d.entries = d.entries[n:]
+
+	return list, nil
+}
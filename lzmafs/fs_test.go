@@ -0,0 +1,148 @@
+package lzmafs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kulaginds/lzma/xz"
+)
+
+func readFile(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+
+	return data
+}
+
+func testFS(t *testing.T) fstest.MapFS {
+	return fstest.MapFS{
+		"a.txt.xz":           {Data: readFile(t, "../xz/testassets/a.xz"), Mode: 0o644},
+		"dir/a.bin.lzma":     {Data: readFile(t, "../testassets/a.lzma"), Mode: 0o644},
+		"dir/a_eos.bin.lzma": {Data: readFile(t, "../testassets/a_eos.lzma"), Mode: 0o644},
+		"dir/blocks.xz":      {Data: readFile(t, "../xz/testassets/a_multiblock.xz"), Mode: 0o644},
+		"dup.xz":             {Data: readFile(t, "../xz/testassets/a_crc32.xz"), Mode: 0o644},
+		"dup.lzma":           {Data: readFile(t, "../testassets/a.lzma"), Mode: 0o644},
+		"plain.txt":          {Data: []byte("plain text"), Mode: 0o644},
+		"plain.txt.xz":       {Data: readFile(t, "../xz/testassets/a.xz"), Mode: 0o644},
+		"data.xz/x.lzma":     {Data: readFile(t, "../testassets/a_eos.lzma"), Mode: 0o644},
+		".xz":                {Data: []byte("not compressed"), Mode: 0o644},
+	}
+}
+
+var presentedFiles = []string{
+	"a.txt",
+	"dir/a.bin",
+	"dir/a_eos.bin",
+	"dir/blocks",
+	"dup",
+	"dup.lzma",
+	"plain.txt",
+	"plain.txt.xz",
+	"data.xz/x",
+	".xz",
+}
+
+func TestFS(t *testing.T) {
+	r := require.New(t)
+
+	fsys := New(testFS(t))
+	r.NoError(fstest.TestFS(fsys, presentedFiles...))
+
+	expected, err := os.ReadFile("../testassets/a.txt")
+	r.NoError(err)
+
+	for _, name := range []string{"a.txt", "dir/a.bin", "dir/a_eos.bin", "dup", "data.xz/x"} {
+		data, err := fs.ReadFile(fsys, name)
+		r.NoError(err, name)
+		r.Equal(expected, data, name)
+
+		info, err := fs.Stat(fsys, name)
+		r.NoError(err, name)
+		r.Equal(int64(len(expected)), info.Size(), name)
+		r.True(info.Mode().IsRegular(), name)
+	}
+
+	data, err := fs.ReadFile(fsys, "plain.txt")
+	r.NoError(err)
+	r.Equal("plain text", string(data))
+
+	data, err = fs.ReadFile(fsys, "plain.txt.xz")
+	r.NoError(err)
+	r.Equal(readFile(t, "../xz/testassets/a.xz"), data)
+
+	for _, name := range []string{"a.txt.xz", "dir/a.bin.lzma", "dup.xz", "data.xz/x.lzma", "missing"} {
+		_, err = fsys.Open(name)
+		r.ErrorIs(err, fs.ErrNotExist, name)
+
+		_, err = fs.Stat(fsys, name)
+		r.ErrorIs(err, fs.ErrNotExist, name)
+	}
+
+	entries, err := fs.ReadDir(fsys, "dir")
+	r.NoError(err)
+
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+
+	r.Equal([]string{"a.bin", "a_eos.bin", "blocks"}, names)
+}
+
+// noReaderAtFS hides ReadAt and Seek of the files.
+type noReaderAtFS struct {
+	fs.FS
+}
+
+func (f noReaderAtFS) Open(name string) (fs.File, error) {
+	file, err := f.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := file.(fs.ReadDirFile); ok {
+		return file, nil
+	}
+
+	return struct{ fs.File }{file}, nil
+}
+
+func TestFSWithoutReaderAt(t *testing.T) {
+	r := require.New(t)
+
+	fsys := New(noReaderAtFS{testFS(t)})
+	r.NoError(fstest.TestFS(fsys, presentedFiles...))
+
+	expected, err := os.ReadFile("../testassets/a.txt")
+	r.NoError(err)
+
+	info, err := fs.Stat(fsys, "dir/blocks")
+	r.NoError(err)
+	r.Equal(int64(len(expected)), info.Size())
+
+	file, err := fsys.Open("a.txt")
+	r.NoError(err)
+	defer file.Close()
+
+	_, ok := file.(io.Seeker)
+	r.False(ok)
+}
+
+func TestFSCorrupted(t *testing.T) {
+	fsys := New(fstest.MapFS{
+		"bad.xz": {Data: []byte("not xz"), Mode: 0o644},
+	})
+
+	_, err := fsys.Open("bad")
+	require.ErrorIs(t, err, xz.ErrCorrupted)
+
+	_, err = fs.Stat(fsys, "bad")
+	require.Error(t, err)
+}
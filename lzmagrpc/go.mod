@@ -0,0 +1,23 @@
+module github.com/kulaginds/lzma/lzmagrpc
+
+go 1.23.0
+
+require (
+	github.com/kulaginds/lzma v0.0.0-20261019183529-3b8215589664
+	github.com/stretchr/testify v1.10.0
+	google.golang.org/grpc v1.75.1
+	google.golang.org/protobuf v1.36.6
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/net v0.41.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+	golang.org/x/text v0.26.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250707201910-8d1bb00bc6a7 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+// The root module is taken from the working tree for local development.
+replace github.com/kulaginds/lzma => ../
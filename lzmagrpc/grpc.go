@@ -0,0 +1,148 @@
+// Package lzmagrpc registers LZMA2 compressor of gRPC messages under the
+// name "lzma2". Import it for the side effect and select it by
+// grpc.UseCompressor(lzmagrpc.Name) on the client, the server answers with
+// the compressor of the request.
+//
+// The message is compressed to raw LZMA2 stream without the dictionary size,
+// so the peers must be built with this package to decode it: the decoder uses
+// DictSize, which is not less than the dictionary of the encoder.
+package lzmagrpc
+
+import (
+	"io"
+	"sync"
+
+	"google.golang.org/grpc/encoding"
+
+	"github.com/kulaginds/lzma"
+)
+
+// Name is the name of the compressor in grpc-encoding header.
+const Name = "lzma2"
+
+// DictSize is the dictionary size of the encoder and the decoder, it covers
+// the message of the default gRPC size limit of 4 MiB.
+const DictSize = 4 << 20
+
+func init() {
+	encoding.RegisterCompressor(&compressor{})
+}
+
+type compressor struct {
+	poolCompressor   sync.Pool
+	poolDecompressor sync.Pool
+}
+
+// writer returns the encoder to the pool on Close.
+type writer struct {
+	*lzma.Writer2
+	pool *sync.Pool
+}
+
+func (c *compressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	z, inPool := c.poolCompressor.Get().(*writer)
+	if !inPool {
+		newZ, err := lzma.NewWriter2(w, DictSize)
+		if err != nil {
+			return nil, err
+		}
+
+		return &writer{Writer2: newZ, pool: &c.poolCompressor}, nil
+	}
+
+	z.Reset(w)
+
+	return z, nil
+}
+
+func (z *writer) Close() error {
+	defer z.pool.Put(z)
+
+	return z.Writer2.Close()
+}
+
+// reader returns the decoder to the pool on Close, gRPC calls it once the
+// message is read.
+type reader struct {
+	*lzma.Reader2
+	pool *sync.Pool
+}
+
+func (c *compressor) Decompress(r io.Reader) (io.Reader, error) {
+	z, inPool := c.poolDecompressor.Get().(*reader)
+	if !inPool {
+		newZ, err := lzma.NewReader2(r, DictSize)
+		if err != nil {
+			return nil, err
+		}
+
+		return &reader{Reader2: newZ, pool: &c.poolDecompressor}, nil
+	}
+
+	if err := z.Reset(r); err != nil {
+		c.poolDecompressor.Put(z)
+
+		return nil, err
+	}
+
+	return z, nil
+}
+
+func (z *reader) Close() error {
+	z.pool.Put(z)
+
+	return nil
+}
+
+// DecompressedSize returns the size of the decompressed message by the
+// chunk headers of LZMA2 stream, or -1 if the stream is malformed. gRPC
+// versions before 1.66 use it to check the message size limit before the
+// decompression.
+func (c *compressor) DecompressedSize(compressedBytes []byte) int {
+	size := 0
+
+	for len(compressedBytes) > 0 {
+		control := compressedBytes[0]
+
+		var headerLen, packed int
+
+		switch {
+		case control == 0x00:
+			return size
+		case control == 0x01 || control == 0x02:
+			if len(compressedBytes) < 3 {
+				return -1
+			}
+
+			headerLen = 3
+			packed = int(compressedBytes[1])<<8 | int(compressedBytes[2]) + 1
+			size += packed
+		case control >= 0x80:
+			headerLen = 5
+			if control >= 0xC0 {
+				headerLen = 6
+			}
+
+			if len(compressedBytes) < headerLen {
+				return -1
+			}
+
+			size += int(control&0x1F)<<16 | int(compressedBytes[1])<<8 | int(compressedBytes[2]) + 1
+			packed = int(compressedBytes[3])<<8 | int(compressedBytes[4]) + 1
+		default:
+			return -1
+		}
+
+		if len(compressedBytes) < headerLen+packed {
+			return -1
+		}
+
+		compressedBytes = compressedBytes[headerLen+packed:]
+	}
+
+	return -1
+}
+
+func (c *compressor) Name() string {
+	return Name
+}
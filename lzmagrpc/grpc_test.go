@@ -0,0 +1,209 @@
+package lzmagrpc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/kulaginds/lzma"
+)
+
+// compress returns the message compressed by the registered compressor.
+func compress(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	w, err := encoding.GetCompressor(Name).Compress(&buf)
+	require.NoError(t, err)
+
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	return buf.Bytes()
+}
+
+func decompress(t *testing.T, compressed []byte) ([]byte, error) {
+	t.Helper()
+
+	r, err := encoding.GetCompressor(Name).Decompress(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.(io.Closer).Close()
+
+	return io.ReadAll(r)
+}
+
+func TestCompressor(t *testing.T) {
+	r := require.New(t)
+
+	c := encoding.GetCompressor(Name)
+	r.NotNil(c)
+	r.Equal(Name, c.Name())
+
+	sizer, ok := c.(interface{ DecompressedSize([]byte) int })
+	r.True(ok)
+
+	messages := [][]byte{
+		nil,
+		[]byte("a"),
+		bytes.Repeat([]byte("repeated message "), 10000),
+		bytes.Repeat([]byte{0, 1, 2, 3, 4, 5, 6, 7}, 300000),
+	}
+
+	// The second round uses the pooled writers and readers.
+	for round := 0; round < 2; round++ {
+		for _, data := range messages {
+			compressed := compress(t, data)
+
+			actual, err := decompress(t, compressed)
+			r.NoError(err)
+			r.Equal(len(data), len(actual))
+			r.True(bytes.Equal(data, actual))
+
+			r.Equal(len(data), sizer.DecompressedSize(compressed))
+		}
+	}
+}
+
+func TestCompressorUncompressedChunks(t *testing.T) {
+	r := require.New(t)
+
+	// Random data is stored in uncompressed chunks.
+	data := make([]byte, 100000)
+	state := uint32(1)
+
+	for i := range data {
+		state = state*1664525 + 1013904223
+		data[i] = byte(state >> 24)
+	}
+
+	compressed := compress(t, data)
+
+	actual, err := decompress(t, compressed)
+	r.NoError(err)
+	r.Equal(data, actual)
+
+	r.Equal(len(data), encoding.GetCompressor(Name).(*compressor).DecompressedSize(compressed))
+}
+
+func TestCompressorCorrupted(t *testing.T) {
+	r := require.New(t)
+
+	c := encoding.GetCompressor(Name).(*compressor)
+	compressed := compress(t, bytes.Repeat([]byte("corrupted "), 1000))
+
+	r.Equal(-1, c.DecompressedSize([]byte{0x03}))
+
+	for _, input := range [][]byte{
+		nil,
+		compressed[:len(compressed)-1],
+		compressed[:3],
+	} {
+		r.Equal(-1, c.DecompressedSize(input))
+
+		_, err := decompress(t, input)
+		r.ErrorIs(err, io.ErrUnexpectedEOF)
+	}
+
+	actual, err := decompress(t, compressed)
+	r.NoError(err)
+	r.Equal(bytes.Repeat([]byte("corrupted "), 1000), actual)
+}
+
+func TestCompressorDictSize(t *testing.T) {
+	w, err := lzma.NewWriter2(io.Discard, DictSize)
+	require.NoError(t, err)
+	require.Equal(t, uint32(DictSize), w.DictSize())
+}
+
+// echoDesc describes the service which answers with the request.
+var echoDesc = grpc.ServiceDesc{
+	ServiceName: "lzmagrpc.test.Echo",
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Echo",
+		Handler: func(_ any, _ context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+			in := new(wrapperspb.BytesValue)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+
+			return in, nil
+		},
+	}},
+}
+
+// countingConn counts the bytes written by the client.
+type countingConn struct {
+	net.Conn
+	written *atomic.Int64
+}
+
+func (c countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.written.Add(int64(n))
+
+	return n, err
+}
+
+func TestBufconn(t *testing.T) {
+	r := require.New(t)
+
+	lis := bufconn.Listen(1 << 20)
+
+	server := grpc.NewServer()
+	server.RegisterService(&echoDesc, struct{}{})
+
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	defer server.Stop()
+
+	var written atomic.Int64
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			c, err := lis.DialContext(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			return countingConn{Conn: c, written: &written}, nil
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	r.NoError(err)
+	defer conn.Close()
+
+	for _, data := range [][]byte{
+		[]byte("small message"),
+		bytes.Repeat([]byte("large message "), 200000),
+	} {
+		in := wrapperspb.Bytes(data)
+		out := new(wrapperspb.BytesValue)
+
+		written.Store(0)
+
+		err = conn.Invoke(context.Background(), "/lzmagrpc.test.Echo/Echo", in, out, grpc.UseCompressor(Name))
+		r.NoError(err)
+		r.True(bytes.Equal(data, out.GetValue()))
+
+		if len(data) > 1<<20 {
+			r.Less(written.Load(), int64(len(data)/100))
+		}
+	}
+}
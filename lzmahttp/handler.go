@@ -0,0 +1,118 @@
+package lzmahttp
+
+import (
+	"io"
+	"net/http"
+)
+
+// NewHandler wraps the handler: it decodes the request body with
+// Content-Encoding xz or lzma and encodes the response body with the
+// encoding accepted by Accept-Encoding header. Reading the request body
+// beyond Config.MaxDecodedSize returns *http.MaxBytesError.
+func NewHandler(h http.Handler, cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if encoding := contentEncoding(r.Header); encoding != "" {
+			body, err := newDecoder(r.Body, encoding, cfg.maxDecodedSize())
+			if err != nil {
+				http.Error(w, "invalid "+encoding+" request body", http.StatusBadRequest)
+
+				return
+			}
+
+			r = r.Clone(r.Context())
+			r.Body = readCloser{Reader: body, Closer: r.Body}
+			r.ContentLength = -1
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := acceptEncoding(r.Header)
+		if encoding == "" {
+			h.ServeHTTP(w, r)
+
+			return
+		}
+
+		rw := &responseWriter{
+			ResponseWriter: w,
+			encoding:       encoding,
+			dictSize:       cfg.DictSize,
+			head:           r.Method == http.MethodHead,
+		}
+		defer rw.close()
+
+		h.ServeHTTP(rw, r)
+	})
+}
+
+// responseWriter encodes the response body unless the handler has set
+// Content-Encoding or the response has no body.
+type responseWriter struct {
+	http.ResponseWriter
+
+	encoding string
+	dictSize int
+	head     bool
+
+	enc         io.WriteCloser
+	err         error
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+
+	if code >= http.StatusContinue && code < http.StatusOK {
+		w.ResponseWriter.WriteHeader(code)
+
+		return
+	}
+
+	w.wroteHeader = true
+	h := w.Header()
+
+	if !w.head && code != http.StatusNoContent && code != http.StatusNotModified && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+
+		w.enc, w.err = newEncoder(w.ResponseWriter, w.encoding, w.dictSize)
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	if w.enc == nil {
+		return w.ResponseWriter.Write(p)
+	}
+
+	return w.enc.Write(p)
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close finishes the encoded body.
+func (w *responseWriter) close() {
+	if w.enc != nil {
+		_ = w.enc.Close()
+	}
+}
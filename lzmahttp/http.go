@@ -0,0 +1,206 @@
+package lzmahttp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kulaginds/lzma"
+	"github.com/kulaginds/lzma/xz"
+)
+
+// Content codings of xz and LZMA-alone formats.
+const (
+	EncodingXZ   = "xz"
+	EncodingLZMA = "lzma"
+)
+
+// DefaultMaxDecodedSize is the limit of the decoded body if Config has none.
+const DefaultMaxDecodedSize = 32 << 20
+
+// Config holds the options of Handler and Transport.
+type Config struct {
+	// MaxDecodedSize limits the size of the decoded body, zero selects
+	// DefaultMaxDecodedSize. Reading beyond it returns *http.MaxBytesError.
+	MaxDecodedSize int64
+	// DictSize is the dictionary size of the encoder, zero selects
+	// lzma.DefaultDictSize.
+	DictSize int
+	// RequestEncoding is EncodingXZ or EncodingLZMA to encode the request
+	// bodies sent by Transport, empty sends them as is.
+	RequestEncoding string
+}
+
+func (c Config) maxDecodedSize() int64 {
+	if c.MaxDecodedSize == 0 {
+		return DefaultMaxDecodedSize
+	}
+
+	return c.MaxDecodedSize
+}
+
+var errUnsupportedEncoding = errors.New("lzmahttp: unsupported content encoding")
+
+// newDecoder creates the decoder of the body with the content encoding, the
+// decoded data is limited to limit bytes.
+func newDecoder(body io.Reader, encoding string, limit int64) (io.Reader, error) {
+	var (
+		r   io.Reader
+		err error
+	)
+
+	switch encoding {
+	case EncodingXZ:
+		r, err = xz.NewReaderConfig(body, xz.ReaderConfig{WindowMax: windowMax(limit)})
+	case EncodingLZMA:
+		r, err = newLZMADecoder(body, limit)
+	default:
+		return nil, errUnsupportedEncoding
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &limitReader{r: r, n: limit, limit: limit}, nil
+}
+
+// newLZMADecoder reads .lzma header and creates the decoder whose window is
+// not larger than the limit of the decoded data, so the dictionary size of
+// the header does not allocate more.
+func newLZMADecoder(body io.Reader, limit int64) (io.Reader, error) {
+	var header [lzma.LZMAHeaderLen]byte
+
+	_, err := io.ReadFull(body, header[:])
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return nil, err
+	}
+
+	props, err := lzma.DecodeProperties(header[:lzma.LZMAPropsLen])
+	if err != nil {
+		return nil, err
+	}
+
+	if w := windowMax(limit); int64(props.DictSize) > int64(w) {
+		props.DictSize = uint32(w)
+	}
+
+	return lzma.NewRawReader1(bufio.NewReader(body), props, lzma.DecodeUnpackSize(header[lzma.LZMAPropsLen:]), lzma.EndMarkerOptional)
+}
+
+// windowMax returns the window size of the decoder which outputs up to limit
+// bytes and one more to detect the excess, the data within the limit never
+// refers farther.
+func windowMax(limit int64) int {
+	return int(min(limit, math.MaxInt32-1) + 1)
+}
+
+// newEncoder creates the encoder of the body with the content encoding.
+func newEncoder(w io.Writer, encoding string, dictSize int) (io.WriteCloser, error) {
+	switch encoding {
+	case EncodingXZ:
+		return xz.NewWriterConfig(w, xz.WriterConfig{Check: xz.CheckCRC64, DictSize: dictSize})
+	case EncodingLZMA:
+		props := lzma.DefaultProperties()
+		if dictSize != 0 {
+			props.DictSize = uint32(dictSize)
+		}
+
+		return lzma.NewWriter1(w, props)
+	}
+
+	return nil, errUnsupportedEncoding
+}
+
+// contentEncoding returns the supported content encoding of the header, or
+// "" if the body is not encoded by it.
+func contentEncoding(h http.Header) string {
+	switch encoding := strings.ToLower(strings.TrimSpace(h.Get("Content-Encoding"))); encoding {
+	case EncodingXZ, EncodingLZMA:
+		return encoding
+	}
+
+	return ""
+}
+
+// acceptEncoding chooses the content encoding of the response by
+// Accept-Encoding header: the one with the highest quality, xz if they are
+// equal.
+func acceptEncoding(h http.Header) string {
+	var (
+		best  string
+		bestQ float64
+	)
+
+	for _, value := range h.Values("Accept-Encoding") {
+		for _, part := range strings.Split(value, ",") {
+			encoding, params, _ := strings.Cut(part, ";")
+			encoding = strings.ToLower(strings.TrimSpace(encoding))
+
+			if encoding != EncodingXZ && encoding != EncodingLZMA {
+				continue
+			}
+
+			q := 1.0
+
+			if name, value, ok := strings.Cut(params, "="); ok && strings.TrimSpace(name) == "q" {
+				v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				if err != nil {
+					continue
+				}
+
+				q = v
+			}
+
+			if q > bestQ || q == bestQ && q > 0 && encoding == EncodingXZ {
+				best, bestQ = encoding, q
+			}
+		}
+	}
+
+	return best
+}
+
+// limitReader returns *http.MaxBytesError when the data exceed the limit, as
+// http.MaxBytesReader does.
+type limitReader struct {
+	r     io.Reader
+	n     int64
+	limit int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, &http.MaxBytesError{Limit: l.limit}
+	}
+
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+
+	n, err := l.r.Read(p)
+	if int64(n) > l.n {
+		n = int(l.n)
+		l.n = -1
+
+		return n, &http.MaxBytesError{Limit: l.limit}
+	}
+
+	l.n -= int64(n)
+
+	return n, err
+}
+
+// readCloser reads the decoder and closes the body.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
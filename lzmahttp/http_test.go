@@ -0,0 +1,367 @@
+package lzmahttp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// echoHandler responds with the request body.
+var echoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(data)
+})
+
+func encode(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	w, err := newEncoder(&buf, encoding, 0)
+	require.NoError(t, err)
+
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	server := httptest.NewServer(NewHandler(echoHandler, Config{}))
+	defer server.Close()
+
+	data := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 1000)
+
+	for _, encoding := range []string{EncodingXZ, EncodingLZMA} {
+		t.Run(encoding, func(t *testing.T) {
+			r := require.New(t)
+
+			client := &http.Client{Transport: NewTransport(nil, Config{RequestEncoding: encoding})}
+
+			resp, err := client.Post(server.URL, "application/octet-stream", bytes.NewReader(data))
+			r.NoError(err)
+			defer resp.Body.Close()
+
+			r.Equal(http.StatusOK, resp.StatusCode)
+			r.True(resp.Uncompressed)
+			r.Empty(resp.Header.Get("Content-Encoding"))
+			r.Equal("Accept-Encoding", resp.Header.Get("Vary"))
+
+			body, err := io.ReadAll(resp.Body)
+			r.NoError(err)
+			r.Equal(data, body)
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	data := []byte("hello, world")
+
+	tests := []struct {
+		name           string
+		method         string
+		acceptEncoding string
+		handler        http.Handler
+		expected       string
+	}{
+		{name: "xz", acceptEncoding: "gzip, xz", expected: EncodingXZ},
+		{name: "lzma", acceptEncoding: "lzma", expected: EncodingLZMA},
+		{name: "prefer xz", acceptEncoding: "lzma, xz", expected: EncodingXZ},
+		{name: "quality", acceptEncoding: "xz;q=0.5, lzma;q=0.8", expected: EncodingLZMA},
+		{name: "refused", acceptEncoding: "xz;q=0, gzip", expected: ""},
+		{name: "not accepted", acceptEncoding: "gzip, br", expected: ""},
+		{name: "no header", expected: ""},
+		{name: "head", method: http.MethodHead, acceptEncoding: "xz", expected: ""},
+		{
+			name:           "encoded by handler",
+			acceptEncoding: "xz",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Encoding", "identity")
+				_, _ = w.Write(data)
+			}),
+			expected: "identity",
+		},
+		{
+			name:           "no content",
+			acceptEncoding: "xz",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}),
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := require.New(t)
+
+			handler := tt.handler
+			if handler == nil {
+				handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+					_, _ = w.Write(data)
+				})
+			}
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			req := httptest.NewRequest(method, "/", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+
+			rec := httptest.NewRecorder()
+			NewHandler(handler, Config{}).ServeHTTP(rec, req)
+
+			r.Equal(tt.expected, rec.Header().Get("Content-Encoding"))
+			r.Equal("Accept-Encoding", rec.Header().Get("Vary"))
+
+			switch {
+			case rec.Code == http.StatusNoContent:
+				r.Empty(rec.Body.Bytes())
+			case tt.expected == EncodingXZ || tt.expected == EncodingLZMA:
+				r.Equal("text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+
+				dec, err := newDecoder(rec.Body, tt.expected, DefaultMaxDecodedSize)
+				r.NoError(err)
+
+				body, err := io.ReadAll(dec)
+				r.NoError(err)
+				r.Equal(data, body)
+			case method == http.MethodHead:
+			default:
+				r.Equal(data, rec.Body.Bytes())
+			}
+		})
+	}
+}
+
+func TestHandlerRequestBody(t *testing.T) {
+	data := bytes.Repeat([]byte{'a'}, 1000)
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		limit    int64
+		code     int
+	}{
+		{name: "xz", encoding: EncodingXZ, body: encode(t, EncodingXZ, data), code: http.StatusOK},
+		{name: "lzma", encoding: EncodingLZMA, body: encode(t, EncodingLZMA, data), code: http.StatusOK},
+		{name: "upper case", encoding: "XZ", body: encode(t, EncodingXZ, data), code: http.StatusOK},
+		{name: "limit", encoding: EncodingXZ, body: encode(t, EncodingXZ, data), limit: 1000, code: http.StatusOK},
+		{name: "too large xz", encoding: EncodingXZ, body: encode(t, EncodingXZ, data), limit: 999, code: http.StatusRequestEntityTooLarge},
+		{name: "too large lzma", encoding: EncodingLZMA, body: encode(t, EncodingLZMA, data), limit: 10, code: http.StatusRequestEntityTooLarge},
+		{name: "invalid header", encoding: EncodingXZ, body: []byte("not xz"), code: http.StatusBadRequest},
+		{name: "corrupted", encoding: EncodingXZ, body: encode(t, EncodingXZ, data)[:40], code: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := require.New(t)
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Encoding", tt.encoding)
+
+			rec := httptest.NewRecorder()
+			NewHandler(echoHandler, Config{MaxDecodedSize: tt.limit}).ServeHTTP(rec, req)
+
+			r.Equal(tt.code, rec.Code, rec.Body.String())
+
+			if tt.code == http.StatusOK {
+				r.Equal(data, rec.Body.Bytes())
+			}
+		})
+	}
+}
+
+// TestHandlerDictSize checks that the dictionary size of the header does not
+// allocate the window beyond the decoded size limit.
+func TestHandlerDictSize(t *testing.T) {
+	data := []byte("hello, world")
+
+	// .lzma header with 4 GiB dictionary.
+	lzmaBody := encode(t, EncodingLZMA, data)
+	binary.LittleEndian.PutUint32(lzmaBody[1:], 0xFFFFFFFF)
+
+	// .xz stream with 4 GiB dictionary in the LZMA2 filter properties of
+	// the block header, which is 12 bytes after the stream header.
+	xzBody := encode(t, EncodingXZ, data)
+	xzBody[16] = 40
+	binary.LittleEndian.PutUint32(xzBody[20:], crc32.ChecksumIEEE(xzBody[12:20]))
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+	}{
+		{name: "lzma", encoding: EncodingLZMA, body: lzmaBody},
+		{name: "xz", encoding: EncodingXZ, body: xzBody},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := require.New(t)
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Encoding", tt.encoding)
+
+			var before, after runtime.MemStats
+
+			runtime.ReadMemStats(&before)
+
+			rec := httptest.NewRecorder()
+			NewHandler(echoHandler, Config{MaxDecodedSize: 1024}).ServeHTTP(rec, req)
+
+			runtime.ReadMemStats(&after)
+
+			r.Less(after.TotalAlloc-before.TotalAlloc, uint64(4<<20))
+
+			r.Equal(http.StatusOK, rec.Code, rec.Body.String())
+			r.Equal(data, rec.Body.Bytes())
+		})
+	}
+}
+
+func TestHandlerPassThrough(t *testing.T) {
+	r := require.New(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("plain"))
+	req.Header.Set("Content-Encoding", "gzip")
+
+	var encoding string
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		encoding = req.Header.Get("Content-Encoding")
+		echoHandler(w, req)
+	})
+
+	rec := httptest.NewRecorder()
+	NewHandler(handler, Config{}).ServeHTTP(rec, req)
+
+	r.Equal(http.StatusOK, rec.Code)
+	r.Equal("gzip", encoding)
+	r.Equal("plain", rec.Body.String())
+}
+
+func TestTransport(t *testing.T) {
+	data := bytes.Repeat([]byte{'b'}, 1000)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := acceptEncoding(r.Header)
+		if encoding == "" {
+			_, _ = w.Write(data)
+
+			return
+		}
+
+		w.Header().Set("Content-Encoding", encoding)
+		_, _ = w.Write(encode(t, encoding, data))
+	}))
+	defer server.Close()
+
+	t.Run("decoded", func(t *testing.T) {
+		r := require.New(t)
+
+		client := &http.Client{Transport: NewTransport(nil, Config{})}
+
+		resp, err := client.Get(server.URL)
+		r.NoError(err)
+		defer resp.Body.Close()
+
+		r.True(resp.Uncompressed)
+		r.Equal(int64(-1), resp.ContentLength)
+
+		body, err := io.ReadAll(resp.Body)
+		r.NoError(err)
+		r.Equal(data, body)
+	})
+
+	t.Run("accept encoding set", func(t *testing.T) {
+		r := require.New(t)
+
+		client := &http.Client{Transport: NewTransport(nil, Config{})}
+
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		r.NoError(err)
+		req.Header.Set("Accept-Encoding", "lzma")
+
+		resp, err := client.Do(req)
+		r.NoError(err)
+		defer resp.Body.Close()
+
+		r.False(resp.Uncompressed)
+		r.Equal(EncodingLZMA, resp.Header.Get("Content-Encoding"))
+
+		body, err := io.ReadAll(resp.Body)
+		r.NoError(err)
+		r.Equal(encode(t, EncodingLZMA, data), body)
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		r := require.New(t)
+
+		client := &http.Client{Transport: NewTransport(nil, Config{MaxDecodedSize: 100})}
+
+		resp, err := client.Get(server.URL)
+		r.NoError(err)
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+
+		var maxErr *http.MaxBytesError
+		r.ErrorAs(err, &maxErr)
+		r.Equal(int64(100), maxErr.Limit)
+		r.Len(body, 100)
+	})
+}
+
+func TestAcceptEncoding(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected string
+	}{
+		{header: "", expected: ""},
+		{header: "*", expected: ""},
+		{header: "XZ", expected: EncodingXZ},
+		{header: "lzma;q=1, xz;q=1", expected: EncodingXZ},
+		{header: "xz;q=0.1, lzma", expected: EncodingLZMA},
+		{header: "xz;q=bad, lzma;q=0.2", expected: EncodingLZMA},
+		{header: "xz;q=0, lzma;q=0", expected: ""},
+	}
+
+	for _, tt := range tests {
+		h := http.Header{}
+		if tt.header != "" {
+			h.Set("Accept-Encoding", tt.header)
+		}
+
+		require.Equal(t, tt.expected, acceptEncoding(h), tt.header)
+	}
+}
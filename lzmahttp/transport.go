@@ -0,0 +1,101 @@
+package lzmahttp
+
+import (
+	"io"
+	"net/http"
+)
+
+// Transport is http.RoundTripper which asks for the responses encoded by xz
+// or lzma, decodes them and encodes the request bodies if
+// Config.RequestEncoding is set.
+type Transport struct {
+	base http.RoundTripper
+	cfg  Config
+}
+
+// NewTransport wraps base, nil selects http.DefaultTransport.
+func NewTransport(base http.RoundTripper, cfg Config) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &Transport{base: base, cfg: cfg}
+}
+
+// RoundTrip sends the request. The response is decoded only if the request
+// has no Accept-Encoding header, as http.Transport does for gzip. Reading the
+// response body beyond Config.MaxDecodedSize returns *http.MaxBytesError.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	outReq := req.Clone(req.Context())
+
+	decode := outReq.Header.Get("Accept-Encoding") == ""
+	if decode {
+		outReq.Header.Set("Accept-Encoding", EncodingXZ+", "+EncodingLZMA)
+	}
+
+	if t.cfg.RequestEncoding != "" && req.Body != nil && req.Body != http.NoBody && req.Header.Get("Content-Encoding") == "" {
+		err := t.encodeBody(outReq)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := t.base.RoundTrip(outReq)
+	if err != nil {
+		return nil, err
+	}
+
+	encoding := contentEncoding(resp.Header)
+	if !decode || encoding == "" {
+		return resp, nil
+	}
+
+	body, err := newDecoder(resp.Body, encoding, t.cfg.maxDecodedSize())
+	if err != nil {
+		_ = resp.Body.Close()
+
+		return nil, err
+	}
+
+	resp.Body = readCloser{Reader: body, Closer: resp.Body}
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+
+	return resp, nil
+}
+
+// encodeBody replaces the request body by the pipe from the encoder. The
+// encoder is created by the goroutine since it writes the header at once.
+func (t *Transport) encodeBody(req *http.Request) error {
+	if t.cfg.RequestEncoding != EncodingXZ && t.cfg.RequestEncoding != EncodingLZMA {
+		_ = req.Body.Close()
+
+		return errUnsupportedEncoding
+	}
+
+	pr, pw := io.Pipe()
+	body := req.Body
+
+	go func() {
+		enc, err := newEncoder(pw, t.cfg.RequestEncoding, t.cfg.DictSize)
+		if err == nil {
+			_, err = io.Copy(enc, body)
+			if err == nil {
+				err = enc.Close()
+			}
+		}
+
+		_ = body.Close()
+		_ = pw.CloseWithError(err)
+	}()
+
+	req.Body = pr
+	req.GetBody = nil
+	req.ContentLength = -1
+	req.Header.Set("Content-Encoding", t.cfg.RequestEncoding)
+	req.Header.Del("Content-Length")
+
+	return nil
+}
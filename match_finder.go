@@ -0,0 +1,309 @@
+package lzma
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	hash3Bits = 16
+
+	matchFinderMaxPos = 1 << 31
+)
+
+// matchFinder is hash chain match finder in the style of the HC4 match
+// finder from LZMA SDK: the 3-byte hash table remembers only the latest
+// position, the 4-byte hash table is chained through the cyclic buffer.
+type matchFinder struct {
+	buf     []byte
+	bufSize int
+	cur     int
+	end     int
+
+	// keep is the index of the first byte that must survive sliding,
+	// negative value means that only the history has to be kept.
+	keep int
+
+	// pos0 is the virtual position of buf[0]. Virtual positions start
+	// from 1, zero value in tables means no position.
+	pos0 uint32
+
+	dictSize  uint32
+	histSize  int
+	cycleSize uint32
+
+	hash3     []uint32
+	hash4     []uint32
+	hash4Bits uint
+	chain     []uint32
+
+	depth   int
+	niceLen int
+
+	matches []uint32
+}
+
+func newMatchFinder(dictSize uint32, histSize int, depth, niceLen int) *matchFinder {
+	if histSize < int(dictSize) {
+		histSize = int(dictSize)
+	}
+
+	extra := histSize / 2
+	if extra < 1<<16 {
+		extra = 1 << 16
+	}
+
+	hash4Bits := uint(bits.Len32(dictSize - 1))
+	if hash4Bits > 1 {
+		hash4Bits--
+	}
+	if hash4Bits < 12 {
+		hash4Bits = 12
+	}
+	if hash4Bits > 20 {
+		hash4Bits = 20
+	}
+
+	return &matchFinder{
+		bufSize: histSize + 2*maxMatchLen + extra,
+
+		keep: -1,
+		pos0: 1,
+
+		dictSize:  dictSize,
+		histSize:  histSize,
+		cycleSize: dictSize + 1,
+
+		hash3:     make([]uint32, 1<<hash3Bits),
+		hash4:     make([]uint32, 1<<hash4Bits),
+		hash4Bits: hash4Bits,
+		chain:     make([]uint32, dictSize+1),
+
+		depth:   depth,
+		niceLen: niceLen,
+
+		matches: make([]uint32, 0, 2*(maxMatchLen+1)),
+	}
+}
+
+// Avail returns the number of bytes from the current position to the end
+// of the buffered data.
+func (mf *matchFinder) Avail() int {
+	return mf.end - mf.cur
+}
+
+// Write copies as much of p into the buffer as it can hold.
+func (mf *matchFinder) Write(p []byte) int {
+	if mf.end+len(p) > mf.bufSize {
+		mf.slide()
+	}
+
+	n := mf.bufSize - mf.end
+	if n > len(p) {
+		n = len(p)
+	}
+
+	if mf.end+n > len(mf.buf) {
+		size := 2 * len(mf.buf)
+		if size < mf.end+n {
+			size = mf.end + n
+		}
+		if size > mf.bufSize {
+			size = mf.bufSize
+		}
+
+		buf := make([]byte, size)
+		copy(buf, mf.buf[:mf.end])
+		mf.buf = buf
+	}
+
+	copy(mf.buf[mf.end:], p[:n])
+	mf.end += n
+
+	return n
+}
+
+// Reset forgets the data. The tables are not cleared: the virtual position
+// moves past the dictionary, so the old positions are out of reach.
+func (mf *matchFinder) Reset() {
+	mf.pos0 += uint32(mf.end) + mf.dictSize + 1
+	mf.cur = 0
+	mf.end = 0
+	mf.keep = -1
+
+	if mf.pos0+uint32(mf.bufSize) >= matchFinderMaxPos {
+		mf.normalize()
+	}
+}
+
+func (mf *matchFinder) slide() {
+	start := mf.cur - mf.histSize - 8
+	if mf.keep >= 0 && start > mf.keep {
+		start = mf.keep
+	}
+	if start <= 0 {
+		return
+	}
+
+	copy(mf.buf, mf.buf[start:mf.end])
+	mf.cur -= start
+	mf.end -= start
+	if mf.keep >= 0 {
+		mf.keep -= start
+	}
+	mf.pos0 += uint32(start)
+
+	if mf.pos0+uint32(mf.bufSize) >= matchFinderMaxPos {
+		mf.normalize()
+	}
+}
+
+// normalize rebases all stored positions to keep them away from overflow.
+// The offset is a multiple of the cycle size, so positions keep their
+// cyclic buffer slots.
+func (mf *matchFinder) normalize() {
+	sub := mf.pos0 + uint32(mf.cur)
+	sub -= sub % mf.cycleSize
+	if sub <= mf.cycleSize {
+		return
+	}
+	sub -= mf.cycleSize
+
+	normalizeTable(mf.hash3, sub)
+	normalizeTable(mf.hash4, sub)
+	normalizeTable(mf.chain, sub)
+
+	mf.pos0 -= sub
+}
+
+func normalizeTable(t []uint32, sub uint32) {
+	for i, v := range t {
+		if v <= sub {
+			t[i] = 0
+		} else {
+			t[i] = v - sub
+		}
+	}
+}
+
+func (mf *matchFinder) hashes(i int) (uint32, uint32) {
+	v := binary.LittleEndian.Uint32(mf.buf[i:])
+	h3 := ((v & 0xFFFFFF) * 2654435761) >> (32 - hash3Bits)
+	h4 := (v * 2654435761) >> (32 - mf.hash4Bits)
+
+	return h3, h4
+}
+
+// Skip inserts n positions into the hash tables without searching matches.
+func (mf *matchFinder) Skip(n int) {
+	for ; n > 0; n-- {
+		if mf.end-mf.cur >= 4 {
+			pos := mf.pos0 + uint32(mf.cur)
+			h3, h4 := mf.hashes(mf.cur)
+
+			mf.hash3[h3] = pos
+			mf.chain[pos%mf.cycleSize] = mf.hash4[h4]
+			mf.hash4[h4] = pos
+		}
+
+		mf.cur++
+	}
+}
+
+// FindMatches searches the matches at the current position and moves the
+// position forward. The matches are returned as (length, distance-1) pairs
+// with increasing lengths.
+func (mf *matchFinder) FindMatches() []uint32 {
+	mf.matches = mf.matches[:0]
+
+	avail := mf.end - mf.cur
+	if avail < 4 {
+		mf.cur++
+
+		return mf.matches
+	}
+
+	if avail > maxMatchLen {
+		avail = maxMatchLen
+	}
+
+	pos := mf.pos0 + uint32(mf.cur)
+	h3, h4 := mf.hashes(mf.cur)
+
+	bestLen := 2
+
+	cand := mf.hash3[h3]
+	mf.hash3[h3] = pos
+
+	if cand != 0 && pos-cand <= mf.dictSize {
+		l := mf.matchLen(mf.cur-int(pos-cand), avail)
+		if l >= 3 {
+			bestLen = l
+			mf.matches = append(mf.matches, uint32(l), pos-cand-1)
+		}
+	}
+
+	cand = mf.hash4[h4]
+	mf.chain[pos%mf.cycleSize] = cand
+	mf.hash4[h4] = pos
+
+	if bestLen >= mf.niceLen || bestLen >= avail {
+		mf.cur++
+
+		return mf.matches
+	}
+
+	for depth := mf.depth; depth > 0 && cand != 0; depth-- {
+		delta := pos - cand
+		if delta > mf.dictSize {
+			break
+		}
+
+		i := mf.cur - int(delta)
+		if mf.buf[i+bestLen] == mf.buf[mf.cur+bestLen] {
+			l := mf.matchLen(i, avail)
+			if l > bestLen {
+				bestLen = l
+				mf.matches = append(mf.matches, uint32(l), delta-1)
+
+				if l >= mf.niceLen || l >= avail {
+					break
+				}
+			}
+		}
+
+		cand = mf.chain[cand%mf.cycleSize]
+	}
+
+	mf.cur++
+
+	return mf.matches
+}
+
+// matchLen returns the length of the common prefix of the data at index i
+// and the current position, limited by limit.
+func (mf *matchFinder) matchLen(i int, limit int) int {
+	a := mf.buf[i : i+limit]
+	b := mf.buf[mf.cur : mf.cur+limit]
+
+	return commonPrefixLen(a, b)
+}
+
+func commonPrefixLen(a, b []byte) int {
+	n := 0
+
+	for len(a)-n >= 8 {
+		x := binary.LittleEndian.Uint64(a[n:]) ^ binary.LittleEndian.Uint64(b[n:])
+		if x != 0 {
+			return n + bits.TrailingZeros64(x)>>3
+		}
+
+		n += 8
+	}
+
+	for n < len(a) && a[n] == b[n] {
+		n++
+	}
+
+	return n
+}
@@ -0,0 +1,171 @@
+package lzma
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Member describes the member of concatenated .lzma stream.
+type Member struct {
+	// Index is the number of the member from zero.
+	Index int
+	// Offset is the offset of the member header in the input.
+	Offset int64
+	// CompressedSize is the size of the member with its header.
+	CompressedSize int64
+	// UncompressedSize is the size of the decoded data.
+	UncompressedSize int64
+
+	Properties Properties
+}
+
+var errMemberHeader = errors.New("lzma: invalid header of the next member")
+
+// MultiReader1 decodes .lzma files written back to back, as by
+// cat a.lzma b.lzma, until the end of input. The header of every member is
+// parsed anew, so the members may have different properties.
+type MultiReader1 struct {
+	inStream *bufio.Reader
+	counter  *countingReader
+	onMember func(Member)
+
+	member Member
+	lzma   *Reader1
+
+	isEndOfStream bool
+}
+
+// NewMultiReader1 reads the header of the first member and creates the
+// reader. The onMember, if not nil, is called after every decoded member.
+func NewMultiReader1(inStream io.Reader, onMember func(Member)) (*MultiReader1, error) {
+	counter := &countingReader{r: inStream}
+
+	r := &MultiReader1{
+		inStream: bufio.NewReader(counter),
+		counter:  counter,
+		onMember: onMember,
+		member:   Member{Index: -1},
+	}
+
+	err := r.nextMember()
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// offset returns the number of bytes consumed from the input.
+func (r *MultiReader1) offset() int64 {
+	return r.counter.n - int64(r.inStream.Buffered())
+}
+
+func (r *MultiReader1) Read(p []byte) (n int, err error) {
+	for {
+		if r.isEndOfStream {
+			return 0, io.EOF
+		}
+
+		if r.lzma == nil {
+			err = r.nextMember()
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		n, err = r.lzma.Read(p)
+		r.member.UncompressedSize += int64(n)
+
+		if errors.Is(err, io.EOF) {
+			err = r.closeMember()
+			if err != nil {
+				return n, err
+			}
+
+			if n == 0 {
+				continue
+			}
+		}
+
+		if err != nil {
+			return n, r.memberError(err)
+		}
+
+		return n, nil
+	}
+}
+
+// nextMember reads the header of the next member.
+func (r *MultiReader1) nextMember() error {
+	r.member = Member{
+		Index:  r.member.Index + 1,
+		Offset: r.offset(),
+	}
+
+	head, err := r.inStream.Peek(LZMAHeaderLen)
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(head) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return r.memberError(err)
+	}
+
+	r.member.Properties, err = DecodeProperties(head[:LZMAPropsLen])
+	if err != nil {
+		return r.memberError(err)
+	}
+
+	r.lzma, err = NewReader1(r.inStream)
+	if err != nil {
+		return r.memberError(err)
+	}
+
+	return nil
+}
+
+// closeMember reports the decoded member and checks that the input ends or
+// the next member follows.
+func (r *MultiReader1) closeMember() error {
+	r.lzma = nil
+	r.member.CompressedSize = r.offset() - r.member.Offset
+
+	if r.onMember != nil {
+		r.onMember(r.member)
+	}
+
+	head, err := r.inStream.Peek(LZMAHeaderLen + 1)
+	if len(head) == 0 && errors.Is(err, io.EOF) {
+		r.isEndOfStream = true
+
+		return nil
+	}
+
+	if !isLZMAHeader(head) {
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		return fmt.Errorf("%w at offset %d", errMemberHeader, r.offset())
+	}
+
+	return nil
+}
+
+func (r *MultiReader1) memberError(err error) error {
+	return fmt.Errorf("lzma: member %d at offset %d: %w", r.member.Index, r.member.Offset, err)
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+
+	return n, err
+}
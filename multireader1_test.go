@@ -0,0 +1,119 @@
+package lzma
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiReader1(t *testing.T) {
+	r := require.New(t)
+
+	var (
+		input    []byte
+		expected []byte
+		members  []Member
+	)
+
+	for i, name := range []string{
+		"testassets/a.lzma",
+		"testassets/a_eos.lzma",
+		"testassets/randomfile.dat.lzma",
+		"testassets/a_lp1_lc2_pb1.lzma",
+		"testassets/a_eos_and_size.lzma",
+	} {
+		data, err := os.ReadFile(name)
+		r.NoError(err)
+
+		reader, err := NewReader1(bytes.NewReader(data))
+		r.NoError(err)
+
+		decoded, err := io.ReadAll(reader)
+		r.NoError(err)
+
+		props, err := DecodeProperties(data[:LZMAPropsLen])
+		r.NoError(err)
+
+		members = append(members, Member{
+			Index:            i,
+			Offset:           int64(len(input)),
+			CompressedSize:   int64(len(data)),
+			UncompressedSize: int64(len(decoded)),
+			Properties:       props,
+		})
+
+		input = append(input, data...)
+		expected = append(expected, decoded...)
+	}
+
+	var actualMembers []Member
+
+	reader, err := NewMultiReader1(bytes.NewReader(input), func(m Member) {
+		actualMembers = append(actualMembers, m)
+	})
+	r.NoError(err)
+
+	actual, err := io.ReadAll(reader)
+	r.NoError(err)
+	r.True(bytes.Equal(expected, actual))
+	r.Equal(members, actualMembers)
+
+	reader, err = NewMultiReader1(bytes.NewReader(input[:members[1].Offset]), nil)
+	r.NoError(err)
+
+	actual, err = io.ReadAll(reader)
+	r.NoError(err)
+	r.Len(actual, int(members[0].UncompressedSize))
+}
+
+func TestMultiReader1Errors(t *testing.T) {
+	a, err := os.ReadFile("testassets/a.lzma")
+	require.NoError(t, err)
+
+	double := append(append([]byte(nil), a...), a...)
+
+	testCases := []struct {
+		name  string
+		input []byte
+		err   error
+	}{
+		{
+			name: "empty",
+			err:  io.EOF,
+		},
+		{
+			name:  "short_header",
+			input: a[:LZMAHeaderLen-1],
+			err:   io.ErrUnexpectedEOF,
+		},
+		{
+			name:  "trailing_data",
+			input: append(append([]byte(nil), a...), "trailing data"...),
+			err:   errMemberHeader,
+		},
+		{
+			name:  "truncated_member",
+			input: double[:len(double)-10],
+			err:   io.ErrUnexpectedEOF,
+		},
+		{
+			name:  "bad_member",
+			input: append(append([]byte(nil), a...), 225, 0, 0, 1, 0),
+			err:   errMemberHeader,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reader, err := NewMultiReader1(bytes.NewReader(tc.input), nil)
+			if err == nil {
+				_, err = io.ReadAll(reader)
+			}
+
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+}
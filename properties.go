@@ -0,0 +1,89 @@
+package lzma
+
+import "errors"
+
+// DefaultDictSize is the dictionary size used by writers when none is given,
+// it is the dictionary size of xz preset 6.
+const DefaultDictSize = 8 << 20
+
+// Properties are LZMA coder properties: the number of literal context bits,
+// literal position bits, position bits and the dictionary size.
+type Properties struct {
+	LC, LP, PB uint8
+	DictSize   uint32
+}
+
+// DefaultProperties returns the properties used by lzma and xz utilities:
+// lc=3, lp=0, pb=2 and 8 MiB dictionary.
+func DefaultProperties() Properties {
+	return Properties{
+		LC:       3,
+		LP:       0,
+		PB:       2,
+		DictSize: DefaultDictSize,
+	}
+}
+
+var errPropertiesOutOfRange = errors.New("lzma: lc, lp or pb is out of range")
+
+// Validate checks the properties for the encoder.
+func (p Properties) Validate() error {
+	if p.LC > 8 || p.LP > 4 || p.PB > 4 {
+		return errPropertiesOutOfRange
+	}
+
+	if p.DictSize < lzmaDicMin {
+		return ErrDictOutOfRange
+	}
+
+	return nil
+}
+
+// Encode returns 5 bytes of properties as stored in .lzma header and in 7z
+// coder properties.
+func (p Properties) Encode() []byte {
+	return []byte{
+		EncodeProp(p.LC, p.PB, p.LP),
+		byte(p.DictSize),
+		byte(p.DictSize >> 8),
+		byte(p.DictSize >> 16),
+		byte(p.DictSize >> 24),
+	}
+}
+
+// DecodeProperties is the reverse of Encode, the dictionary size less than
+// 4 KiB is rounded up as in .lzma header.
+func DecodeProperties(props []byte) (Properties, error) {
+	if len(props) != LZMAPropsLen {
+		return Properties{}, ErrIncorrectProperties
+	}
+
+	lc, pb, lp, err := DecodeProp(props[0])
+	if err != nil {
+		return Properties{}, err
+	}
+
+	dictSize, err := DecodeDictSize(props[1:])
+	if err != nil {
+		return Properties{}, err
+	}
+
+	return Properties{LC: lc, LP: lp, PB: pb, DictSize: dictSize}, nil
+}
+
+// EncodeProp is the reverse of DecodeProp.
+func EncodeProp(lc, pb, lp uint8) byte {
+	return (pb*5+lp)*9 + lc
+}
+
+// EncodeDictSize2 returns LZMA2 dictionary size byte for the smallest
+// dictionary that is not less than dictSize, see DecodeDictSize2.
+func EncodeDictSize2(dictSize uint32) byte {
+	for b := byte(0); b < 40; b++ {
+		if DecodeDictSize2(b) >= dictSize {
+			return b
+		}
+	}
+
+	return 40
+}
@@ -0,0 +1,116 @@
+package lzma
+
+import (
+	"io"
+)
+
+// rangeEncoder is the counterpart of rangeDecoder. Write errors are sticky:
+// the first one stops the output and is returned by Err and Flush.
+type rangeEncoder struct {
+	outStream io.ByteWriter
+
+	Low       uint64
+	Range     uint32
+	cache     byte
+	cacheSize int64
+
+	written int64
+	err     error
+}
+
+func newRangeEncoder(outStream io.ByteWriter) *rangeEncoder {
+	return &rangeEncoder{
+		outStream: outStream,
+
+		Range:     0xFFFFFFFF,
+		cacheSize: 1,
+	}
+}
+
+func (e *rangeEncoder) Reopen(outStream io.ByteWriter) {
+	e.outStream = outStream
+	e.Low = 0
+	e.Range = 0xFFFFFFFF
+	e.cache = 0
+	e.cacheSize = 1
+	e.written = 0
+	e.err = nil
+}
+
+// Pending returns the number of bytes the stream would take if it was
+// flushed right now.
+func (e *rangeEncoder) Pending() int64 {
+	return e.written + e.cacheSize + 4
+}
+
+func (e *rangeEncoder) Err() error {
+	return e.err
+}
+
+func (e *rangeEncoder) shiftLow() {
+	if uint32(e.Low) < 0xFF000000 || (e.Low>>32) != 0 {
+		carry := byte(e.Low >> 32)
+		temp := e.cache
+
+		for {
+			if e.err == nil {
+				e.err = e.outStream.WriteByte(temp + carry)
+			}
+
+			e.written++
+			temp = 0xFF
+
+			e.cacheSize--
+			if e.cacheSize == 0 {
+				break
+			}
+		}
+
+		e.cache = byte(e.Low >> 24)
+	}
+
+	e.cacheSize++
+	e.Low = (e.Low & 0x00FFFFFF) << 8
+}
+
+func (e *rangeEncoder) EncodeBit(v *prob, bit uint32) {
+	bound := (e.Range >> kNumBitModelTotalBits) * uint32(*v)
+
+	if bit == 0 {
+		e.Range = bound
+		*v += ((1 << kNumBitModelTotalBits) - *v) >> kNumMoveBits
+	} else {
+		e.Low += uint64(bound)
+		e.Range -= bound
+		*v -= *v >> kNumMoveBits
+	}
+
+	// Normalize
+	if e.Range < kTopValue {
+		e.Range <<= 8
+		e.shiftLow()
+	}
+}
+
+func (e *rangeEncoder) EncodeDirectBits(value uint32, numBits int) {
+	for numBits > 0 {
+		numBits--
+
+		e.Range >>= 1
+		e.Low += uint64(e.Range & (0 - ((value >> numBits) & 1)))
+
+		// Normalize
+		if e.Range < kTopValue {
+			e.Range <<= 8
+			e.shiftLow()
+		}
+	}
+}
+
+func (e *rangeEncoder) Flush() error {
+	for i := 0; i < 5; i++ {
+		e.shiftLow()
+	}
+
+	return e.err
+}
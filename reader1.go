@@ -13,8 +13,33 @@ type Reader1 struct {
 
 	s             *state
 	isEndOfStream bool
+
+	endMarker   EndMarker
+	markerFound bool
 }
 
+// UnpackSizeUnknown is the unpack size of the stream terminated by the end
+// marker or the end of input.
+const UnpackSizeUnknown = ^uint64(0)
+
+// EndMarker is the policy of the end marker of raw LZMA stream.
+type EndMarker uint8
+
+const (
+	// EndMarkerOptional ends the stream with known unpack size after the
+	// given number of bytes or at the end marker following them, the stream
+	// with unknown unpack size ends at the end marker or the end of input.
+	EndMarkerOptional EndMarker = iota
+	// EndMarkerRequired requires the end marker, after the unpack size bytes
+	// if the size is known. It is liblzma LZMA1 filter.
+	EndMarkerRequired
+	// EndMarkerForbidden ends the stream exactly after the known unpack size
+	// bytes. It is liblzma LZMA1EXT filter without LZMA_LZMA1EXT_ALLOW_EOPM.
+	EndMarkerForbidden
+)
+
+var errEndMarkerPolicy = errors.New("lzma: unknown unpack size needs the end marker")
+
 func NewReader1(inStream io.ByteReader) (*Reader1, error) {
 	r := &Reader1{
 		rangeDec: newRangeDecoder(inStream),
@@ -34,30 +59,54 @@ func NewLZMADecompressorForSevenZip(props []byte, unpackSize uint64, readers []i
 		return nil, errNeedOneReader
 	}
 
-	lc, pb, lp, err := DecodeProp(props[0])
-	if err != nil {
-		return nil, err
+	r, err := NewRawReader1Props(readers[0], props, unpackSize, EndMarkerOptional)
+
+	return &readCloser{
+		c: readers[0],
+		r: r,
+	}, err
+}
+
+// NewRawReader1 creates reader of LZMA stream without header, as stored in
+// 7z files, Unity bundles, NSIS installers and liblzma raw streams. The
+// unpackSize is UnpackSizeUnknown if the size is not known. The window of
+// props.DictSize is rounded as the one of NewReader2.
+func NewRawReader1(inStream io.Reader, props Properties, unpackSize uint64, endMarker EndMarker) (*Reader1, error) {
+	if props.LC > 8 || props.LP > 4 || props.PB > 4 {
+		return nil, errPropertiesOutOfRange
 	}
 
-	dictSize, err := DecodeDictSize(props[1:5])
-	if err != nil {
-		return nil, err
+	if endMarker > EndMarkerForbidden {
+		return nil, errEndMarkerPolicy
+	}
+
+	if endMarker == EndMarkerForbidden && unpackSize == UnpackSizeUnknown {
+		return nil, errEndMarkerPolicy
 	}
 
-	inStream, ok := readers[0].(io.ByteReader)
+	br, ok := inStream.(io.ByteReader)
 	if !ok {
-		inStream = bufio.NewReader(readers[0])
+		br = bufio.NewReader(inStream)
 	}
 
 	r := &Reader1{
-		rangeDec:  newRangeDecoder(inStream),
-		outWindow: newWindow(dictSize),
+		rangeDec:  newRangeDecoder(br),
+		outWindow: newWindow(props.DictSize),
+		endMarker: endMarker,
 	}
 
-	return &readCloser{
-		c: readers[0],
-		r: r,
-	}, r.initialize(lc, pb, lp, unpackSize)
+	return r, r.initialize(props.LC, props.PB, props.LP, unpackSize)
+}
+
+// NewRawReader1Props is NewRawReader1 with 5 bytes of properties as stored in
+// 7z coder properties.
+func NewRawReader1Props(inStream io.Reader, props []byte, unpackSize uint64, endMarker EndMarker) (*Reader1, error) {
+	p, err := DecodeProperties(props)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRawReader1(inStream, p, unpackSize, endMarker)
 }
 
 func NewReader1ForReader2(inStream io.ByteReader, prop byte, unpackSize uint64, outWindow *window) (*Reader1, error) {
@@ -161,10 +210,48 @@ func (r *Reader1) initialize(lc, pb, lp uint8, unpackSize uint64) error {
 func (r *Reader1) Reset() {
 	r.s.Reset()
 	r.isEndOfStream = false
+	r.markerFound = false
+}
+
+// ResetRaw discards the state of the reader and makes it read new raw
+// stream as NewRawReader1 does with the end marker policy of the reader. It
+// reuses the probabilities and the window if its size is the dictionary size.
+func (r *Reader1) ResetRaw(inStream io.Reader, props Properties, unpackSize uint64) error {
+	if props.LC > 8 || props.LP > 4 || props.PB > 4 {
+		return errPropertiesOutOfRange
+	}
+
+	if r.endMarker == EndMarkerForbidden && unpackSize == UnpackSizeUnknown {
+		return errEndMarkerPolicy
+	}
+
+	if r.outWindow == nil || r.outWindow.size != windowSize(props.DictSize) {
+		r.outWindow = newWindow(props.DictSize)
+	} else {
+		r.outWindow.Reset()
+	}
+
+	br, ok := inStream.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(inStream)
+	}
+
+	if r.s == nil {
+		r.s = newState(props.LC, props.PB, props.LP)
+	} else {
+		r.s.Renew(props.LC, props.PB, props.LP)
+	}
+
+	if r.rangeDec == nil {
+		r.rangeDec = newRangeDecoder(br)
+	}
+
+	return r.Reopen(br, unpackSize)
 }
 
 func (r *Reader1) Reopen(inStream io.ByteReader, unpackSize uint64) error {
 	r.isEndOfStream = false
+	r.markerFound = false
 	r.s.SetUnpackSize(unpackSize)
 
 	err := r.rangeDec.Reopen(inStream)
@@ -221,6 +308,10 @@ func DecodeProp(d byte) (uint8, uint8, uint8, error) {
 }
 
 func (r *Reader1) Read(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
 	var k int
 
 	for {
@@ -242,10 +333,17 @@ func (r *Reader1) Read(p []byte) (n int, err error) {
 			return
 		}
 
-		err = r.decompress(uint32(len(p) - n))
+		// The pending data must stay in the window, a match may
+		// overshoot the requested amount by maxMatchLen bytes.
+		need := uint32(len(p) - n)
+		if need > r.outWindow.size-maxMatchLen {
+			need = r.outWindow.size - maxMatchLen
+		}
+
+		err = r.decompress(need)
 		if errors.Is(err, io.EOF) {
 			r.isEndOfStream = true
-			err = nil
+			err = r.checkEnd()
 		}
 		if err != nil {
 			return
@@ -253,6 +351,21 @@ func (r *Reader1) Read(p []byte) (n int, err error) {
 	}
 }
 
+// checkEnd checks that the stream is not truncated when it ends by the end
+// marker, the unpack size or the end of input.
+func (r *Reader1) checkEnd() error {
+	switch {
+	case r.markerFound:
+		return nil
+	case r.endMarker == EndMarkerRequired:
+		return io.ErrUnexpectedEOF
+	case r.s.unpackSizeDefined && r.s.bytesLeft > 0:
+		return io.ErrUnexpectedEOF
+	}
+
+	return nil
+}
+
 func (r *Reader1) DecodeLiteral(state uint32, rep0 uint32) error {
 	prevByte := uint32(0)
 	if !r.outWindow.IsEmpty() {
@@ -104,6 +104,226 @@ func TestReader1WithFileVerification(t *testing.T) {
 	}
 }
 
+func TestReader1EmptyRead(t *testing.T) {
+	r := require.New(t)
+
+	input, err := os.Open("testassets/a.lzma")
+	r.NoError(err)
+	defer input.Close()
+
+	reader, err := NewReader1(bufio.NewReader(input))
+	r.NoError(err)
+
+	n, err := reader.Read(nil)
+	r.NoError(err)
+	r.Zero(n)
+}
+
+// rawStream splits .lzma file to the properties, the unpack size and the raw
+// LZMA stream.
+func rawStream(t *testing.T, name string) ([]byte, uint64, []byte) {
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+
+	return data[:LZMAPropsLen], DecodeUnpackSize(data[LZMAPropsLen:]), data[LZMAHeaderLen:]
+}
+
+func TestRawReader1(t *testing.T) {
+	expected, err := os.ReadFile("testassets/a.lzma")
+	require.NoError(t, err)
+
+	reader, err := NewReader1(bytes.NewReader(expected))
+	require.NoError(t, err)
+
+	expected, err = io.ReadAll(reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name string
+
+		inputFile   string
+		unknownSize bool
+		truncate    int
+		endMarker   EndMarker
+		err         error
+	}{
+		{
+			name:      "size_marker_optional",
+			inputFile: "testassets/a.lzma",
+			endMarker: EndMarkerOptional,
+		},
+		{
+			name:      "size_marker_forbidden",
+			inputFile: "testassets/a.lzma",
+			endMarker: EndMarkerForbidden,
+		},
+		{
+			name:      "size_marker_required",
+			inputFile: "testassets/a.lzma",
+			endMarker: EndMarkerRequired,
+			err:       ErrResultError,
+		},
+		{
+			name:        "size_unknown_end_of_input",
+			inputFile:   "testassets/a.lzma",
+			unknownSize: true,
+			endMarker:   EndMarkerOptional,
+		},
+		{
+			name:      "size_truncated",
+			inputFile: "testassets/a.lzma",
+			truncate:  10,
+			endMarker: EndMarkerOptional,
+			err:       io.ErrUnexpectedEOF,
+		},
+		{
+			name:      "eos_required",
+			inputFile: "testassets/a_eos.lzma",
+			endMarker: EndMarkerRequired,
+		},
+		{
+			name:      "eos_truncated",
+			inputFile: "testassets/a_eos.lzma",
+			truncate:  1,
+			endMarker: EndMarkerRequired,
+			err:       io.ErrUnexpectedEOF,
+		},
+		{
+			name:      "eos_optional",
+			inputFile: "testassets/a_eos.lzma",
+			endMarker: EndMarkerOptional,
+		},
+		{
+			name:      "eos_forbidden",
+			inputFile: "testassets/a_eos.lzma",
+			endMarker: EndMarkerForbidden,
+			err:       errEndMarkerPolicy,
+		},
+		{
+			name:      "eos_and_size_required",
+			inputFile: "testassets/a_eos_and_size.lzma",
+			endMarker: EndMarkerRequired,
+		},
+		{
+			name:      "eos_and_size_optional",
+			inputFile: "testassets/a_eos_and_size.lzma",
+			endMarker: EndMarkerOptional,
+		},
+		{
+			name:      "eos_and_size_forbidden",
+			inputFile: "testassets/a_eos_and_size.lzma",
+			endMarker: EndMarkerForbidden,
+			err:       ErrResultError,
+		},
+		{
+			name:      "lp1_lc2_pb1",
+			inputFile: "testassets/a_lp1_lc2_pb1.lzma",
+			endMarker: EndMarkerForbidden,
+		},
+		{
+			name:      "incorrect_size",
+			inputFile: "testassets/bad_eos_incorrect_size.lzma",
+			endMarker: EndMarkerRequired,
+			err:       ErrResultError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			props, unpackSize, stream := rawStream(t, tc.inputFile)
+			if tc.unknownSize {
+				unpackSize = UnpackSizeUnknown
+			}
+
+			stream = stream[:len(stream)-tc.truncate]
+
+			reader, err := NewRawReader1Props(bytes.NewReader(stream), props, unpackSize, tc.endMarker)
+			if err == nil {
+				var actual []byte
+
+				actual, err = io.ReadAll(reader)
+				if err == nil {
+					r.Equal(expected, actual)
+				}
+			}
+
+			r.ErrorIs(err, tc.err)
+		})
+	}
+}
+
+func TestRawReader1Properties(t *testing.T) {
+	r := require.New(t)
+
+	props, unpackSize, stream := rawStream(t, "testassets/a_lp1_lc2_pb1.lzma")
+
+	p, err := DecodeProperties(props)
+	r.NoError(err)
+	r.Equal(Properties{LC: 1, LP: 1, PB: 1, DictSize: 1 << 16}, p)
+	r.Equal(props, p.Encode())
+
+	reader, err := NewRawReader1(bytes.NewReader(stream), p, unpackSize, EndMarkerOptional)
+	r.NoError(err)
+
+	actual, err := io.ReadAll(reader)
+	r.NoError(err)
+	r.Len(actual, int(unpackSize))
+
+	_, err = NewRawReader1(bytes.NewReader(stream), Properties{LC: 9}, unpackSize, EndMarkerOptional)
+	r.ErrorIs(err, errPropertiesOutOfRange)
+
+	_, err = NewRawReader1Props(bytes.NewReader(stream), props[:4], unpackSize, EndMarkerOptional)
+	r.ErrorIs(err, ErrIncorrectProperties)
+
+	_, err = NewRawReader1(bytes.NewReader(stream), p, unpackSize, EndMarkerForbidden+1)
+	r.ErrorIs(err, errEndMarkerPolicy)
+}
+
+func TestReader1ResetRaw(t *testing.T) {
+	r := require.New(t)
+
+	files := []string{
+		"testassets/a.lzma",
+		"testassets/a_lp1_lc2_pb1.lzma",
+		"testassets/a_eos.lzma",
+		"testassets/a.lzma",
+	}
+
+	var reader *Reader1
+
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		r.NoError(err)
+
+		full, err := NewReader1(bytes.NewReader(data))
+		r.NoError(err)
+
+		expected, err := io.ReadAll(full)
+		r.NoError(err)
+
+		props, unpackSize, stream := rawStream(t, name)
+
+		p, err := DecodeProperties(props)
+		r.NoError(err)
+
+		if reader == nil {
+			reader, err = NewRawReader1(bytes.NewReader(stream), p, unpackSize, EndMarkerOptional)
+		} else {
+			err = reader.ResetRaw(bytes.NewReader(stream), p, unpackSize)
+		}
+		r.NoError(err, name)
+
+		actual, err := io.ReadAll(reader)
+		r.NoError(err, name)
+		r.Equal(expected, actual, name)
+	}
+
+	r.ErrorIs(reader.ResetRaw(bytes.NewReader(nil), Properties{PB: 5}, 0), errPropertiesOutOfRange)
+	r.ErrorIs(reader.ResetRaw(bytes.NewReader(nil), DefaultProperties(), 0), io.EOF)
+}
+
 const randomFileMD5 = "b2d18c4275c394a729607ff9fe0caae7"
 
 // goos: darwin
@@ -138,3 +358,60 @@ func BenchmarkReader1(b *testing.B) {
 		b.SetBytes(n)
 	}
 }
+
+func TestReader1ReadLargerThanWindow(t *testing.T) {
+	r := require.New(t)
+
+	data := make([]byte, 1<<16)
+	for i := range data {
+		data[i] = byte(i * i >> 9)
+	}
+
+	var buf bytes.Buffer
+
+	w, err := NewWriter1(&buf, Properties{LC: 3, LP: 0, PB: 2, DictSize: lzmaDicMin})
+	r.NoError(err)
+
+	_, err = w.Write(data)
+	r.NoError(err)
+	r.NoError(w.Close())
+
+	reader, err := NewReader1(bytes.NewReader(buf.Bytes()))
+	r.NoError(err)
+
+	// The decoded data pending in the window must not be overwritten when
+	// the buffer is larger than the window.
+	actual := make([]byte, len(data))
+	_, err = io.ReadFull(reader, actual)
+	r.NoError(err)
+	r.True(bytes.Equal(data, actual))
+}
+
+func TestRawReader1DictSizeNotAligned(t *testing.T) {
+	r := require.New(t)
+
+	data := make([]byte, 1<<16)
+	for i := range data {
+		data[i] = byte(i * i >> 9)
+	}
+
+	var buf bytes.Buffer
+
+	w, err := NewWriter1(&buf, Properties{LC: 3, LP: 0, PB: 2, DictSize: lzmaDicMin})
+	r.NoError(err)
+
+	_, err = w.Write(data)
+	r.NoError(err)
+	r.NoError(w.Close())
+
+	// The window wraps at the multiple of 16, so the position state stays
+	// the one of the encoder for the dictionary size of any alignment.
+	props := Properties{LC: 3, LP: 0, PB: 2, DictSize: lzmaDicMin + 1}
+
+	reader, err := NewRawReader1(bytes.NewReader(buf.Bytes()[LZMAHeaderLen:]), props, UnpackSizeUnknown, EndMarkerOptional)
+	r.NoError(err)
+
+	actual, err := io.ReadAll(reader)
+	r.NoError(err)
+	r.True(bytes.Equal(data, actual))
+}
@@ -21,8 +21,18 @@ type Reader2 struct {
 	chunkCompressedSize   uint16
 
 	limitReader io.Reader
+
+	// needChunk is set when Read returned at the end of the chunk without
+	// reading the header of the next one.
+	needChunk bool
+
+	// buf is the buffer created by the reader for inStream.
+	buf *bufio.Reader
 }
 
+// NewReader2 creates reader of LZMA2 stream with the window of dictSize,
+// zero selects 8 MiB. The window is rounded up to the multiple of 16 and to
+// 4 KiB, so dictSize may be the output size if it is smaller.
 func NewReader2(inStream io.Reader, dictSize int) (*Reader2, error) {
 	br, ok := inStream.(*bufio.Reader)
 	if !ok {
@@ -37,9 +47,28 @@ func NewReader2(inStream io.Reader, dictSize int) (*Reader2, error) {
 		header: make([]byte, 6),
 	}
 
+	if !ok {
+		r.buf = br
+	}
+
 	return r, r.initialize()
 }
 
+// NewRawReader2 creates reader of LZMA2 stream with 1 byte of properties,
+// as liblzma raw LZMA2 filter. The stream ends with the end chunk.
+func NewRawReader2(inStream io.Reader, props []byte) (*Reader2, error) {
+	if len(props) != 1 || props[0] > 40 {
+		return nil, ErrIncorrectProperties
+	}
+
+	dictSize := uint32(lzmaDicMax)
+	if props[0] < 40 {
+		dictSize = DecodeDictSize2(props[0])
+	}
+
+	return NewReader2(inStream, int(dictSize))
+}
+
 var errInsufficientProperties = errors.New("lzma2: not enough properties")
 
 // NewLZMA2DecompressorForSevenZip decompressor constructor for bodgit/sevenzip.
@@ -74,6 +103,34 @@ func NewLZMA2DecompressorForSevenZip(props []byte, _ uint64, readers []io.ReadCl
 	}, r.initialize()
 }
 
+// Reset discards the state of the reader and makes it read new stream from
+// inStream with the same dictionary size. It reuses the memory of the
+// dictionary and of the LZMA state, which the first LZMA chunk resets.
+func (r *Reader2) Reset(inStream io.Reader) error {
+	br, ok := inStream.(*bufio.Reader)
+	if !ok {
+		if r.buf == nil {
+			r.buf = bufio.NewReader(inStream)
+		} else {
+			r.buf.Reset(inStream)
+		}
+
+		br = r.buf
+	}
+
+	r.inStream = br
+	r.limitReader = nil
+	r.needChunk = false
+
+	if r.outWindow == nil {
+		return r.initialize()
+	}
+
+	r.outWindow.Reset()
+
+	return r.startChunk()
+}
+
 func (r *Reader2) initialize() error {
 	err := r.validateDictSize()
 	if err != nil {
@@ -86,7 +143,7 @@ func (r *Reader2) initialize() error {
 }
 
 func (r *Reader2) validateDictSize() error {
-	if r.dictSize < lzmaDicMin {
+	if r.dictSize == 0 {
 		r.dictSize = 8 * 1024 * 1024
 	}
 
@@ -213,9 +270,21 @@ func chunkLength(chunkType chunkType) int {
 	return 1
 }
 
+// Read reads the decompressed data. It returns at the end of the chunk if
+// the input has no buffered data, so the data of the complete chunks is
+// read without waiting for the next one, as from the network.
 func (r *Reader2) Read(p []byte) (n int, err error) {
 	var k int
 
+	if r.needChunk {
+		err = r.startChunk()
+		if err != nil {
+			return 0, err
+		}
+
+		r.needChunk = false
+	}
+
 	for n < len(p) {
 		switch r.chunkType {
 		case chunkEndOfStream:
@@ -232,6 +301,12 @@ func (r *Reader2) Read(p []byte) (n int, err error) {
 		}
 
 		if errors.Is(err, io.EOF) {
+			if n > 0 && r.inStream.Buffered() == 0 {
+				r.needChunk = true
+
+				return n, nil
+			}
+
 			err = r.startChunk()
 			if err != nil {
 				return n, err
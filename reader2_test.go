@@ -7,6 +7,8 @@ import (
 	"io"
 	"os"
 	"testing"
+
+	"github.com/stretchr/testify/require"
 )
 
 func TestReader2WithFileVerification(t *testing.T) {
@@ -28,6 +30,66 @@ func TestReader2WithFileVerification(t *testing.T) {
 	}
 }
 
+func TestRawReader2(t *testing.T) {
+	compressedData, err := os.ReadFile("testassets/randomfile.dat.lzma2")
+	require.NoError(t, err)
+
+	r, err := NewRawReader2(bytes.NewReader(compressedData), []byte{EncodeDictSize2(DefaultDictSize)})
+	require.NoError(t, err)
+
+	actualSummator := md5.New()
+	_, err = io.Copy(actualSummator, r)
+	require.NoError(t, err)
+	require.Equal(t, randomFileMD5, fmt.Sprintf("%x", actualSummator.Sum(nil)))
+
+	_, err = NewRawReader2(bytes.NewReader(compressedData), []byte{41})
+	require.ErrorIs(t, err, ErrIncorrectProperties)
+
+	_, err = NewRawReader2(bytes.NewReader(compressedData), nil)
+	require.ErrorIs(t, err, ErrIncorrectProperties)
+
+	_, err = NewRawReader2(bytes.NewReader(compressedData[:len(compressedData)-1]), []byte{EncodeDictSize2(DefaultDictSize)})
+	require.NoError(t, err)
+}
+
+func TestReader2Reset(t *testing.T) {
+	r := require.New(t)
+
+	compressedData, err := os.ReadFile("testassets/randomfile.dat.lzma2")
+	r.NoError(err)
+
+	data := bytes.Repeat([]byte("reset the reader "), 1000)
+
+	var buf bytes.Buffer
+
+	w, err := NewWriter2(&buf, DefaultDictSize)
+	r.NoError(err)
+	_, err = w.Write(data)
+	r.NoError(err)
+	r.NoError(w.Close())
+
+	reader, err := NewReader2(bytes.NewReader(compressedData), DefaultDictSize)
+	r.NoError(err)
+
+	_, err = reader.Read(make([]byte, 100))
+	r.NoError(err)
+
+	r.NoError(reader.Reset(bytes.NewReader(buf.Bytes())))
+
+	actual, err := io.ReadAll(reader)
+	r.NoError(err)
+	r.Equal(data, actual)
+
+	r.NoError(reader.Reset(bytes.NewReader(compressedData)))
+
+	actualSummator := md5.New()
+	_, err = io.Copy(actualSummator, reader)
+	r.NoError(err)
+	r.Equal(randomFileMD5, fmt.Sprintf("%x", actualSummator.Sum(nil)))
+
+	r.ErrorIs(reader.Reset(bytes.NewReader(nil)), io.ErrUnexpectedEOF)
+}
+
 // goos: darwin
 // goarch: amd64
 // pkg: github.com/kulaginds/lzma
@@ -0,0 +1,397 @@
+package lzma
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"iter"
+	"math"
+	"math/bits"
+)
+
+// Match is the compressed stream found by Scan.
+type Match struct {
+	// Offset is the offset of the stream in the input.
+	Offset int64
+	Format Format
+	// Properties are the properties of .lzma header, of the first LZMA
+	// chunk of LZMA2 stream without the dictionary size, which it does not
+	// store, and of .lz member.
+	Properties Properties
+	// UnpackSize is the unpack size of .lzma header, otherwise it is
+	// UnpackSizeUnknown.
+	UnpackSize uint64
+	// Decoded and Consumed are the lengths of the decoded data and of the
+	// stream with its header. They cover the whole stream if Complete is
+	// set, otherwise the decoded prefix. They are zero for .xz, which is
+	// found by the stream header only.
+	Decoded  int64
+	Consumed int64
+	Complete bool
+}
+
+// Scan finds the compressed streams embedded into r, as in firmware images,
+// and yields them in the order of the offsets. The candidates are .lzma
+// headers with plausible properties, dictionary and unpack sizes, raw LZMA2
+// chunk sequences ending with the end marker, .xz stream headers and .lz
+// member headers; .lzma, LZMA2 and .lz candidates are confirmed by decoding
+// up to 64 KiB. The scan continues after the confirmed stream, the streams
+// inside .xz are found as LZMA2. The read error of r is yielded after the
+// matches in the data read before it and stops the iteration.
+func Scan(r io.ReaderAt) iter.Seq2[Match, error] {
+	return func(yield func(Match, error) bool) {
+		s := &scanner{r: r, out: make([]byte, scanTrialLen)}
+		buf := make([]byte, scanBufLen)
+
+		var off int64
+
+		for {
+			n, err := r.ReadAt(buf, off)
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+
+			eof := n < len(buf) || err != nil
+
+			// The positions with the whole header in buf are checked, the
+			// others are read again from the next offset.
+			limit := n
+			if !eof {
+				limit = n - scanHeadLen
+			}
+
+			next := off + int64(limit)
+
+			for i := 0; i < limit; i++ {
+				m, ok := s.match(off+int64(i), buf[i:n])
+				if !ok {
+					continue
+				}
+
+				if !yield(m, nil) {
+					return
+				}
+
+				if m.Consumed > 1 {
+					end := m.Offset + m.Consumed
+					if end >= off+int64(limit) {
+						next = end
+
+						break
+					}
+
+					i += int(m.Consumed) - 1
+				}
+			}
+
+			if err != nil {
+				yield(Match{}, err)
+
+				return
+			}
+
+			if eof {
+				return
+			}
+
+			off = next
+		}
+	}
+}
+
+const (
+	// scanBufLen is the size of the input read at once.
+	scanBufLen = 64 << 10
+	// scanHeadLen is the longest header checked by Scan: .lzma header and
+	// the first byte of the range coder.
+	scanHeadLen = sniffLen
+	// scanTrialLen is the number of bytes decoded to confirm the stream.
+	scanTrialLen = 64 << 10
+)
+
+// Headers of .xz stream and .lz member.
+const (
+	xzMagic         = "\xFD7zXZ\x00"
+	xzHeaderLen     = 12
+	lzipMagic       = "LZIP"
+	lzipHeaderLen   = 6
+	lzipTrailerLen  = 20
+	lzipDictSizeMin = 1 << 12
+	lzipDictSizeMax = 1 << 29
+)
+
+type scanner struct {
+	r   io.ReaderAt
+	out []byte
+}
+
+// match checks the candidates at off, head is the input from off.
+func (s *scanner) match(off int64, head []byte) (Match, bool) {
+	switch head[0] {
+	case xzMagic[0]:
+		if isXZHeader(head) {
+			return Match{Offset: off, Format: FormatXZ, UnpackSize: UnpackSizeUnknown}, true
+		}
+	case lzipMagic[0]:
+		if m, ok := s.matchLzip(off, head); ok {
+			return m, true
+		}
+	}
+
+	if isLZMAHeader(head) && isScanDictSize(binary.LittleEndian.Uint32(head[1:])) {
+		if m, ok := s.matchLZMA(off, head); ok {
+			return m, true
+		}
+	}
+
+	if isLZMA2Chunk(head) {
+		return s.matchLZMA2(off)
+	}
+
+	return Match{}, false
+}
+
+// isScanDictSize reports whether the dictionary size of .lzma header is
+// written by the known encoders: 2^n or 3*2^n as liblzma rounds it, or the
+// multiple of 1 MiB as LZMA SDK does, up to 1.5 GiB.
+func isScanDictSize(dictSize uint32) bool {
+	if dictSize < lzmaDicMin || dictSize > 3<<29 {
+		return false
+	}
+
+	if n := dictSize >> bits.TrailingZeros32(dictSize); n == 1 || n == 3 {
+		return true
+	}
+
+	return dictSize%(1<<20) == 0
+}
+
+// isXZHeader reports whether head starts with .xz stream header with valid
+// flags and their CRC32.
+func isXZHeader(head []byte) bool {
+	if len(head) < xzHeaderLen || string(head[:len(xzMagic)]) != xzMagic {
+		return false
+	}
+
+	flags := head[len(xzMagic) : len(xzMagic)+2]
+	if flags[0] != 0 || flags[1] > 0x0F {
+		return false
+	}
+
+	return crc32.ChecksumIEEE(flags) == binary.LittleEndian.Uint32(head[len(xzMagic)+2:])
+}
+
+func (s *scanner) matchLzip(off int64, head []byte) (Match, bool) {
+	if len(head) < lzipHeaderLen+1 || string(head[:len(lzipMagic)]) != lzipMagic || head[4] > 1 {
+		return Match{}, false
+	}
+
+	b := head[5]
+	dictSize := uint32(1) << (b & 0x1F)
+	dictSize -= (dictSize / 16) * uint32(b>>5)
+
+	if b&0x1F > 29 || dictSize < lzipDictSizeMin || dictSize > lzipDictSizeMax || head[lzipHeaderLen] != 0 {
+		return Match{}, false
+	}
+
+	m := Match{
+		Offset:     off,
+		Format:     FormatLzip,
+		Properties: Properties{LC: 3, LP: 0, PB: 2, DictSize: dictSize},
+		UnpackSize: UnpackSizeUnknown,
+	}
+
+	ok := s.trial1(off+lzipHeaderLen, &m, EndMarkerRequired)
+	if !ok {
+		return Match{}, false
+	}
+
+	m.Consumed += lzipHeaderLen
+	if m.Complete {
+		m.Consumed += lzipTrailerLen
+	}
+
+	return m, true
+}
+
+func (s *scanner) matchLZMA(off int64, head []byte) (Match, bool) {
+	props, err := DecodeProperties(head[:LZMAPropsLen])
+	if err != nil {
+		return Match{}, false
+	}
+
+	m := Match{
+		Offset:     off,
+		Format:     FormatLZMA,
+		Properties: props,
+		UnpackSize: DecodeUnpackSize(head[LZMAPropsLen:]),
+	}
+
+	ok := s.trial1(off+LZMAHeaderLen, &m, EndMarkerOptional)
+	if !ok {
+		return Match{}, false
+	}
+
+	m.Consumed += LZMAHeaderLen
+
+	return m, true
+}
+
+// trial1 decodes the prefix of LZMA stream at off with the properties and
+// the unpack size of m and sets the lengths. The window is limited by the
+// decoded length, so the dictionary size of the header is not allocated.
+func (s *scanner) trial1(off int64, m *Match, endMarker EndMarker) bool {
+	props := m.Properties
+	if props.DictSize > scanTrialLen {
+		props.DictSize = scanTrialLen
+	}
+
+	in := &countingByteReader{r: bufio.NewReader(io.NewSectionReader(s.r, off, math.MaxInt64-off))}
+
+	r, err := NewRawReader1(in, props, m.UnpackSize, endMarker)
+	if err != nil {
+		return false
+	}
+
+	decoded, complete, ok := s.trial(r)
+	if !ok {
+		return false
+	}
+
+	m.Decoded, m.Consumed, m.Complete = decoded, in.n, complete
+
+	return true
+}
+
+// trial reads up to scanTrialLen bytes of r and reports whether the data is
+// read without error and the stream ended.
+func (s *scanner) trial(r io.Reader) (int64, bool, bool) {
+	var decoded int
+
+	for decoded < len(s.out) {
+		n, err := r.Read(s.out[decoded:])
+		decoded += n
+
+		if errors.Is(err, io.EOF) {
+			return int64(decoded), true, decoded > 0
+		}
+
+		if err != nil {
+			return 0, false, false
+		}
+	}
+
+	return int64(decoded), false, true
+}
+
+// matchLZMA2 walks the chunk headers of LZMA2 stream at off up to the end
+// marker and decodes its prefix. The first chunk resets the dictionary, the
+// first LZMA chunk sets the properties and at least one chunk is LZMA.
+func (s *scanner) matchLZMA2(off int64) (Match, bool) {
+	m := Match{Offset: off, Format: FormatLZMA2, UnpackSize: UnpackSizeUnknown}
+
+	var (
+		head      [7]byte
+		pos       = off
+		needProps = true
+		lzma      = false
+	)
+
+	for {
+		n, _ := s.r.ReadAt(head[:], pos)
+		if n == 0 {
+			return Match{}, false
+		}
+
+		control := head[0]
+
+		if control == endOfStreamCode {
+			pos++
+
+			break
+		}
+
+		switch typ := decodeChunkType(control); typ {
+		case chunkUncompressedResetDict, chunkUncompressedNoResetDict:
+			if n < 3 {
+				return Match{}, false
+			}
+
+			size := int64(binary.BigEndian.Uint16(head[1:])) + 1
+			m.Decoded += size
+			pos += 3 + size
+		default:
+			if control < 0x80 || n < 7 {
+				return Match{}, false
+			}
+
+			headerLen := chunkLength(typ)
+
+			if headerLen == 6 {
+				lc, pb, lp, err := DecodeProp(head[5])
+				if err != nil || lc+lp > 4 {
+					return Match{}, false
+				}
+
+				if needProps {
+					m.Properties = Properties{LC: lc, LP: lp, PB: pb}
+				}
+
+				needProps = false
+			}
+
+			if needProps || head[headerLen] != 0 {
+				return Match{}, false
+			}
+
+			lzma = true
+			unpacked := int64(control&maskLZMAUncompressedSize)<<16 | int64(binary.BigEndian.Uint16(head[1:])) + 1
+			packed := int64(binary.BigEndian.Uint16(head[3:])) + 1
+			m.Decoded += unpacked
+			pos += int64(headerLen) + packed
+		}
+	}
+
+	if !lzma {
+		return Match{}, false
+	}
+
+	m.Consumed = pos - off
+	m.Complete = true
+
+	r, err := NewReader2(io.NewSectionReader(s.r, off, m.Consumed), scanTrialLen)
+	if err != nil {
+		return Match{}, false
+	}
+
+	decoded, complete, ok := s.trial(r)
+	if !ok || complete && decoded != m.Decoded {
+		return Match{}, false
+	}
+
+	return m, true
+}
+
+// countingByteReader counts the bytes read by the range decoder.
+type countingByteReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingByteReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+
+	return b, err
+}
+
+func (c *countingByteReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+
+	return n, err
+}
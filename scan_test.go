@@ -0,0 +1,218 @@
+package lzma
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// scanImage builds the image of the files separated by random data as the
+// firmware and returns the offsets of the files.
+func scanImage(t *testing.T, names ...string) ([]byte, []int64) {
+	t.Helper()
+
+	rnd := rand.New(rand.NewSource(1))
+
+	var (
+		image   []byte
+		offsets []int64
+	)
+
+	for _, name := range names {
+		noise := make([]byte, 70000)
+		rnd.Read(noise)
+		image = append(image, noise...)
+
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+
+		offsets = append(offsets, int64(len(image)))
+		image = append(image, data...)
+	}
+
+	return image, offsets
+}
+
+func scanAll(t *testing.T, data []byte) []Match {
+	t.Helper()
+
+	var matches []Match
+
+	for m, err := range Scan(bytes.NewReader(data)) {
+		require.NoError(t, err)
+
+		matches = append(matches, m)
+	}
+
+	return matches
+}
+
+func TestScan(t *testing.T) {
+	image, offsets := scanImage(t,
+		"testassets/a.lzma",
+		"testassets/a_eos.lzma",
+		"testassets/x86.lzma2",
+		"xz/testassets/a.xz",
+		"lzip/testassets/a.lz",
+		"testassets/randomfile.dat.lzma",
+	)
+
+	props := Properties{LC: 3, LP: 0, PB: 2}
+	props64K := Properties{LC: 3, LP: 0, PB: 2, DictSize: 1 << 16}
+	props8M := Properties{LC: 3, LP: 0, PB: 2, DictSize: 1 << 23}
+
+	expected := []Match{
+		{Offset: offsets[0], Format: FormatLZMA, Properties: props8M, UnpackSize: 327, Decoded: 327, Consumed: 117, Complete: true},
+		{Offset: offsets[1], Format: FormatLZMA, Properties: props64K, UnpackSize: UnpackSizeUnknown, Decoded: 327, Consumed: 122, Complete: true},
+		{Offset: offsets[2], Format: FormatLZMA2, Properties: props, UnpackSize: UnpackSizeUnknown, Decoded: 16384, Consumed: 11348, Complete: true},
+		{Offset: offsets[3], Format: FormatXZ, UnpackSize: UnpackSizeUnknown},
+		// LZMA2 data of the block after the stream and block headers.
+		{Offset: offsets[3] + 32, Format: FormatLZMA2, Properties: props, UnpackSize: UnpackSizeUnknown, Decoded: 327, Consumed: 111, Complete: true},
+		{Offset: offsets[4], Format: FormatLzip, Properties: props64K, UnpackSize: UnpackSizeUnknown, Decoded: 327, Consumed: 135, Complete: true},
+		// Only the prefix is decoded.
+		{Offset: offsets[5], Format: FormatLZMA, Properties: props8M, UnpackSize: UnpackSizeUnknown, Decoded: scanTrialLen, Consumed: 66456},
+	}
+
+	require.Equal(t, expected, scanAll(t, image))
+}
+
+func TestScanCandidates(t *testing.T) {
+	a, err := os.ReadFile("testassets/a.lzma")
+	require.NoError(t, err)
+
+	x86, err := os.ReadFile("testassets/x86.lzma2")
+	require.NoError(t, err)
+
+	xz, err := os.ReadFile("xz/testassets/a.xz")
+	require.NoError(t, err)
+
+	lz, err := os.ReadFile("lzip/testassets/a.lz")
+	require.NoError(t, err)
+
+	withByte := func(data []byte, i int, b byte) []byte {
+		data = bytes.Clone(data)
+		data[i] = b
+
+		return data
+	}
+
+	oddDict := bytes.Clone(a)
+	binary.LittleEndian.PutUint32(oddDict[1:], 5<<13+1)
+
+	megabytes := bytes.Clone(a)
+	binary.LittleEndian.PutUint32(megabytes[1:], 5<<20)
+
+	testCases := []struct {
+		name    string
+		data    []byte
+		formats []Format
+	}{
+		{name: "lzma", data: a, formats: []Format{FormatLZMA}},
+		{name: "lzma dictionary of LZMA SDK", data: megabytes, formats: []Format{FormatLZMA}},
+		{name: "lzma odd dictionary", data: oddDict},
+		{name: "lzma invalid properties", data: withByte(a, 0, 225)},
+		{name: "lzma corrupted", data: withByte(a, 20, a[20]^0xFF)},
+		{name: "lzma truncated", data: a[:len(a)-10]},
+		{name: "lzma2", data: x86, formats: []Format{FormatLZMA2}},
+		{name: "lzma2 without end marker", data: x86[:len(x86)-1]},
+		{name: "lzma2 invalid control", data: withByte(x86, len(x86)-1, 0x03)},
+		{name: "xz", data: xz, formats: []Format{FormatXZ, FormatLZMA2}},
+		{name: "xz invalid header CRC", data: withByte(xz, 8, xz[8]^1), formats: []Format{FormatLZMA2}},
+		{name: "lzip", data: lz, formats: []Format{FormatLzip}},
+		{name: "lzip invalid version", data: withByte(lz, 4, 2)},
+		{name: "lzip invalid dictionary", data: withByte(lz, 5, 30)},
+		{name: "empty"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var formats []Format
+
+			for _, m := range scanAll(t, tc.data) {
+				formats = append(formats, m.Format)
+			}
+
+			require.Equal(t, tc.formats, formats)
+		})
+	}
+}
+
+func TestScanWindowBoundary(t *testing.T) {
+	a, err := os.ReadFile("testassets/a.lzma")
+	require.NoError(t, err)
+
+	for _, offset := range []int{scanBufLen - scanHeadLen - 1, scanBufLen - scanHeadLen, scanBufLen - 1, scanBufLen} {
+		data := append(make([]byte, offset), a...)
+
+		matches := scanAll(t, data)
+		require.Len(t, matches, 1, offset)
+		require.Equal(t, int64(offset), matches[0].Offset)
+		require.True(t, matches[0].Complete)
+	}
+}
+
+func TestScanBreak(t *testing.T) {
+	image, offsets := scanImage(t, "testassets/a.lzma", "testassets/a.lzma")
+
+	var matches []Match
+
+	for m, err := range Scan(bytes.NewReader(image)) {
+		require.NoError(t, err)
+
+		matches = append(matches, m)
+
+		break
+	}
+
+	require.Len(t, matches, 1)
+	require.Equal(t, offsets[0], matches[0].Offset)
+}
+
+// errReaderAt fails to read past the end of data.
+type errReaderAt struct {
+	data []byte
+	err  error
+}
+
+func (r errReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(r.data)) {
+		return 0, r.err
+	}
+
+	n := copy(p, r.data[off:])
+	if n < len(p) {
+		return n, r.err
+	}
+
+	return n, nil
+}
+
+func TestScanReadError(t *testing.T) {
+	image, offsets := scanImage(t, "testassets/a.lzma")
+
+	errRead := errors.New("read error")
+
+	var (
+		matches []Match
+		errs    []error
+	)
+
+	for m, err := range Scan(errReaderAt{data: image, err: errRead}) {
+		if err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		matches = append(matches, m)
+	}
+
+	require.Len(t, matches, 1)
+	require.Equal(t, offsets[0], matches[0].Offset)
+	require.Equal(t, []error{errRead}, errs)
+}
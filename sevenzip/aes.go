@@ -0,0 +1,304 @@
+package sevenzip
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"unicode/utf16"
+)
+
+const methodAES = "\x06\xF1\x07\x01"
+
+const (
+	// aesCyclesMax is the limit of the key derivation rounds of 7-Zip,
+	// aesCyclesRaw means the key is made of the salt and the password.
+	aesCyclesMax = 24
+	aesCyclesRaw = 0x3F
+
+	// aesCycles is the number of key derivation rounds of 7-Zip as the power
+	// of two.
+	aesCycles = 19
+)
+
+// passworder is implemented by the decoders which need the password.
+type passworder interface {
+	Password(password string) error
+}
+
+// aesProps are the properties of 7zAES coder.
+type aesProps struct {
+	cycles int
+	salt   []byte
+	iv     [aes.BlockSize]byte
+}
+
+func parseAESProps(props []byte) (aesProps, error) {
+	var p aesProps
+
+	if len(props) == 0 {
+		return p, fmt.Errorf("%w: AES properties", ErrCorrupted)
+	}
+
+	p.cycles = int(props[0] & 0x3F)
+	if p.cycles > aesCyclesMax && p.cycles != aesCyclesRaw {
+		return p, fmt.Errorf("%w: AES with 2^%d rounds", ErrUnsupportedMethod, p.cycles)
+	}
+
+	if props[0]&0xC0 == 0 {
+		if len(props) != 1 {
+			return p, fmt.Errorf("%w: AES properties", ErrCorrupted)
+		}
+
+		return p, nil
+	}
+
+	if len(props) < 2 {
+		return p, fmt.Errorf("%w: AES properties", ErrCorrupted)
+	}
+
+	saltSize := int(props[0]>>7&1) + int(props[1]>>4)
+	ivSize := int(props[0]>>6&1) + int(props[1]&0x0F)
+
+	if len(props) != 2+saltSize+ivSize {
+		return p, fmt.Errorf("%w: AES properties", ErrCorrupted)
+	}
+
+	p.salt = props[2 : 2+saltSize]
+	copy(p.iv[:], props[2+saltSize:])
+
+	return p, nil
+}
+
+// encode returns the properties with the IV of 16 bytes and no salt, as
+// 7-Zip writes them.
+func (p aesProps) encode() []byte {
+	props := []byte{byte(p.cycles) | 0x40, aes.BlockSize - 1}
+
+	return append(props, p.iv[:]...)
+}
+
+// keyCache keeps the derived keys, the derivation takes 2^19 rounds of
+// SHA-256 and the key is the same for all folders of the archive. The keys
+// are looked up by the hash of the inputs, so the passwords are not kept.
+var keyCache = struct {
+	sync.Mutex
+	keys map[[sha256.Size]byte][]byte
+}{keys: make(map[[sha256.Size]byte][]byte)}
+
+const keyCacheMax = 32
+
+// deriveKey computes AES-256 key from the password as 7-Zip does.
+func deriveKey(password string, salt []byte, cycles int) []byte {
+	pw := make([]byte, 0, 2*len(password))
+	for _, c := range utf16.Encode([]rune(password)) {
+		pw = binary.LittleEndian.AppendUint16(pw, c)
+	}
+
+	cacheKey := keyCacheKey(cycles, salt, pw)
+
+	keyCache.Lock()
+	key, ok := keyCache.keys[cacheKey]
+	keyCache.Unlock()
+
+	if ok {
+		return key
+	}
+
+	if cycles == aesCyclesRaw {
+		key = make([]byte, 32)
+		n := copy(key, salt)
+		copy(key[n:], pw)
+	} else {
+		buf := make([]byte, 0, len(salt)+len(pw)+8)
+		buf = append(append(buf, salt...), pw...)
+		buf = append(buf, make([]byte, 8)...)
+		counter := buf[len(buf)-8:]
+
+		h := sha256.New()
+		for i := uint64(0); i < 1<<cycles; i++ {
+			binary.LittleEndian.PutUint64(counter, i)
+			_, _ = h.Write(buf)
+		}
+
+		key = h.Sum(nil)
+	}
+
+	keyCache.Lock()
+	if len(keyCache.keys) >= keyCacheMax {
+		keyCache.keys = make(map[[sha256.Size]byte][]byte)
+	}
+	keyCache.keys[cacheKey] = key
+	keyCache.Unlock()
+
+	return key
+}
+
+// keyCacheKey returns the key of keyCache for the inputs of deriveKey.
+func keyCacheKey(cycles int, salt, pw []byte) [sha256.Size]byte {
+	h := sha256.New()
+	_, _ = h.Write([]byte{byte(cycles), byte(len(salt))})
+	_, _ = h.Write(salt)
+	_, _ = h.Write(pw)
+
+	var key [sha256.Size]byte
+	h.Sum(key[:0])
+
+	return key
+}
+
+var errNoPassword = errors.New("sevenzip: password is not set")
+
+// aesReader decrypts 7zAES stream.
+type aesReader struct {
+	props    aesProps
+	inStream io.ReadCloser
+	r        io.Reader
+	mode     cipher.BlockMode
+
+	buf   []byte
+	start int
+	end   int
+}
+
+// NewAESDecompressor creates the decoder of 7zAES method: AES-256-CBC with
+// the key derived from the password by iterated SHA-256. The signature
+// matches the decompressors of github.com/bodgit/sevenzip, the returned
+// reader has method Password(string) error which must be called before the
+// first Read.
+func NewAESDecompressor(props []byte, unpackSize uint64, readers []io.ReadCloser) (io.ReadCloser, error) {
+	if len(readers) != 1 {
+		return nil, fmt.Errorf("%w: AES needs one input", ErrCorrupted)
+	}
+
+	p, err := parseAESProps(props)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &aesReader{
+		props:    p,
+		inStream: readers[0],
+		buf:      make([]byte, 4096),
+	}
+	r.r = io.LimitReader(readerFunc(r.read), int64(unpackSize))
+
+	return r, nil
+}
+
+// Password derives the key from the password.
+func (r *aesReader) Password(password string) error {
+	block, err := aes.NewCipher(deriveKey(password, r.props.salt, r.props.cycles))
+	if err != nil {
+		return err
+	}
+
+	r.mode = cipher.NewCBCDecrypter(block, r.props.iv[:])
+
+	return nil
+}
+
+func (r *aesReader) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
+
+func (r *aesReader) read(p []byte) (int, error) {
+	if r.mode == nil {
+		return 0, errNoPassword
+	}
+
+	if r.start == r.end {
+		n, err := io.ReadFull(r.inStream, r.buf)
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = nil
+		}
+
+		if n%aes.BlockSize != 0 {
+			return 0, fmt.Errorf("%w: AES stream is not aligned", ErrCorrupted)
+		}
+
+		if n == 0 {
+			return 0, err
+		}
+
+		r.mode.CryptBlocks(r.buf[:n], r.buf[:n])
+		r.start, r.end = 0, n
+	}
+
+	n := copy(p, r.buf[r.start:r.end])
+	r.start += n
+
+	return n, nil
+}
+
+func (r *aesReader) Close() error {
+	return r.inStream.Close()
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
+
+// aesWriter encrypts 7zAES stream, the last block is padded by zeros.
+type aesWriter struct {
+	outStream io.Writer
+	mode      cipher.BlockMode
+
+	buf []byte
+	n   int
+}
+
+func newAESWriter(outStream io.Writer, key []byte, iv []byte) (*aesWriter, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &aesWriter{
+		outStream: outStream,
+		mode:      cipher.NewCBCEncrypter(block, iv),
+		buf:       make([]byte, 4096),
+	}, nil
+}
+
+func (w *aesWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		k := copy(w.buf[w.n:], p)
+		w.n += k
+		n += k
+		p = p[k:]
+
+		if w.n == len(w.buf) {
+			err = w.flush()
+			if err != nil {
+				return n, err
+			}
+		}
+	}
+
+	return n, nil
+}
+
+func (w *aesWriter) flush() error {
+	w.mode.CryptBlocks(w.buf[:w.n], w.buf[:w.n])
+
+	_, err := w.outStream.Write(w.buf[:w.n])
+	w.n = 0
+
+	return err
+}
+
+// Close pads and writes the last block. It does not close the underlying
+// writer.
+func (w *aesWriter) Close() error {
+	for w.n%aes.BlockSize != 0 {
+		w.buf[w.n] = 0
+		w.n++
+	}
+
+	return w.flush()
+}
@@ -0,0 +1,245 @@
+package sevenzip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaderPassword(t *testing.T) {
+	r := require.New(t)
+
+	expected := map[string]string{
+		"bar": "c157a79031e1c40f85931829bc5fc552",
+		"foo": "d3b07384d113edec49eaa6238ad5ff00",
+	}
+
+	testCases := []struct {
+		name string
+
+		inputFile string
+		password  string
+
+		checkErr1 func(err error, msgAndArgs ...interface{})
+		checkErr2 func(err error, msgAndArgs ...interface{})
+	}{
+		{
+			name:      "encrypted_header",
+			inputFile: "testassets/t2.7z",
+			password:  "password",
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "encrypted_header_copy",
+			inputFile: "testassets/t3.7z",
+			password:  "password",
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "encrypted_files",
+			inputFile: "testassets/t4.7z",
+			password:  "password",
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "encrypted_files_copy",
+			inputFile: "testassets/t5.7z",
+			password:  "password",
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "encrypted_header_wrong_password",
+			inputFile: "testassets/t2.7z",
+			password:  "notpassword",
+			checkErr1: r.Error,
+		},
+		{
+			name:      "encrypted_header_no_password",
+			inputFile: "testassets/t3.7z",
+			checkErr1: r.Error,
+		},
+		{
+			name:      "encrypted_files_wrong_password",
+			inputFile: "testassets/t4.7z",
+			password:  "notpassword",
+			checkErr1: r.NoError,
+			checkErr2: r.Error,
+		},
+		{
+			name:      "encrypted_files_copy_wrong_password",
+			inputFile: "testassets/t5.7z",
+			password:  "notpassword",
+			checkErr1: r.NoError,
+			checkErr2: r.Error,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			archive, err := OpenReaderWithPassword(tc.inputFile, tc.password)
+			tc.checkErr1(err)
+			if err != nil {
+				r.ErrorIs(err, ErrWrongPassword)
+
+				return
+			}
+			defer archive.Close()
+
+			actual := make(map[string]string)
+
+			for _, f := range archive.File {
+				sum, err := fileMD5(f)
+				tc.checkErr2(err)
+				if err != nil {
+					r.ErrorIs(err, ErrWrongPassword)
+
+					return
+				}
+
+				actual[f.Name] = sum
+			}
+
+			r.Equal(expected, actual)
+		})
+	}
+}
+
+func TestWriterPassword(t *testing.T) {
+	files := testFiles()
+
+	testCases := []struct {
+		name string
+
+		cfg WriterConfig
+	}{
+		{
+			name: "lzma2_solid",
+			cfg:  WriterConfig{Method: MethodLZMA2, Solid: true, Password: "secret"},
+		},
+		{
+			name: "lzma_non_solid",
+			cfg:  WriterConfig{Method: MethodLZMA, DictSize: 1 << 16, Password: "secret"},
+		},
+		{
+			name: "copy_encrypted_header",
+			cfg:  WriterConfig{Method: MethodCopy, Password: "пароль", EncryptHeader: true},
+		},
+		{
+			name: "lzma2_encrypted_header",
+			cfg:  WriterConfig{Method: MethodLZMA2, Solid: true, Password: "secret", EncryptHeader: true},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			archive := writeArchive(t, tc.cfg, files)
+
+			// the data is not stored in plain
+			r.False(bytes.Contains(archive, []byte("#!/bin/sh")))
+
+			reader, err := NewReaderWithPassword(bytes.NewReader(archive), int64(len(archive)), tc.cfg.Password)
+			r.NoError(err)
+			r.Len(reader.File, len(files))
+
+			for i, f := range reader.File {
+				r.Equal(int64(len(files[i].data)), f.Size, f.Name)
+
+				rc, err := f.Open()
+				r.NoError(err)
+
+				actual, err := io.ReadAll(rc)
+				r.NoError(err)
+				r.True(bytes.Equal(files[i].data, actual), f.Name)
+			}
+
+			reader, err = NewReaderWithPassword(bytes.NewReader(archive), int64(len(archive)), "wrong")
+			if tc.cfg.EncryptHeader {
+				r.ErrorIs(err, ErrWrongPassword)
+
+				return
+			}
+
+			r.NoError(err)
+
+			_, err = fileMD5(reader.File[1])
+			r.ErrorIs(err, ErrWrongPassword)
+		})
+	}
+}
+
+func TestWriterEncryptHeaderWithoutPassword(t *testing.T) {
+	_, err := NewWriterConfig(&seekBuffer{}, WriterConfig{Method: MethodLZMA2, EncryptHeader: true})
+	require.Error(t, err)
+}
+
+// failingReaderAt fails to read the data after the header is read.
+type failingReaderAt struct {
+	r    io.ReaderAt
+	fail bool
+}
+
+var errRead = errors.New("read error")
+
+func (r *failingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if r.fail {
+		return 0, errRead
+	}
+
+	return r.r.ReadAt(p, off)
+}
+
+func TestReaderPasswordCorrupted(t *testing.T) {
+	for _, inputFile := range []string{"testassets/t4.7z", "testassets/t5.7z"} {
+		t.Run(inputFile, func(t *testing.T) {
+			r := require.New(t)
+
+			data, err := os.ReadFile(inputFile)
+			r.NoError(err)
+
+			// The errors of the input are not told as wrong password.
+			input := &failingReaderAt{r: bytes.NewReader(data)}
+
+			archive, err := NewReaderWithPassword(input, int64(len(data)), "password")
+			r.NoError(err)
+
+			input.fail = true
+
+			_, err = fileMD5(archive.File[0])
+			r.ErrorIs(err, errRead)
+			r.NotErrorIs(err, ErrWrongPassword)
+
+			// The packed stream ends before the data.
+			archive, err = NewReaderWithPassword(bytes.NewReader(data), int64(len(data)), "password")
+			r.NoError(err)
+
+			archive.streams.packSizes[0] = 0
+
+			_, err = fileMD5(archive.File[0])
+			r.Error(err)
+			r.NotErrorIs(err, ErrWrongPassword)
+		})
+	}
+}
+
+func TestKeyCacheKey(t *testing.T) {
+	r := require.New(t)
+
+	salt := []byte{1, 2, 3}
+
+	key := keyCacheKey(aesCycles, salt, []byte("password"))
+	r.Equal(key, keyCacheKey(aesCycles, salt, []byte("password")))
+	r.NotEqual(key, keyCacheKey(aesCycles, salt, []byte("Password")))
+	r.NotEqual(key, keyCacheKey(aesCycles, salt[:2], []byte("\x03password")))
+	r.NotEqual(key, keyCacheKey(aesCycles+1, salt, []byte("password")))
+	r.NotContains(string(key[:]), "password")
+}
@@ -0,0 +1,272 @@
+package sevenzip
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/kulaginds/lzma"
+)
+
+// decoderFunc creates the decoder of a coder from its properties, the size of
+// its output and its input streams.
+type decoderFunc func(props []byte, unpackSize int64, inputs []io.Reader) (io.Reader, error)
+
+// decoderMethod is the decoder of a method and the number of its inputs,
+// which is checked when the folder is built.
+type decoderMethod struct {
+	newDecoder   decoderFunc
+	numInStreams int
+}
+
+// Method IDs of the coders which are not in the filter registry or need the
+// size of their output.
+const (
+	methodCopy  = "\x00"
+	methodLZMA  = "\x03\x01\x01"
+	methodLZMA2 = "\x21"
+	methodBCJ2  = "\x03\x03\x01\x1B"
+)
+
+// decoders are the coders decoded here, the filters are taken from the
+// registry of lzma.RegisterFilter.
+var decoders = map[string]decoderMethod{
+	methodCopy:  {newCopyDecoder, 1},
+	methodLZMA:  {newLZMADecoder, 1},
+	methodLZMA2: {newLZMA2Decoder, 1},
+	methodAES:   {newAESDecoder, 1},
+	methodBCJ2:  {newBCJ2Decoder, 4},
+}
+
+func newCopyDecoder(_ []byte, _ int64, inputs []io.Reader) (io.Reader, error) {
+	return inputs[0], nil
+}
+
+func newLZMADecoder(props []byte, unpackSize int64, inputs []io.Reader) (io.Reader, error) {
+	if len(props) != 5 {
+		return nil, fmt.Errorf("%w: LZMA properties", ErrCorrupted)
+	}
+
+	p, err := lzma.DecodeProperties(props)
+	if err != nil {
+		return nil, fmt.Errorf("%w: LZMA properties: %w", ErrCorrupted, err)
+	}
+
+	p.DictSize = decoderDictSize(p.DictSize, unpackSize)
+
+	return lzma.NewRawReader1(inputs[0], p, uint64(unpackSize), lzma.EndMarkerOptional)
+}
+
+func newLZMA2Decoder(props []byte, unpackSize int64, inputs []io.Reader) (io.Reader, error) {
+	if len(props) != 1 || props[0] > 40 {
+		return nil, fmt.Errorf("%w: LZMA2 properties", ErrCorrupted)
+	}
+
+	dictSize := uint32(0xFFFFFFFF)
+	if props[0] < 40 {
+		dictSize = lzma.DecodeDictSize2(props[0])
+	}
+
+	return lzma.NewReader2(inputs[0], int(decoderDictSize(dictSize, unpackSize)))
+}
+
+// decoderDictSize returns the dictionary size of the decoder, which does not
+// need to be larger than the output of the coder. It is at least 1, as
+// NewReader2 takes zero for its default size.
+func decoderDictSize(dictSize uint32, unpackSize int64) uint32 {
+	if unpackSize < int64(dictSize) {
+		return uint32(max(unpackSize, 1))
+	}
+
+	return dictSize
+}
+
+// registeredDecoder returns the decoder of single input method registered by
+// lzma.RegisterFilter.
+func registeredDecoder(id string) (decoderMethod, bool) {
+	f, ok := lzma.FilterByMethodID(id)
+	if !ok {
+		return decoderMethod{}, false
+	}
+
+	return decoderMethod{
+		newDecoder: func(props []byte, _ int64, inputs []io.Reader) (io.Reader, error) {
+			return f.Coder.NewReader(inputs[0], props)
+		},
+		numInStreams: 1,
+	}, true
+}
+
+// newBCJ2Decoder creates the decoder of BCJ2 coder whose inputs are the
+// main, call, jump and range coder streams.
+func newBCJ2Decoder(_ []byte, unpackSize int64, inputs []io.Reader) (io.Reader, error) {
+	return lzma.NewBCJ2Reader(inputs[0], inputs[1], inputs[2], inputs[3], uint64(unpackSize))
+}
+
+func newAESDecoder(props []byte, unpackSize int64, inputs []io.Reader) (io.Reader, error) {
+	return NewAESDecompressor(props, uint64(unpackSize), []io.ReadCloser{io.NopCloser(inputs[0])})
+}
+
+// newFolderReader builds the decoders of the folder which read the packed
+// streams from inStream starting at offset. The password is given to the
+// decoders which need it.
+func newFolderReader(inStream io.ReaderAt, offset int64, packSizes []int64, f *folder, password string) (io.Reader, error) {
+	packed := make([]io.Reader, len(f.packedStreams))
+	for i := range packed {
+		packed[i] = bufio.NewReader(io.NewSectionReader(inStream, offset, packSizes[i]))
+		offset += packSizes[i]
+	}
+
+	b := &folderBuilder{folder: f, packed: packed, password: password}
+
+	return b.outStream(f.mainOutStream(), 0)
+}
+
+type folderBuilder struct {
+	folder   *folder
+	packed   []io.Reader
+	password string
+}
+
+// outStream creates the decoder of the coder owning the out stream. The depth
+// protects from the cycles of the bind pairs.
+func (b *folderBuilder) outStream(outIndex, depth int) (io.Reader, error) {
+	if depth > len(b.folder.coders) {
+		return nil, fmt.Errorf("%w: cycle of coders", ErrCorrupted)
+	}
+
+	var firstIn, firstOut int
+
+	for _, c := range b.folder.coders {
+		if outIndex >= firstOut+c.numOutStreams {
+			firstIn += c.numInStreams
+			firstOut += c.numOutStreams
+
+			continue
+		}
+
+		if c.numOutStreams != 1 {
+			return nil, fmt.Errorf("%w: coder with %d outputs", ErrUnsupportedMethod, c.numOutStreams)
+		}
+
+		method, ok := decoders[string(c.id)]
+		if !ok {
+			method, ok = registeredDecoder(string(c.id))
+		}
+
+		if !ok {
+			return nil, fmt.Errorf("%w: %X", ErrUnsupportedMethod, c.id)
+		}
+
+		if c.numInStreams != method.numInStreams {
+			return nil, fmt.Errorf("%w: coder %X with %d inputs", ErrCorrupted, c.id, c.numInStreams)
+		}
+
+		inputs := make([]io.Reader, c.numInStreams)
+		decrypted := false
+
+		for i := range inputs {
+			in, err := b.inStream(firstIn+i, depth)
+			if err != nil {
+				return nil, err
+			}
+
+			if _, ok := in.(decryptedReader); ok {
+				decrypted = true
+			}
+
+			inputs[i] = in
+		}
+
+		unpackSize := b.folder.unpackSizes[outIndex]
+
+		r, err := method.newDecoder(c.props, unpackSize, inputs)
+		if err != nil {
+			if decrypted {
+				err = decryptedError(err)
+			}
+
+			return nil, err
+		}
+
+		if p, ok := r.(passworder); ok {
+			err = p.Password(b.password)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// Copy coder passes the decrypted data as is.
+		copied := decrypted && string(c.id) == methodCopy
+
+		if decrypted && !copied {
+			r = &passwordReader{r: r, left: unpackSize}
+		}
+
+		if string(c.id) == methodAES || copied {
+			return decryptedReader{io.LimitReader(r, unpackSize)}, nil
+		}
+
+		return io.LimitReader(r, unpackSize), nil
+	}
+
+	return nil, fmt.Errorf("%w: out stream %d", ErrCorrupted, outIndex)
+}
+
+// inStream returns the packed stream or the output of the bound coder.
+func (b *folderBuilder) inStream(inIndex, depth int) (io.Reader, error) {
+	if i := b.folder.findBindPairForInStream(inIndex); i >= 0 {
+		return b.outStream(b.folder.bindPairs[i].outIndex, depth+1)
+	}
+
+	for i, packed := range b.folder.packedStreams {
+		if packed == inIndex {
+			return b.packed[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: in stream %d", ErrCorrupted, inIndex)
+}
+
+// decryptedReader marks the output of 7zAES coder.
+type decryptedReader struct {
+	io.Reader
+}
+
+// passwordReader reports the failures of the decoder reading the decrypted
+// data as wrong password, as 7-Zip does: the decoder is the first check of
+// the key. The errors of the input are returned as is.
+type passwordReader struct {
+	r    io.Reader
+	left int64
+}
+
+func (r *passwordReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.left -= int64(n)
+
+	switch {
+	case errors.Is(err, io.EOF) && r.left > 0:
+		err = fmt.Errorf("%w: decoded data is too short", ErrWrongPassword)
+	case err != nil:
+		err = decryptedError(err)
+	}
+
+	return n, err
+}
+
+// decryptedError reports the error of the decoder as wrong password if the
+// decoder failed on the data or the properties in it.
+func decryptedError(err error) error {
+	switch {
+	case errors.Is(err, lzma.ErrCorrupted),
+		errors.Is(err, lzma.ErrIncorrectProperties),
+		errors.Is(err, lzma.ErrResultError),
+		errors.Is(err, lzma.ErrUnexpectedLZMA2Code),
+		errors.Is(err, lzma.ErrNoLZMAReader):
+		return fmt.Errorf("%w: %w", ErrWrongPassword, err)
+	}
+
+	return err
+}
@@ -0,0 +1,104 @@
+package sevenzip
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kulaginds/lzma"
+)
+
+func TestDecoderWindowSize(t *testing.T) {
+	data := bytes.Repeat([]byte("7z coder output "), 100)
+
+	var lzmaStream bytes.Buffer
+
+	w1, err := lzma.NewRawWriter1(&lzmaStream, lzma.DefaultProperties(), false)
+	require.NoError(t, err)
+
+	_, err = w1.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w1.Close())
+
+	// The properties claim 4 GiB dictionary.
+	lzmaProps := lzma.DefaultProperties().Encode()
+	binary.LittleEndian.PutUint32(lzmaProps[1:], 0xFFFFFFFF)
+
+	var lzma2Stream bytes.Buffer
+
+	w2, err := lzma.NewWriter2(&lzma2Stream, 1<<16)
+	require.NoError(t, err)
+
+	_, err = w2.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w2.Close())
+
+	testCases := []struct {
+		name   string
+		method string
+		props  []byte
+		stream []byte
+	}{
+		{name: "lzma", method: methodLZMA, props: lzmaProps, stream: lzmaStream.Bytes()},
+		{name: "lzma2", method: methodLZMA2, props: []byte{40}, stream: lzma2Stream.Bytes()},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			var before, after runtime.MemStats
+
+			runtime.ReadMemStats(&before)
+
+			input := bufio.NewReader(bytes.NewReader(tc.stream))
+
+			decoder, err := decoders[tc.method].newDecoder(tc.props, int64(len(data)), []io.Reader{input})
+			r.NoError(err)
+
+			actual, err := io.ReadAll(io.LimitReader(decoder, int64(len(data))))
+			r.NoError(err)
+			r.Equal(data, actual)
+
+			runtime.ReadMemStats(&after)
+
+			// The window is sized by the output of the coder.
+			r.Less(after.TotalAlloc-before.TotalAlloc, uint64(16<<20))
+		})
+	}
+}
+
+func TestFolderReaderInputs(t *testing.T) {
+	testCases := []struct {
+		name         string
+		id           string
+		numInStreams int
+	}{
+		{name: "lzma2 without inputs", id: methodLZMA2, numInStreams: 0},
+		{name: "copy with two inputs", id: methodCopy, numInStreams: 2},
+		{name: "bcj2 with one input", id: methodBCJ2, numInStreams: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &folder{
+				coders:      []coder{{id: []byte(tc.id), numInStreams: tc.numInStreams, numOutStreams: 1}},
+				unpackSizes: []int64{10},
+			}
+
+			packSizes := make([]int64, tc.numInStreams)
+			for i := range packSizes {
+				f.packedStreams = append(f.packedStreams, i)
+				packSizes[i] = 1
+			}
+
+			_, err := newFolderReader(bytes.NewReader(make([]byte, 10)), 0, packSizes, f, "")
+			require.ErrorIs(t, err, ErrCorrupted)
+		})
+	}
+}
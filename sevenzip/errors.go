@@ -0,0 +1,11 @@
+package sevenzip
+
+import "errors"
+
+var (
+	ErrFormat            = errors.New("sevenzip: not a valid 7z archive")
+	ErrCorrupted         = errors.New("sevenzip: corrupted")
+	ErrChecksum          = errors.New("sevenzip: checksum error")
+	ErrUnsupportedMethod = errors.New("sevenzip: unsupported compression method")
+	ErrWrongPassword     = errors.New("sevenzip: wrong password")
+)
@@ -0,0 +1,1506 @@
+package sevenzip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"math/bits"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	signature = "7z\xBC\xAF\x27\x1C"
+
+	signatureHeaderLen = 32
+	versionMajor       = 0
+	versionMinor       = 4
+)
+
+// Property IDs of the headers.
+const (
+	idEnd = iota
+	idHeader
+	idArchiveProperties
+	idAdditionalStreamsInfo
+	idMainStreamsInfo
+	idFilesInfo
+	idPackInfo
+	idUnpackInfo
+	idSubStreamsInfo
+	idSize
+	idCRC
+	idFolder
+	idCodersUnpackSize
+	idNumUnpackStream
+	idEmptyStream
+	idEmptyFile
+	idAnti
+	idName
+	idCTime
+	idATime
+	idMTime
+	idWinAttributes
+	idComment
+	idEncodedHeader
+	idStartPos
+	idDummy
+)
+
+// Limits protect from the allocations driven by corrupted headers.
+const (
+	numCodersMax  = 64
+	numStreamsMax = 64
+	propsSizeMax  = 1 << 16
+	headerSizeMax = 1 << 30
+)
+
+// Bits of the coder flags byte.
+const (
+	coderIDSizeMask  = 0x0F
+	coderComplex     = 0x10
+	coderHasProps    = 0x20
+	coderAlternative = 0x80
+)
+
+// Windows file attributes, the high 16 bits hold Unix mode when
+// attrUnixExtension is set.
+const (
+	attrReadOnly      = 0x01
+	attrDirectory     = 0x10
+	attrUnixExtension = 0x8000
+)
+
+// startHeader is the part of the signature header which locates the header.
+type startHeader struct {
+	nextHeaderOffset int64
+	nextHeaderSize   int64
+	nextHeaderCRC    uint32
+}
+
+func parseSignatureHeader(buf []byte) (startHeader, error) {
+	var h startHeader
+
+	if string(buf[:len(signature)]) != signature {
+		return h, ErrFormat
+	}
+
+	if buf[6] != versionMajor {
+		return h, fmt.Errorf("%w: version %d.%d", ErrFormat, buf[6], buf[7])
+	}
+
+	if crc32.ChecksumIEEE(buf[12:32]) != binary.LittleEndian.Uint32(buf[8:12]) {
+		return h, fmt.Errorf("%w: start header", ErrChecksum)
+	}
+
+	offset := binary.LittleEndian.Uint64(buf[12:20])
+	size := binary.LittleEndian.Uint64(buf[20:28])
+
+	if offset > math.MaxInt64/2 || size > headerSizeMax {
+		return h, fmt.Errorf("%w: start header", ErrCorrupted)
+	}
+
+	h.nextHeaderOffset = int64(offset)
+	h.nextHeaderSize = int64(size)
+	h.nextHeaderCRC = binary.LittleEndian.Uint32(buf[28:32])
+
+	return h, nil
+}
+
+// coder is a coder of the folder.
+type coder struct {
+	id            []byte
+	numInStreams  int
+	numOutStreams int
+	props         []byte
+}
+
+type bindPair struct {
+	inIndex  int
+	outIndex int
+}
+
+// folder is the graph of coders which produces the data of one or more files
+// from the packed streams.
+type folder struct {
+	coders        []coder
+	bindPairs     []bindPair
+	packedStreams []int
+	unpackSizes   []int64
+
+	hasCRC bool
+	crc    uint32
+}
+
+func (f *folder) numInStreams() int {
+	var n int
+	for _, c := range f.coders {
+		n += c.numInStreams
+	}
+
+	return n
+}
+
+func (f *folder) numOutStreams() int {
+	var n int
+	for _, c := range f.coders {
+		n += c.numOutStreams
+	}
+
+	return n
+}
+
+// mainOutStream returns the out stream which is not bound to any coder.
+func (f *folder) mainOutStream() int {
+	for i := 0; i < f.numOutStreams(); i++ {
+		if f.findBindPairForOutStream(i) < 0 {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (f *folder) findBindPairForInStream(inIndex int) int {
+	for i, bp := range f.bindPairs {
+		if bp.inIndex == inIndex {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (f *folder) findBindPairForOutStream(outIndex int) int {
+	for i, bp := range f.bindPairs {
+		if bp.outIndex == outIndex {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// unpackSize returns the size of the folder output.
+func (f *folder) unpackSize() int64 {
+	i := f.mainOutStream()
+	if i < 0 {
+		return 0
+	}
+
+	return f.unpackSizes[i]
+}
+
+// streamsInfo holds the packed streams, the folders and the substreams.
+type streamsInfo struct {
+	packPos   int64
+	packSizes []int64
+	folders   []*folder
+
+	// numUnpackStreams is the number of substreams of each folder,
+	// substreams hold the sizes and CRCs of all of them.
+	numUnpackStreams []int
+	substreams       []substream
+}
+
+type substream struct {
+	size   int64
+	hasCRC bool
+	crc    uint32
+}
+
+// packOffset returns the offset of the first packed stream of the folder
+// relative to the end of the signature header.
+func (s *streamsInfo) packOffset(folderIndex int) (int64, int) {
+	offset := s.packPos
+	first := 0
+
+	for i := 0; i < folderIndex; i++ {
+		for range s.folders[i].packedStreams {
+			offset += s.packSizes[first]
+			first++
+		}
+	}
+
+	return offset, first
+}
+
+// fileEntry is a file of the archive as stored in the header.
+type fileEntry struct {
+	name        string
+	hasStream   bool
+	isDir       bool
+	isAnti      bool
+	attrib      uint32
+	hasAttrib   bool
+	modified    time.Time
+	created     time.Time
+	accessed    time.Time
+	hasModified bool
+}
+
+// header is the decoded archive header.
+type header struct {
+	streams *streamsInfo
+	files   []fileEntry
+}
+
+// headerReader reads the fields of the header.
+type headerReader struct {
+	*bytes.Reader
+}
+
+func newHeaderReader(buf []byte) *headerReader {
+	return &headerReader{Reader: bytes.NewReader(buf)}
+}
+
+func (r *headerReader) readByte() (byte, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, fmt.Errorf("%w: header is truncated", ErrCorrupted)
+	}
+
+	return b, nil
+}
+
+// readNumber reads the variable length integer: the count of the leading one
+// bits of the first byte is the number of the following bytes.
+func (r *headerReader) readNumber() (uint64, error) {
+	first, err := r.readByte()
+	if err != nil {
+		return 0, err
+	}
+
+	n := bits.LeadingZeros8(^first)
+	value := uint64(0)
+
+	for i := 0; i < n; i++ {
+		b, err := r.readByte()
+		if err != nil {
+			return 0, err
+		}
+
+		value |= uint64(b) << (8 * i)
+	}
+
+	if n < 8 {
+		value |= uint64(first&(0xFF>>(n+1))) << (8 * n)
+	}
+
+	return value, nil
+}
+
+// readInt reads the number which must not exceed limit.
+func (r *headerReader) readInt(limit int) (int, error) {
+	v, err := r.readNumber()
+	if err != nil {
+		return 0, err
+	}
+
+	if v > uint64(limit) {
+		return 0, fmt.Errorf("%w: number is too large", ErrCorrupted)
+	}
+
+	return int(v), nil
+}
+
+// readSize reads the size of a stream.
+func (r *headerReader) readSize() (int64, error) {
+	v, err := r.readNumber()
+	if err != nil {
+		return 0, err
+	}
+
+	if v > math.MaxInt64/2 {
+		return 0, fmt.Errorf("%w: size is too large", ErrCorrupted)
+	}
+
+	return int64(v), nil
+}
+
+func (r *headerReader) readUint32() (uint32, error) {
+	var buf [4]byte
+
+	_, err := io.ReadFull(r, buf[:])
+	if err != nil {
+		return 0, fmt.Errorf("%w: header is truncated", ErrCorrupted)
+	}
+
+	return binary.LittleEndian.Uint32(buf[:]), nil
+}
+
+func (r *headerReader) readUint64() (uint64, error) {
+	var buf [8]byte
+
+	_, err := io.ReadFull(r, buf[:])
+	if err != nil {
+		return 0, fmt.Errorf("%w: header is truncated", ErrCorrupted)
+	}
+
+	return binary.LittleEndian.Uint64(buf[:]), nil
+}
+
+func (r *headerReader) readBytes(n int) ([]byte, error) {
+	if n > r.Len() {
+		return nil, fmt.Errorf("%w: header is truncated", ErrCorrupted)
+	}
+
+	buf := make([]byte, n)
+	_, _ = r.Read(buf)
+
+	return buf, nil
+}
+
+// expect reads the property ID which must be id.
+func (r *headerReader) expect(id byte) error {
+	b, err := r.readByte()
+	if err != nil {
+		return err
+	}
+
+	if b != id {
+		return fmt.Errorf("%w: unexpected property 0x%02X", ErrCorrupted, b)
+	}
+
+	return nil
+}
+
+// readBits reads the bit field of n items, the most significant bit first.
+func (r *headerReader) readBits(n int) ([]bool, error) {
+	v := make([]bool, n)
+
+	var b byte
+	for i := range v {
+		if i%8 == 0 {
+			var err error
+
+			b, err = r.readByte()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		v[i] = b&(0x80>>(i%8)) != 0
+	}
+
+	return v, nil
+}
+
+// readOptionalBits reads the bit field which starts with "all are defined"
+// byte.
+func (r *headerReader) readOptionalBits(n int) ([]bool, error) {
+	all, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	if all == 0 {
+		return r.readBits(n)
+	}
+
+	v := make([]bool, n)
+	for i := range v {
+		v[i] = true
+	}
+
+	return v, nil
+}
+
+// readDigests reads the CRCs of n items, some of them may be undefined.
+func (r *headerReader) readDigests(n int) ([]bool, []uint32, error) {
+	defined, err := r.readOptionalBits(n)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	crcs := make([]uint32, n)
+	for i := range crcs {
+		if !defined[i] {
+			continue
+		}
+
+		crcs[i], err = r.readUint32()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return defined, crcs, nil
+}
+
+// maxItems limits the number of the items, every item takes at least one
+// byte of the header.
+func (r *headerReader) maxItems() int {
+	return r.Len() + 1
+}
+
+func (r *headerReader) readHeader() (*header, error) {
+	h := &header{}
+
+	id, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	if id == idArchiveProperties {
+		err = r.skipArchiveProperties()
+		if err != nil {
+			return nil, err
+		}
+
+		id, err = r.readByte()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if id == idAdditionalStreamsInfo {
+		// the additional streams are not used by 7-Zip
+		_, err = r.readStreamsInfo()
+		if err != nil {
+			return nil, err
+		}
+
+		id, err = r.readByte()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if id == idMainStreamsInfo {
+		h.streams, err = r.readStreamsInfo()
+		if err != nil {
+			return nil, err
+		}
+
+		id, err = r.readByte()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if id == idFilesInfo {
+		h.files, err = r.readFilesInfo()
+		if err != nil {
+			return nil, err
+		}
+
+		id, err = r.readByte()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if id != idEnd {
+		return nil, fmt.Errorf("%w: unexpected property 0x%02X", ErrCorrupted, id)
+	}
+
+	if h.streams == nil {
+		h.streams = &streamsInfo{}
+	}
+
+	return h, nil
+}
+
+func (r *headerReader) skipArchiveProperties() error {
+	for {
+		id, err := r.readByte()
+		if err != nil {
+			return err
+		}
+
+		if id == idEnd {
+			return nil
+		}
+
+		size, err := r.readInt(r.Len())
+		if err != nil {
+			return err
+		}
+
+		_, _ = r.Seek(int64(size), io.SeekCurrent)
+	}
+}
+
+func (r *headerReader) readStreamsInfo() (*streamsInfo, error) {
+	s := &streamsInfo{}
+
+	id, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	if id == idPackInfo {
+		err = r.readPackInfo(s)
+		if err != nil {
+			return nil, err
+		}
+
+		id, err = r.readByte()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if id == idUnpackInfo {
+		err = r.readUnpackInfo(s)
+		if err != nil {
+			return nil, err
+		}
+
+		id, err = r.readByte()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// every folder holds one stream unless the substreams are defined
+	s.numUnpackStreams = make([]int, len(s.folders))
+	for i := range s.numUnpackStreams {
+		s.numUnpackStreams[i] = 1
+	}
+
+	if id == idSubStreamsInfo {
+		err = r.readSubStreamsInfo(s)
+		if err != nil {
+			return nil, err
+		}
+
+		id, err = r.readByte()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		s.substreams = make([]substream, len(s.folders))
+		for i, f := range s.folders {
+			s.substreams[i] = substream{size: f.unpackSize(), hasCRC: f.hasCRC, crc: f.crc}
+		}
+	}
+
+	if id != idEnd {
+		return nil, fmt.Errorf("%w: unexpected property 0x%02X", ErrCorrupted, id)
+	}
+
+	var packed int
+	for _, f := range s.folders {
+		packed += len(f.packedStreams)
+	}
+
+	if packed > len(s.packSizes) {
+		return nil, fmt.Errorf("%w: missing packed streams", ErrCorrupted)
+	}
+
+	return s, nil
+}
+
+func (r *headerReader) readPackInfo(s *streamsInfo) error {
+	var err error
+
+	s.packPos, err = r.readSize()
+	if err != nil {
+		return err
+	}
+
+	numPackStreams, err := r.readInt(r.maxItems())
+	if err != nil {
+		return err
+	}
+
+	for {
+		id, err := r.readByte()
+		if err != nil {
+			return err
+		}
+
+		switch id {
+		case idEnd:
+			if s.packSizes == nil && numPackStreams > 0 {
+				return fmt.Errorf("%w: missing pack sizes", ErrCorrupted)
+			}
+
+			return nil
+		case idSize:
+			s.packSizes = make([]int64, numPackStreams)
+			for i := range s.packSizes {
+				s.packSizes[i], err = r.readSize()
+				if err != nil {
+					return err
+				}
+			}
+		case idCRC:
+			// the CRCs of the packed streams are not checked, the unpacked
+			// data is
+			_, _, err = r.readDigests(numPackStreams)
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: unexpected property 0x%02X", ErrCorrupted, id)
+		}
+	}
+}
+
+func (r *headerReader) readUnpackInfo(s *streamsInfo) error {
+	err := r.expect(idFolder)
+	if err != nil {
+		return err
+	}
+
+	numFolders, err := r.readInt(r.maxItems())
+	if err != nil {
+		return err
+	}
+
+	external, err := r.readByte()
+	if err != nil {
+		return err
+	}
+
+	if external != 0 {
+		return fmt.Errorf("%w: external folders", ErrCorrupted)
+	}
+
+	s.folders = make([]*folder, numFolders)
+	for i := range s.folders {
+		s.folders[i], err = r.readFolder()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = r.expect(idCodersUnpackSize)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range s.folders {
+		f.unpackSizes = make([]int64, f.numOutStreams())
+		for i := range f.unpackSizes {
+			f.unpackSizes[i], err = r.readSize()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for {
+		id, err := r.readByte()
+		if err != nil {
+			return err
+		}
+
+		switch id {
+		case idEnd:
+			return nil
+		case idCRC:
+			defined, crcs, err := r.readDigests(numFolders)
+			if err != nil {
+				return err
+			}
+
+			for i, f := range s.folders {
+				f.hasCRC, f.crc = defined[i], crcs[i]
+			}
+		default:
+			return fmt.Errorf("%w: unexpected property 0x%02X", ErrCorrupted, id)
+		}
+	}
+}
+
+func (r *headerReader) readFolder() (*folder, error) {
+	f := &folder{}
+
+	numCoders, err := r.readInt(numCodersMax)
+	if err != nil {
+		return nil, err
+	}
+
+	if numCoders == 0 {
+		return nil, fmt.Errorf("%w: folder without coders", ErrCorrupted)
+	}
+
+	f.coders = make([]coder, numCoders)
+	for i := range f.coders {
+		flags, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+
+		if flags&coderAlternative != 0 {
+			return nil, fmt.Errorf("%w: alternative methods", ErrUnsupportedMethod)
+		}
+
+		c := &f.coders[i]
+
+		c.id, err = r.readBytes(int(flags & coderIDSizeMask))
+		if err != nil {
+			return nil, err
+		}
+
+		c.numInStreams, c.numOutStreams = 1, 1
+
+		if flags&coderComplex != 0 {
+			c.numInStreams, err = r.readInt(numStreamsMax)
+			if err != nil {
+				return nil, err
+			}
+
+			c.numOutStreams, err = r.readInt(numStreamsMax)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if flags&coderHasProps != 0 {
+			size, err := r.readInt(propsSizeMax)
+			if err != nil {
+				return nil, err
+			}
+
+			c.props, err = r.readBytes(size)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	numOutStreams := f.numOutStreams()
+	numInStreams := f.numInStreams()
+
+	if numOutStreams == 0 {
+		return nil, fmt.Errorf("%w: folder without output", ErrCorrupted)
+	}
+
+	f.bindPairs = make([]bindPair, numOutStreams-1)
+	for i := range f.bindPairs {
+		bp := &f.bindPairs[i]
+
+		bp.inIndex, err = r.readInt(numInStreams - 1)
+		if err != nil {
+			return nil, err
+		}
+
+		bp.outIndex, err = r.readInt(numOutStreams - 1)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	numPackedStreams := numInStreams - len(f.bindPairs)
+	if numPackedStreams < 1 {
+		return nil, fmt.Errorf("%w: folder without packed streams", ErrCorrupted)
+	}
+
+	f.packedStreams = make([]int, numPackedStreams)
+
+	if numPackedStreams == 1 {
+		f.packedStreams[0] = -1
+
+		for i := 0; i < numInStreams; i++ {
+			if f.findBindPairForInStream(i) < 0 {
+				f.packedStreams[0] = i
+
+				break
+			}
+		}
+
+		if f.packedStreams[0] < 0 {
+			return nil, fmt.Errorf("%w: folder without packed streams", ErrCorrupted)
+		}
+	} else {
+		for i := range f.packedStreams {
+			f.packedStreams[i], err = r.readInt(numInStreams - 1)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if f.mainOutStream() < 0 {
+		return nil, fmt.Errorf("%w: folder without output", ErrCorrupted)
+	}
+
+	return f, nil
+}
+
+func (r *headerReader) readSubStreamsInfo(s *streamsInfo) error {
+	id, err := r.readByte()
+	if err != nil {
+		return err
+	}
+
+	total := len(s.folders)
+
+	if id == idNumUnpackStream {
+		total = 0
+
+		for i := range s.numUnpackStreams {
+			s.numUnpackStreams[i], err = r.readInt(r.maxItems())
+			if err != nil {
+				return err
+			}
+
+			total += s.numUnpackStreams[i]
+		}
+
+		id, err = r.readByte()
+		if err != nil {
+			return err
+		}
+	}
+
+	s.substreams = make([]substream, 0, total)
+
+	// the size of the last substream of the folder is the rest of the
+	// folder output
+	hasSizes := id == idSize
+
+	for i, f := range s.folders {
+		n := s.numUnpackStreams[i]
+		if n == 0 {
+			continue
+		}
+
+		if n > 1 && !hasSizes {
+			return fmt.Errorf("%w: missing substream sizes", ErrCorrupted)
+		}
+
+		rest := f.unpackSize()
+
+		for j := 0; j < n-1 && hasSizes; j++ {
+			size, err := r.readSize()
+			if err != nil {
+				return err
+			}
+
+			if size > rest {
+				return fmt.Errorf("%w: substream size", ErrCorrupted)
+			}
+
+			s.substreams = append(s.substreams, substream{size: size})
+			rest -= size
+		}
+
+		s.substreams = append(s.substreams, substream{size: rest})
+
+		// a single substream of the folder takes its CRC
+		if n == 1 && f.hasCRC {
+			last := &s.substreams[len(s.substreams)-1]
+			last.hasCRC, last.crc = true, f.crc
+		}
+	}
+
+	if hasSizes {
+		id, err = r.readByte()
+		if err != nil {
+			return err
+		}
+	}
+
+	for id != idEnd {
+		if id != idCRC {
+			return fmt.Errorf("%w: unexpected property 0x%02X", ErrCorrupted, id)
+		}
+
+		// the digests of the substreams whose CRC is not known from the
+		// folder
+		var unknown []*substream
+
+		k := 0
+		for i, f := range s.folders {
+			n := s.numUnpackStreams[i]
+			for j := 0; j < n; j++ {
+				if n != 1 || !f.hasCRC {
+					unknown = append(unknown, &s.substreams[k+j])
+				}
+			}
+
+			k += n
+		}
+
+		defined, crcs, err := r.readDigests(len(unknown))
+		if err != nil {
+			return err
+		}
+
+		for i, ss := range unknown {
+			ss.hasCRC, ss.crc = defined[i], crcs[i]
+		}
+
+		id, err = r.readByte()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *headerReader) readFilesInfo() ([]fileEntry, error) {
+	numFiles, err := r.readInt(r.maxItems())
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]fileEntry, numFiles)
+	for i := range files {
+		files[i].hasStream = true
+	}
+
+	var (
+		emptyStreams []bool
+		numEmpty     int
+	)
+
+	for {
+		id, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+
+		if id == idEnd {
+			break
+		}
+
+		size, err := r.readInt(r.Len())
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := r.readBytes(size)
+		if err != nil {
+			return nil, err
+		}
+
+		pr := newHeaderReader(data)
+
+		switch id {
+		case idEmptyStream:
+			emptyStreams, err = pr.readBits(numFiles)
+			if err != nil {
+				return nil, err
+			}
+
+			numEmpty = 0
+
+			for i, empty := range emptyStreams {
+				files[i].hasStream = !empty
+				// empty streams are directories unless kEmptyFile says otherwise
+				files[i].isDir = empty
+
+				if empty {
+					numEmpty++
+				}
+			}
+		case idEmptyFile, idAnti:
+			v, err := pr.readBits(numEmpty)
+			if err != nil {
+				return nil, err
+			}
+
+			k := 0
+
+			for i := range files {
+				if files[i].hasStream {
+					continue
+				}
+
+				if id == idEmptyFile {
+					files[i].isDir = !v[k]
+				} else {
+					files[i].isAnti = v[k]
+				}
+
+				k++
+			}
+		case idName:
+			err = pr.readNames(files)
+			if err != nil {
+				return nil, err
+			}
+		case idCTime, idATime, idMTime:
+			err = pr.readTimes(files, id)
+			if err != nil {
+				return nil, err
+			}
+		case idWinAttributes:
+			defined, err := pr.readOptionalBits(numFiles)
+			if err != nil {
+				return nil, err
+			}
+
+			if err = pr.expect(0); err != nil {
+				return nil, fmt.Errorf("%w: external attributes", ErrCorrupted)
+			}
+
+			for i := range files {
+				if !defined[i] {
+					continue
+				}
+
+				files[i].attrib, err = pr.readUint32()
+				if err != nil {
+					return nil, err
+				}
+
+				files[i].hasAttrib = true
+			}
+		}
+	}
+
+	return files, nil
+}
+
+func (r *headerReader) readNames(files []fileEntry) error {
+	if err := r.expect(0); err != nil {
+		return fmt.Errorf("%w: external names", ErrCorrupted)
+	}
+
+	var name []uint16
+
+	for i := range files {
+		name = name[:0]
+
+		for {
+			var buf [2]byte
+
+			_, err := io.ReadFull(r, buf[:])
+			if err != nil {
+				return fmt.Errorf("%w: file names", ErrCorrupted)
+			}
+
+			c := binary.LittleEndian.Uint16(buf[:])
+			if c == 0 {
+				break
+			}
+
+			name = append(name, c)
+		}
+
+		files[i].name = string(utf16.Decode(name))
+	}
+
+	return nil
+}
+
+func (r *headerReader) readTimes(files []fileEntry, id byte) error {
+	defined, err := r.readOptionalBits(len(files))
+	if err != nil {
+		return err
+	}
+
+	if err = r.expect(0); err != nil {
+		return fmt.Errorf("%w: external times", ErrCorrupted)
+	}
+
+	for i := range files {
+		if !defined[i] {
+			continue
+		}
+
+		v, err := r.readUint64()
+		if err != nil {
+			return err
+		}
+
+		t := filetimeToTime(v)
+
+		switch id {
+		case idCTime:
+			files[i].created = t
+		case idATime:
+			files[i].accessed = t
+		case idMTime:
+			files[i].modified = t
+			files[i].hasModified = true
+		}
+	}
+
+	return nil
+}
+
+// filetimeEpochDiff is the number of 100 ns intervals between the epochs of
+// Windows FILETIME (1601) and Unix time.
+const filetimeEpochDiff = 116444736000000000
+
+func filetimeToTime(v uint64) time.Time {
+	ticks := int64(v) - filetimeEpochDiff
+
+	return time.Unix(ticks/1e7, ticks%1e7*100).UTC()
+}
+
+// headerWriter encodes the header structures, the opposite of headerReader.
+type headerWriter struct {
+	bytes.Buffer
+}
+
+func (w *headerWriter) writeNumber(v uint64) {
+	first := byte(0)
+	mask := byte(0x80)
+
+	i := 0
+	for ; i < 8; i++ {
+		if v < 1<<(7*(i+1)) {
+			first |= byte(v >> (8 * i))
+
+			break
+		}
+
+		first |= mask
+		mask >>= 1
+	}
+
+	w.WriteByte(first)
+
+	for j := 0; j < i; j++ {
+		w.WriteByte(byte(v >> (8 * j)))
+	}
+}
+
+func (w *headerWriter) writeUint32(v uint32) {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	w.Write(buf[:])
+}
+
+func (w *headerWriter) writeUint64(v uint64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	w.Write(buf[:])
+}
+
+// writeByte writes the property ID or the flags.
+func (w *headerWriter) writeByte(b byte) {
+	w.WriteByte(b)
+}
+
+// writeBits writes the bit vector, the first item is the high bit.
+func (w *headerWriter) writeBits(v []bool) {
+	var b byte
+
+	for i, bit := range v {
+		if bit {
+			b |= 0x80 >> (i % 8)
+		}
+
+		if i%8 == 7 {
+			w.WriteByte(b)
+			b = 0
+		}
+	}
+
+	if len(v)%8 != 0 {
+		w.WriteByte(b)
+	}
+}
+
+// writeOptionalBits writes the vector with "all defined" byte.
+func (w *headerWriter) writeOptionalBits(v []bool) {
+	for _, bit := range v {
+		if !bit {
+			w.WriteByte(0)
+			w.writeBits(v)
+
+			return
+		}
+	}
+
+	w.WriteByte(1)
+}
+
+func (w *headerWriter) writeDigests(defined []bool, crcs []uint32) {
+	w.writeOptionalBits(defined)
+
+	for i, crc := range crcs {
+		if defined[i] {
+			w.writeUint32(crc)
+		}
+	}
+}
+
+func (w *headerWriter) writeHeader(h *header) {
+	w.writeByte(idHeader)
+
+	if len(h.streams.folders) > 0 {
+		w.writeByte(idMainStreamsInfo)
+		w.writeStreamsInfo(h.streams)
+	}
+
+	if len(h.files) > 0 {
+		w.writeByte(idFilesInfo)
+		w.writeFilesInfo(h.files)
+	}
+
+	w.writeByte(idEnd)
+}
+
+// writeStreamsInfo writes the streams, the substreams are written only if
+// numUnpackStreams is set.
+func (w *headerWriter) writeStreamsInfo(s *streamsInfo) {
+	w.writeByte(idPackInfo)
+	w.writeNumber(uint64(s.packPos))
+	w.writeNumber(uint64(len(s.packSizes)))
+	w.writeByte(idSize)
+
+	for _, size := range s.packSizes {
+		w.writeNumber(uint64(size))
+	}
+
+	w.writeByte(idEnd)
+
+	w.writeByte(idUnpackInfo)
+	w.writeByte(idFolder)
+	w.writeNumber(uint64(len(s.folders)))
+	w.writeByte(0) // not external
+
+	for _, f := range s.folders {
+		w.writeFolder(f)
+	}
+
+	w.writeByte(idCodersUnpackSize)
+
+	hasCRCs := false
+
+	for _, f := range s.folders {
+		for _, size := range f.unpackSizes {
+			w.writeNumber(uint64(size))
+		}
+
+		hasCRCs = hasCRCs || f.hasCRC
+	}
+
+	if hasCRCs {
+		defined := make([]bool, len(s.folders))
+		crcs := make([]uint32, len(s.folders))
+
+		for i, f := range s.folders {
+			defined[i], crcs[i] = f.hasCRC, f.crc
+		}
+
+		w.writeByte(idCRC)
+		w.writeDigests(defined, crcs)
+	}
+
+	w.writeByte(idEnd)
+
+	if s.numUnpackStreams != nil {
+		w.writeSubStreamsInfo(s)
+	}
+
+	w.writeByte(idEnd)
+}
+
+func (w *headerWriter) writeFolder(f *folder) {
+	w.writeNumber(uint64(len(f.coders)))
+
+	for _, c := range f.coders {
+		flags := byte(len(c.id))
+		isComplex := c.numInStreams != 1 || c.numOutStreams != 1
+
+		if isComplex {
+			flags |= coderComplex
+		}
+
+		if len(c.props) > 0 {
+			flags |= coderHasProps
+		}
+
+		w.writeByte(flags)
+		w.Write(c.id)
+
+		if isComplex {
+			w.writeNumber(uint64(c.numInStreams))
+			w.writeNumber(uint64(c.numOutStreams))
+		}
+
+		if len(c.props) > 0 {
+			w.writeNumber(uint64(len(c.props)))
+			w.Write(c.props)
+		}
+	}
+
+	for _, bp := range f.bindPairs {
+		w.writeNumber(uint64(bp.inIndex))
+		w.writeNumber(uint64(bp.outIndex))
+	}
+
+	if len(f.packedStreams) > 1 {
+		for _, i := range f.packedStreams {
+			w.writeNumber(uint64(i))
+		}
+	}
+}
+
+// writeSubStreamsInfo writes the substreams as 7-Zip does: the CRCs of all
+// substreams are stored here, unless the folder has one substream and CRC.
+func (w *headerWriter) writeSubStreamsInfo(s *streamsInfo) {
+	w.writeByte(idSubStreamsInfo)
+
+	for _, n := range s.numUnpackStreams {
+		if n != 1 {
+			w.writeByte(idNumUnpackStream)
+
+			for _, n := range s.numUnpackStreams {
+				w.writeNumber(uint64(n))
+			}
+
+			break
+		}
+	}
+
+	for _, n := range s.numUnpackStreams {
+		if n > 1 {
+			w.writeByte(idSize)
+
+			k := 0
+			for _, n := range s.numUnpackStreams {
+				for j := 0; j < n-1; j++ {
+					w.writeNumber(uint64(s.substreams[k+j].size))
+				}
+
+				k += n
+			}
+
+			break
+		}
+	}
+
+	var (
+		defined []bool
+		crcs    []uint32
+	)
+
+	k := 0
+	for i, f := range s.folders {
+		n := s.numUnpackStreams[i]
+		for j := 0; j < n; j++ {
+			if n != 1 || !f.hasCRC {
+				defined = append(defined, s.substreams[k+j].hasCRC)
+				crcs = append(crcs, s.substreams[k+j].crc)
+			}
+		}
+
+		k += n
+	}
+
+	if len(crcs) > 0 {
+		w.writeByte(idCRC)
+		w.writeDigests(defined, crcs)
+	}
+
+	w.writeByte(idEnd)
+}
+
+func (w *headerWriter) writeFilesInfo(files []fileEntry) {
+	w.writeNumber(uint64(len(files)))
+
+	var emptyStream, emptyFile []bool
+
+	for _, f := range files {
+		emptyStream = append(emptyStream, !f.hasStream)
+
+		if !f.hasStream {
+			emptyFile = append(emptyFile, !f.isDir)
+		}
+	}
+
+	if len(emptyFile) > 0 {
+		w.writeProperty(idEmptyStream, func(pw *headerWriter) {
+			pw.writeBits(emptyStream)
+		})
+
+		for _, v := range emptyFile {
+			if v {
+				w.writeProperty(idEmptyFile, func(pw *headerWriter) {
+					pw.writeBits(emptyFile)
+				})
+
+				break
+			}
+		}
+	}
+
+	w.writeProperty(idName, func(pw *headerWriter) {
+		pw.writeByte(0) // not external
+
+		for _, f := range files {
+			for _, c := range utf16.Encode([]rune(f.name)) {
+				pw.WriteByte(byte(c))
+				pw.WriteByte(byte(c >> 8))
+			}
+
+			pw.WriteByte(0)
+			pw.WriteByte(0)
+		}
+	})
+
+	w.writeTimes(idCTime, files, func(f *fileEntry) time.Time { return f.created })
+	w.writeTimes(idATime, files, func(f *fileEntry) time.Time { return f.accessed })
+	w.writeTimes(idMTime, files, func(f *fileEntry) time.Time { return f.modified })
+
+	defined := make([]bool, len(files))
+	hasAttrib := false
+
+	for i := range files {
+		defined[i] = files[i].hasAttrib
+		hasAttrib = hasAttrib || defined[i]
+	}
+
+	if hasAttrib {
+		w.writeProperty(idWinAttributes, func(pw *headerWriter) {
+			pw.writeOptionalBits(defined)
+			pw.writeByte(0) // not external
+
+			for _, f := range files {
+				if f.hasAttrib {
+					pw.writeUint32(f.attrib)
+				}
+			}
+		})
+	}
+
+	w.writeByte(idEnd)
+}
+
+// writeTimes writes the times of the files, zero times are undefined.
+func (w *headerWriter) writeTimes(id byte, files []fileEntry, get func(f *fileEntry) time.Time) {
+	defined := make([]bool, len(files))
+	hasTimes := false
+
+	for i := range files {
+		defined[i] = !get(&files[i]).IsZero()
+		hasTimes = hasTimes || defined[i]
+	}
+
+	if !hasTimes {
+		return
+	}
+
+	w.writeProperty(id, func(pw *headerWriter) {
+		pw.writeOptionalBits(defined)
+		pw.writeByte(0) // not external
+
+		for i := range files {
+			if defined[i] {
+				pw.writeUint64(timeToFiletime(get(&files[i])))
+			}
+		}
+	})
+}
+
+// writeProperty writes the property of the files prefixed by its size.
+func (w *headerWriter) writeProperty(id byte, write func(pw *headerWriter)) {
+	pw := &headerWriter{}
+	write(pw)
+
+	w.writeByte(id)
+	w.writeNumber(uint64(pw.Len()))
+	w.Write(pw.Bytes())
+}
+
+func timeToFiletime(t time.Time) uint64 {
+	return uint64(t.Unix()*1e7 + int64(t.Nanosecond())/100 + filetimeEpochDiff)
+}
@@ -0,0 +1,228 @@
+package sevenzip
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// fileListEntry is a file or a directory of fs.FS, directories missing in the
+// archive are synthesized from the paths of the files.
+type fileListEntry struct {
+	name  string
+	file  *File
+	isDir bool
+}
+
+func (e *fileListEntry) Name() string               { return path.Base(e.name) }
+func (e *fileListEntry) Size() int64                { return e.fileSize() }
+func (e *fileListEntry) IsDir() bool                { return e.isDir }
+func (e *fileListEntry) Sys() any                   { return nil }
+func (e *fileListEntry) Info() (fs.FileInfo, error) { return e, nil }
+func (e *fileListEntry) Type() fs.FileMode          { return e.Mode().Type() }
+func (e *fileListEntry) String() string             { return fs.FormatFileInfo(e) }
+
+func (e *fileListEntry) fileSize() int64 {
+	if e.file == nil || e.isDir {
+		return 0
+	}
+
+	return e.file.Size
+}
+
+func (e *fileListEntry) Mode() fs.FileMode {
+	if e.file != nil {
+		return e.file.Mode()
+	}
+
+	return fs.ModeDir | 0o555
+}
+
+func (e *fileListEntry) ModTime() time.Time {
+	if e.file != nil {
+		return e.file.Modified
+	}
+
+	return time.Time{}
+}
+
+// initFileList builds the sorted list of the files, it skips the files
+// with names invalid for fs.FS.
+func (r *Reader) initFileList() {
+	r.fileListOnce.Do(func() {
+		dirs := make(map[string]bool)
+		files := make(map[string]int)
+
+		add := func(e fileListEntry) {
+			if i, ok := files[e.name]; ok {
+				// the last entry wins as on extraction
+				r.fileList[i] = e
+
+				return
+			}
+
+			files[e.name] = len(r.fileList)
+			r.fileList = append(r.fileList, e)
+		}
+
+		for _, f := range r.File {
+			name := strings.TrimSuffix(f.Name, "/")
+			if !fs.ValidPath(name) || name == "." {
+				continue
+			}
+
+			add(fileListEntry{name: name, file: f, isDir: f.IsDir})
+
+			if f.IsDir {
+				dirs[name] = true
+			}
+
+			for dir := path.Dir(name); dir != "." && !dirs[dir]; dir = path.Dir(dir) {
+				dirs[dir] = true
+				if _, ok := files[dir]; !ok {
+					add(fileListEntry{name: dir, isDir: true})
+				}
+			}
+		}
+
+		sort.Slice(r.fileList, func(i, j int) bool {
+			return fileEntryLess(r.fileList[i].name, r.fileList[j].name)
+		})
+	})
+}
+
+// fileEntryLess orders the entries by the directory then by the name, so
+// entries of a directory are adjacent.
+func fileEntryLess(x, y string) bool {
+	xdir, xelem := split(x)
+	ydir, yelem := split(y)
+
+	return xdir < ydir || xdir == ydir && xelem < yelem
+}
+
+func split(name string) (dir, elem string) {
+	i := strings.LastIndexByte(name, '/')
+	if i < 0 {
+		return ".", name
+	}
+
+	return name[:i], name[i+1:]
+}
+
+// Open opens the named file of the archive using the semantics of fs.FS.
+func (r *Reader) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	e := r.openLookup(name)
+	if e == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	if e.isDir {
+		return &openDir{e: e, files: r.openReadDir(name)}, nil
+	}
+
+	rc, err := e.file.Open()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return &openFile{e: e, rc: rc}, nil
+}
+
+func (r *Reader) openLookup(name string) *fileListEntry {
+	if name == "." {
+		return &fileListEntry{name: ".", isDir: true}
+	}
+
+	r.initFileList()
+
+	dir, elem := split(name)
+	files := r.fileList
+
+	i := sort.Search(len(files), func(i int) bool {
+		idir, ielem := split(files[i].name)
+
+		return idir > dir || idir == dir && ielem >= elem
+	})
+
+	if i < len(files) && files[i].name == name {
+		return &files[i]
+	}
+
+	return nil
+}
+
+func (r *Reader) openReadDir(dir string) []fileListEntry {
+	r.initFileList()
+
+	files := r.fileList
+
+	i := sort.Search(len(files), func(i int) bool {
+		idir, _ := split(files[i].name)
+
+		return idir >= dir
+	})
+
+	j := sort.Search(len(files), func(j int) bool {
+		jdir, _ := split(files[j].name)
+
+		return jdir > dir
+	})
+
+	return files[i:j]
+}
+
+type openFile struct {
+	e  *fileListEntry
+	rc io.ReadCloser
+}
+
+func (f *openFile) Stat() (fs.FileInfo, error) { return f.e, nil }
+func (f *openFile) Read(p []byte) (int, error) { return f.rc.Read(p) }
+func (f *openFile) Close() error               { return f.rc.Close() }
+
+type openDir struct {
+	e      *fileListEntry
+	files  []fileListEntry
+	offset int
+}
+
+func (d *openDir) Close() error               { return nil }
+func (d *openDir) Stat() (fs.FileInfo, error) { return d.e, nil }
+
+var errIsDirectory = errors.New("is a directory")
+
+func (d *openDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.e.name, Err: errIsDirectory}
+}
+
+func (d *openDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	n := len(d.files) - d.offset
+	if count > 0 && n > count {
+		n = count
+	}
+
+	if n == 0 {
+		if count > 0 {
+			return nil, io.EOF
+		}
+
+		return []fs.DirEntry{}, nil
+	}
+
+	list := make([]fs.DirEntry, n)
+	for i := range list {
+		list[i] = &d.files[d.offset+i]
+	}
+
+	d.offset += n
+
+	return list, nil
+}
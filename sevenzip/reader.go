@@ -0,0 +1,641 @@
+package sevenzip
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kulaginds/lzma"
+)
+
+var (
+	errNotSingleFile   = errors.New("sevenzip: archive must hold a single file")
+	errArchiveTooLarge = errors.New("sevenzip: archive is too large to read into memory")
+)
+
+// singleFileArchiveMax limits the archive read into memory for lzma.NewReader,
+// larger archives are opened by NewReader from io.ReaderAt.
+const singleFileArchiveMax = 64 << 20
+
+func init() {
+	lzma.RegisterFormat(lzma.Format7z, signature, newSingleFileReader)
+}
+
+// newSingleFileReader reads the archive of up to singleFileArchiveMax bytes
+// into memory and opens its only file, it is the reader of lzma.NewReader.
+func newSingleFileReader(inStream io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(io.LimitReader(inStream, singleFileArchiveMax+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > singleFileArchiveMax {
+		return nil, errArchiveTooLarge
+	}
+
+	r, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	var file *File
+
+	for _, f := range r.File {
+		if f.IsDir {
+			continue
+		}
+
+		if file != nil {
+			return nil, errNotSingleFile
+		}
+
+		file = f
+	}
+
+	if file == nil {
+		return nil, errNotSingleFile
+	}
+
+	return file.Open()
+}
+
+// searchLimit limits the search of the signature in SFX archives.
+const searchLimit = 16 << 20
+
+// Reader reads the files of .7z archive. It implements fs.FS.
+type Reader struct {
+	File []*File
+
+	inStream io.ReaderAt
+	password string
+	start    int64
+	streams  *streamsInfo
+
+	mu    sync.Mutex
+	cache map[int]*folderReader
+
+	fileListOnce sync.Once
+	fileList     []fileListEntry
+}
+
+// ReadCloser is Reader of the archive opened by OpenReader.
+type ReadCloser struct {
+	Reader
+
+	f *os.File
+}
+
+// File is a file of the archive.
+type File struct {
+	FileHeader
+
+	r           *Reader
+	folderIndex int
+	offset      int64
+	hasCRC      bool
+	crc         uint32
+}
+
+// FileHeader describes a file of the archive.
+type FileHeader struct {
+	Name     string
+	Size     int64
+	Modified time.Time
+	Created  time.Time
+	Accessed time.Time
+
+	// Attributes are Windows file attributes, the high 16 bits hold Unix
+	// mode if 0x8000 bit is set.
+	Attributes uint32
+	IsDir      bool
+}
+
+// OpenReader opens the archive file.
+func OpenReader(name string) (*ReadCloser, error) {
+	return OpenReaderWithPassword(name, "")
+}
+
+// OpenReaderWithPassword opens the archive file encrypted by 7zAES.
+func OpenReaderWithPassword(name, password string) (*ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+
+		return nil, err
+	}
+
+	rc := &ReadCloser{f: f}
+	rc.password = password
+
+	err = rc.init(f, fi.Size())
+	if err != nil {
+		_ = f.Close()
+
+		return nil, err
+	}
+
+	return rc, nil
+}
+
+// Close closes the archive file.
+func (rc *ReadCloser) Close() error {
+	return rc.f.Close()
+}
+
+// NewReader reads the headers of the archive of size bytes. The archive may
+// follow an executable stub as SFX archives do.
+func NewReader(inStream io.ReaderAt, size int64) (*Reader, error) {
+	return NewReaderWithPassword(inStream, size, "")
+}
+
+// NewReaderWithPassword reads the headers of the archive encrypted by
+// 7zAES. Wrong password is reported as ErrWrongPassword by the reading of
+// the encrypted header or the files.
+func NewReaderWithPassword(inStream io.ReaderAt, size int64, password string) (*Reader, error) {
+	r := &Reader{password: password}
+
+	err := r.init(inStream, size)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *Reader) init(inStream io.ReaderAt, size int64) error {
+	r.inStream = inStream
+	r.cache = make(map[int]*folderReader)
+
+	start, sh, err := findSignatureHeader(inStream, size)
+	if err != nil {
+		return err
+	}
+
+	r.start = start
+
+	if sh.nextHeaderSize == 0 {
+		// empty archive
+		r.streams = &streamsInfo{}
+
+		return nil
+	}
+
+	if sh.nextHeaderOffset > size-start-signatureHeaderLen-sh.nextHeaderSize {
+		return fmt.Errorf("%w: header is out of file", ErrCorrupted)
+	}
+
+	buf := make([]byte, sh.nextHeaderSize)
+
+	_, err = inStream.ReadAt(buf, r.dataOffset()+sh.nextHeaderOffset)
+	if err != nil {
+		return err
+	}
+
+	if crc32.ChecksumIEEE(buf) != sh.nextHeaderCRC {
+		return fmt.Errorf("%w: header", ErrChecksum)
+	}
+
+	h, err := r.readHeader(buf)
+	if err != nil {
+		return err
+	}
+
+	r.streams = h.streams
+
+	return r.initFiles(h)
+}
+
+// dataOffset returns the offset of the data after the signature header.
+func (r *Reader) dataOffset() int64 {
+	return r.start + signatureHeaderLen
+}
+
+// findSignatureHeader looks for the signature header with valid CRC, it is at
+// the start of the file unless the archive is SFX.
+func findSignatureHeader(inStream io.ReaderAt, size int64) (int64, startHeader, error) {
+	buf := make([]byte, 64<<10)
+
+	for offset := int64(0); offset < size && offset < searchLimit; {
+		n, err := inStream.ReadAt(buf, offset)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, startHeader{}, err
+		}
+
+		chunk := buf[:n]
+
+		for i := 0; ; {
+			k := bytes.Index(chunk[i:], []byte(signature))
+			if k < 0 {
+				break
+			}
+
+			i += k
+
+			if len(chunk)-i < signatureHeaderLen {
+				if int64(n) < int64(len(buf)) {
+					break
+				}
+
+				// continue from the signature in the next chunk
+				chunk = chunk[:i]
+
+				break
+			}
+
+			sh, err := parseSignatureHeader(chunk[i : i+signatureHeaderLen])
+			if err == nil {
+				return offset + int64(i), sh, nil
+			}
+
+			if offset == 0 && i == 0 && !errors.Is(err, ErrChecksum) {
+				return 0, sh, err
+			}
+
+			i++
+		}
+
+		if n < len(buf) {
+			break
+		}
+
+		offset += int64(n) - signatureHeaderLen
+	}
+
+	return 0, startHeader{}, ErrFormat
+}
+
+// readHeader decodes the header, which is packed by the coders if it is
+// encoded header.
+func (r *Reader) readHeader(buf []byte) (*header, error) {
+	for {
+		hr := newHeaderReader(buf)
+
+		id, err := hr.readByte()
+		if err != nil {
+			return nil, err
+		}
+
+		switch id {
+		case idHeader:
+			return hr.readHeader()
+		case idEncodedHeader:
+			s, err := hr.readStreamsInfo()
+			if err != nil {
+				return nil, err
+			}
+
+			buf, err = r.decodeHeader(s)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%w: unexpected property 0x%02X", ErrCorrupted, id)
+		}
+	}
+}
+
+// decodeHeader decodes the first folder of the streams which holds the
+// header.
+func (r *Reader) decodeHeader(s *streamsInfo) ([]byte, error) {
+	if len(s.folders) == 0 {
+		return nil, fmt.Errorf("%w: encoded header without folders", ErrCorrupted)
+	}
+
+	f := s.folders[0]
+
+	size := f.unpackSize()
+	if size > headerSizeMax {
+		return nil, fmt.Errorf("%w: header is too large", ErrCorrupted)
+	}
+
+	fr, err := newFolderReader(r.inStream, r.dataOffset()+s.packPos, s.packSizes, f, r.password)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, size)
+
+	_, err = io.ReadFull(fr, buf)
+	if err != nil {
+		if errors.Is(err, ErrWrongPassword) {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("%w: encoded header: %v", ErrCorrupted, err)
+	}
+
+	if f.hasCRC && crc32.ChecksumIEEE(buf) != f.crc {
+		return nil, passwordError(fr, fmt.Errorf("%w: encoded header", ErrChecksum))
+	}
+
+	return buf, nil
+}
+
+// initFiles assigns the substreams of the folders to the files.
+func (r *Reader) initFiles(h *header) error {
+	s := h.streams
+
+	folderIndex := 0
+	streamIndex := 0
+	inFolder := 0
+	offset := int64(0)
+
+	for i := range h.files {
+		fe := &h.files[i]
+
+		if fe.isAnti {
+			continue
+		}
+
+		f := &File{
+			FileHeader: FileHeader{
+				Name:       strings.ReplaceAll(fe.name, "\\", "/"),
+				Modified:   fe.modified,
+				Created:    fe.created,
+				Accessed:   fe.accessed,
+				Attributes: fe.attrib,
+				IsDir:      fe.isDir || fe.attrib&attrDirectory != 0,
+			},
+			r:           r,
+			folderIndex: -1,
+		}
+
+		if fe.hasStream {
+			for folderIndex < len(s.folders) && inFolder == s.numUnpackStreams[folderIndex] {
+				folderIndex++
+				inFolder = 0
+				offset = 0
+			}
+
+			if folderIndex == len(s.folders) || streamIndex == len(s.substreams) {
+				return fmt.Errorf("%w: file without stream", ErrCorrupted)
+			}
+
+			ss := s.substreams[streamIndex]
+
+			f.folderIndex = folderIndex
+			f.offset = offset
+			f.Size = ss.size
+			f.hasCRC, f.crc = ss.hasCRC, ss.crc
+
+			offset += ss.size
+			streamIndex++
+			inFolder++
+		}
+
+		r.File = append(r.File, f)
+	}
+
+	return nil
+}
+
+// Mode returns the permissions and the mode bits of the file.
+func (h *FileHeader) Mode() fs.FileMode {
+	var mode fs.FileMode
+
+	if h.Attributes&attrUnixExtension != 0 {
+		mode = unixModeToFileMode(h.Attributes >> 16)
+	} else {
+		mode = 0o644
+		if h.Attributes&attrReadOnly != 0 {
+			mode = 0o444
+		}
+	}
+
+	if h.IsDir {
+		mode |= fs.ModeDir
+		if mode.Perm() == 0o644 || mode.Perm() == 0o444 {
+			mode |= 0o111
+		}
+	}
+
+	return mode
+}
+
+// FileInfo returns fs.FileInfo of the file.
+func (h *FileHeader) FileInfo() fs.FileInfo {
+	return headerFileInfo{h}
+}
+
+// Unix file types of the mode.
+const (
+	unixTypeMask    = 0o170000
+	unixTypeSymlink = 0o120000
+	unixTypeDir     = 0o040000
+	unixTypeFIFO    = 0o010000
+	unixTypeSocket  = 0o140000
+	unixTypeChar    = 0o020000
+	unixTypeBlock   = 0o060000
+)
+
+func unixModeToFileMode(m uint32) fs.FileMode {
+	mode := fs.FileMode(m & 0o777)
+
+	switch m & unixTypeMask {
+	case unixTypeDir:
+		mode |= fs.ModeDir
+	case unixTypeSymlink:
+		mode |= fs.ModeSymlink
+	case unixTypeFIFO:
+		mode |= fs.ModeNamedPipe
+	case unixTypeSocket:
+		mode |= fs.ModeSocket
+	case unixTypeChar:
+		mode |= fs.ModeDevice | fs.ModeCharDevice
+	case unixTypeBlock:
+		mode |= fs.ModeDevice
+	}
+
+	if m&0o4000 != 0 {
+		mode |= fs.ModeSetuid
+	}
+
+	if m&0o2000 != 0 {
+		mode |= fs.ModeSetgid
+	}
+
+	if m&0o1000 != 0 {
+		mode |= fs.ModeSticky
+	}
+
+	return mode
+}
+
+type headerFileInfo struct {
+	h *FileHeader
+}
+
+func (fi headerFileInfo) Name() string       { return path.Base(fi.h.Name) }
+func (fi headerFileInfo) Size() int64        { return fi.h.Size }
+func (fi headerFileInfo) IsDir() bool        { return fi.Mode().IsDir() }
+func (fi headerFileInfo) ModTime() time.Time { return fi.h.Modified }
+func (fi headerFileInfo) Mode() fs.FileMode  { return fi.h.Mode() }
+func (fi headerFileInfo) Sys() any           { return fi.h }
+
+func (fi headerFileInfo) String() string {
+	return fs.FormatFileInfo(fi)
+}
+
+// folderReader is the decoder of the folder at the position pos of its
+// output.
+type folderReader struct {
+	r   io.Reader
+	pos int64
+}
+
+// Open returns the reader of the file data, the CRC is verified at the end.
+// Files of a solid folder are decoded from the start of the folder, unless
+// they are read in order: then the decoder of the previous file continues.
+func (f *File) Open() (io.ReadCloser, error) {
+	if f.folderIndex < 0 {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	fr, err := f.r.folderReader(f.folderIndex, f.offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileReader{
+		f:     f,
+		fr:    fr,
+		r:     io.LimitReader(fr.r, f.Size),
+		crc:   crc32.NewIEEE(),
+		limit: f.Size,
+	}, nil
+}
+
+// folderReader takes the cached decoder of the folder or creates a new one,
+// and skips the output up to offset.
+func (r *Reader) folderReader(folderIndex int, offset int64) (*folderReader, error) {
+	r.mu.Lock()
+	fr := r.cache[folderIndex]
+	if fr != nil && fr.pos <= offset {
+		delete(r.cache, folderIndex)
+	} else {
+		fr = nil
+	}
+	r.mu.Unlock()
+
+	f := r.streams.folders[folderIndex]
+
+	if fr == nil {
+		start, first := r.streams.packOffset(folderIndex)
+
+		if first+len(f.packedStreams) > len(r.streams.packSizes) {
+			return nil, fmt.Errorf("%w: missing packed streams", ErrCorrupted)
+		}
+
+		dec, err := newFolderReader(r.inStream, r.dataOffset()+start, r.streams.packSizes[first:], f, r.password)
+		if err != nil {
+			return nil, err
+		}
+
+		fr = &folderReader{r: dec}
+	}
+
+	n, err := io.CopyN(io.Discard, fr.r, offset-fr.pos)
+	fr.pos += n
+
+	if err != nil {
+		if errors.Is(err, ErrWrongPassword) {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("%w: %v", ErrCorrupted, unexpectedEOF(err))
+	}
+
+	return fr, nil
+}
+
+// release caches the decoder of the folder for the next file.
+func (r *Reader) release(folderIndex int, fr *folderReader) {
+	r.mu.Lock()
+	r.cache[folderIndex] = fr
+	r.mu.Unlock()
+}
+
+type fileReader struct {
+	f     *File
+	fr    *folderReader
+	r     io.Reader
+	crc   hash.Hash32
+	limit int64
+	n     int64
+	err   error
+}
+
+func (r *fileReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	n, err := r.r.Read(p)
+	_, _ = r.crc.Write(p[:n])
+	r.n += int64(n)
+	r.fr.pos += int64(n)
+
+	if errors.Is(err, io.EOF) {
+		switch {
+		case r.n != r.limit:
+			err = io.ErrUnexpectedEOF
+		case r.f.hasCRC && r.crc.Sum32() != r.f.crc:
+			err = passwordError(r.fr.r, ErrChecksum)
+		}
+	}
+
+	if err != nil {
+		r.err = err
+	}
+
+	return n, err
+}
+
+// Close returns the decoder of the folder to the reader if the file is read
+// completely.
+func (r *fileReader) Close() error {
+	if r.fr == nil {
+		return nil
+	}
+
+	if errors.Is(r.err, io.EOF) {
+		r.f.r.release(r.f.folderIndex, r.fr)
+	}
+
+	r.fr = nil
+
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+// passwordError reports the checksum error of the folder as wrong password if
+// the folder outputs the decrypted data as is: 7zAES coder has no check of
+// the key.
+func passwordError(fr io.Reader, err error) error {
+	if _, ok := fr.(decryptedReader); ok {
+		return fmt.Errorf("%w: %w", ErrWrongPassword, err)
+	}
+
+	return err
+}
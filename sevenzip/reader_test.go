@@ -0,0 +1,349 @@
+package sevenzip
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/kulaginds/lzma"
+	"github.com/stretchr/testify/require"
+)
+
+var tenFiles = map[string]string{
+	"01": "717af066c53c486f7c5e2855d083c863",
+	"02": "1c590e50144c84a4b673e36a044a0dbb",
+	"03": "e9535f54545e9daad42203bc61da0aff",
+	"04": "9e2b60ef06f6a4cd7ece3e93e3e2f6be",
+	"05": "7a6f05986fe525db6ccd708eb3268938",
+	"06": "3400ce70e948a6fbc35447ae38d3baca",
+	"07": "a130caea4a36fdeaaf2cc83eb51a1377",
+	"08": "5f698bd5f2975b836d80bb07e67a2989",
+	"09": "e01b3b02c71336223b7f7d15603ed997",
+	"10": "f77b2b066684207c042423796db52aad",
+}
+
+const emptyMD5 = "d41d8cd98f00b204e9800998ecf8427e"
+
+func fileMD5(f *File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	h := md5.New()
+
+	_, err = io.Copy(h, rc)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func TestReader(t *testing.T) {
+	r := require.New(t)
+
+	testCases := []struct {
+		name string
+
+		inputFile string
+		expected  map[string]string
+
+		checkErr1 func(err error, msgAndArgs ...interface{})
+		checkErr2 func(err error, msgAndArgs ...interface{})
+	}{
+		{
+			name:      "copy",
+			inputFile: "testassets/copy.7z",
+			expected:  tenFiles,
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "lzma",
+			inputFile: "testassets/lzma.7z",
+			expected:  tenFiles,
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "lzma2",
+			inputFile: "testassets/lzma2.7z",
+			expected:  tenFiles,
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "delta",
+			inputFile: "testassets/delta.7z",
+			expected:  tenFiles,
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "bcj2",
+			inputFile: "testassets/bcj2.7z",
+			expected:  tenFiles,
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "empty",
+			inputFile: "testassets/empty.7z",
+			expected: map[string]string{
+				"01": "", "02": "", "03": "", "04": "", "05": "",
+				"06": emptyMD5, "07": emptyMD5, "08": emptyMD5, "09": emptyMD5, "10": emptyMD5,
+			},
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "no_files",
+			inputFile: "testassets/empty2.7z",
+			expected:  map[string]string{},
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "file_and_empty",
+			inputFile: "testassets/file_and_empty.7z",
+			expected: map[string]string{
+				"large": "1a549f002dc852732adda6d42e045c51",
+				"empty": emptyMD5,
+			},
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "t0",
+			inputFile: "testassets/t0.7z",
+			expected: map[string]string{
+				"bar": "c157a79031e1c40f85931829bc5fc552",
+				"foo": "d3b07384d113edec49eaa6238ad5ff00",
+			},
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "t1",
+			inputFile: "testassets/t1.7z",
+			expected: map[string]string{
+				"bar": "c157a79031e1c40f85931829bc5fc552",
+				"foo": "d3b07384d113edec49eaa6238ad5ff00",
+			},
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "bcj",
+			inputFile: "testassets/bcj.7z",
+			expected: map[string]string{
+				"bcj": "9c4639a5e395b1ae33d308510b1359a1",
+			},
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "arm",
+			inputFile: "testassets/arm.7z",
+			expected: map[string]string{
+				"arm": "ed008564a061c74abcb470b409c7e94b",
+			},
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "ppc",
+			inputFile: "testassets/ppc.7z",
+			expected: map[string]string{
+				"ppc": "3a5c5d8c7a88bf3f3675f4f9cf416408",
+			},
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "sparc",
+			inputFile: "testassets/sparc.7z",
+			expected: map[string]string{
+				"sparc": "69dcad386a45447cec087a051cc45989",
+			},
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "arm64",
+			inputFile: "testassets/arm64.7z",
+			expected: map[string]string{
+				"arm64": "f32717155f76ac17ec4e0d12b294e9de",
+			},
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "bad_data_crc",
+			inputFile: "testassets/bad_data_crc.7z",
+			checkErr1: r.NoError,
+			checkErr2: r.Error,
+		},
+		{
+			name:      "bad_header_crc",
+			inputFile: "testassets/bad_header_crc.7z",
+			checkErr1: r.Error,
+		},
+		{
+			name:      "bad_lzma_data",
+			inputFile: "testassets/bad_lzma_data.7z",
+			checkErr1: r.NoError,
+			checkErr2: r.Error,
+		},
+		{
+			name:      "bad_truncated",
+			inputFile: "testassets/bad_truncated.7z",
+			checkErr1: r.Error,
+		},
+		{
+			name:      "not_7z",
+			inputFile: "../testassets/a.lzma",
+			checkErr1: r.Error,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			archive, err := OpenReader(tc.inputFile)
+			tc.checkErr1(err)
+			if err != nil {
+				return
+			}
+			defer archive.Close()
+
+			actual := make(map[string]string)
+
+			for _, f := range archive.File {
+				if f.IsDir {
+					actual[f.Name] = ""
+
+					continue
+				}
+
+				sum, err := fileMD5(f)
+				if err != nil {
+					tc.checkErr2(err)
+
+					return
+				}
+
+				actual[f.Name] = sum
+			}
+
+			tc.checkErr2(nil)
+			r.Equal(tc.expected, actual)
+		})
+	}
+}
+
+func TestReaderSolidOrder(t *testing.T) {
+	r := require.New(t)
+
+	archive, err := OpenReader("testassets/lzma.7z")
+	r.NoError(err)
+	defer archive.Close()
+
+	// backwards, then the same file twice, then forwards
+	order := []int{9, 5, 2, 2, 3, 8}
+	for _, i := range order {
+		f := archive.File[i]
+
+		sum, err := fileMD5(f)
+		r.NoError(err)
+		r.Equal(tenFiles[f.Name], sum, f.Name)
+	}
+}
+
+func TestReaderSFX(t *testing.T) {
+	r := require.New(t)
+
+	archive, err := os.ReadFile("testassets/lzma2.7z")
+	r.NoError(err)
+
+	// the stub contains the signature without valid start header
+	stub := append(bytes.Repeat([]byte("MZ stub "), 10000), signature...)
+	stub = append(stub, make([]byte, 100)...)
+	sfx := append(stub, archive...)
+
+	reader, err := NewReader(bytes.NewReader(sfx), int64(len(sfx)))
+	r.NoError(err)
+	r.Len(reader.File, 10)
+
+	for _, f := range reader.File {
+		sum, err := fileMD5(f)
+		r.NoError(err)
+		r.Equal(tenFiles[f.Name], sum)
+	}
+}
+
+func TestReaderFS(t *testing.T) {
+	r := require.New(t)
+
+	for _, name := range []string{"testassets/lzma.7z", "testassets/empty.7z", "testassets/file_and_empty.7z"} {
+		archive, err := OpenReader(name)
+		r.NoError(err)
+
+		var expected []string
+		for _, f := range archive.File {
+			expected = append(expected, f.Name)
+		}
+
+		r.NoError(fstest.TestFS(archive, expected...), name)
+		r.NoError(archive.Close())
+	}
+}
+
+func TestDetect(t *testing.T) {
+	r := require.New(t)
+
+	input, err := os.Open("testassets/bcj.7z")
+	r.NoError(err)
+	defer input.Close()
+
+	reader, format, err := lzma.NewReader(input)
+	r.NoError(err)
+	r.Equal(lzma.Format7z, format)
+
+	actual, err := io.ReadAll(reader)
+	r.NoError(err)
+
+	sum := md5.Sum(actual)
+	r.Equal("9c4639a5e395b1ae33d308510b1359a1", hex.EncodeToString(sum[:]))
+
+	for _, name := range []string{"testassets/lzma.7z", "testassets/empty2.7z"} {
+		input, err := os.Open(name)
+		r.NoError(err)
+		defer input.Close()
+
+		_, format, err = lzma.NewReader(input)
+		r.ErrorIs(err, errNotSingleFile, name)
+		r.Equal(lzma.Format7z, format)
+	}
+
+	// The signature followed by more data than is read into memory.
+	large := io.MultiReader(strings.NewReader(signature), io.LimitReader(zeroReader{}, singleFileArchiveMax))
+
+	_, format, err = lzma.NewReader(large)
+	r.ErrorIs(err, errArchiveTooLarge)
+	r.Equal(lzma.Format7z, format)
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+
+	return len(p), nil
+}
@@ -0,0 +1,603 @@
+package sevenzip
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"strings"
+
+	"github.com/kulaginds/lzma"
+)
+
+// Method is the compression method of Writer.
+type Method int
+
+const (
+	MethodCopy Method = iota
+	MethodLZMA
+	MethodLZMA2
+)
+
+// WriterConfig holds the options of Writer.
+type WriterConfig struct {
+	// Method compresses the files.
+	Method Method
+	// DictSize is the dictionary size of LZMA and LZMA2, zero selects
+	// lzma.DefaultDictSize.
+	DictSize int
+	// Solid compresses all files in one folder, otherwise every file is
+	// compressed separately.
+	Solid bool
+	// Password encrypts the files by 7zAES.
+	Password string
+	// EncryptHeader encrypts the header by 7zAES too, so the names of the
+	// files are not visible without the password.
+	EncryptHeader bool
+}
+
+// DefaultWriterConfig returns the configuration of 7-Zip: solid archive
+// compressed by LZMA2 with 8 MiB dictionary.
+func DefaultWriterConfig() WriterConfig {
+	return WriterConfig{
+		Method:   MethodLZMA2,
+		DictSize: lzma.DefaultDictSize,
+		Solid:    true,
+	}
+}
+
+var (
+	errWriterClosed  = errors.New("sevenzip: writer is closed")
+	errFileClosed    = errors.New("sevenzip: write to closed file")
+	errUnknownMethod = errors.New("sevenzip: unknown method")
+	errWriteDir      = errors.New("sevenzip: write to directory")
+)
+
+// Writer creates .7z archive. The signature header is written when the
+// writer is closed, so the output must be seekable.
+type Writer struct {
+	outStream io.WriteSeeker
+	counter   *countingWriter
+	cfg       WriterConfig
+	start     int64
+
+	streams streamsInfo
+	files   []fileEntry
+	file    *fileWriter
+
+	// the folder being written
+	encoder     io.WriteCloser
+	coder       coder
+	folderStart int64
+	folderSize  int64
+	inFolder    int
+
+	lzma1 *lzma.Writer1
+	lzma2 *lzma.Writer2
+
+	// 7zAES encrypter of the folder, counter counts its input
+	key        []byte
+	aes        *aesWriter
+	aesCoder   coder
+	aesCounter *countingWriter
+
+	closed bool
+}
+
+// NewWriter creates writer with DefaultWriterConfig.
+func NewWriter(outStream io.WriteSeeker) (*Writer, error) {
+	return NewWriterConfig(outStream, DefaultWriterConfig())
+}
+
+// NewWriterConfig creates the writer. The archive starts at the current
+// position of outStream, so it may follow SFX stub.
+func NewWriterConfig(outStream io.WriteSeeker, cfg WriterConfig) (*Writer, error) {
+	if cfg.DictSize == 0 {
+		cfg.DictSize = lzma.DefaultDictSize
+	}
+
+	w := &Writer{
+		outStream: outStream,
+		counter:   &countingWriter{w: outStream},
+		cfg:       cfg,
+	}
+
+	if cfg.EncryptHeader && cfg.Password == "" {
+		return nil, errNoPassword
+	}
+
+	if cfg.Password != "" {
+		w.key = deriveKey(cfg.Password, nil, aesCycles)
+	}
+
+	var err error
+
+	switch cfg.Method {
+	case MethodCopy:
+		w.coder = coder{id: []byte(methodCopy), numInStreams: 1, numOutStreams: 1}
+	case MethodLZMA:
+		props := lzma.DefaultProperties()
+		props.DictSize = uint32(cfg.DictSize)
+
+		w.lzma1, err = lzma.NewRawWriter1(w.counter, props, false)
+		if err != nil {
+			return nil, err
+		}
+
+		w.coder = coder{id: []byte(methodLZMA), numInStreams: 1, numOutStreams: 1, props: props.Encode()}
+	case MethodLZMA2:
+		w.lzma2, err = lzma.NewWriter2(w.counter, cfg.DictSize)
+		if err != nil {
+			return nil, err
+		}
+
+		w.coder = coder{
+			id:            []byte(methodLZMA2),
+			numInStreams:  1,
+			numOutStreams: 1,
+			props:         []byte{lzma.EncodeDictSize2(w.lzma2.DictSize())},
+		}
+	default:
+		return nil, errUnknownMethod
+	}
+
+	start, err := outStream.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	w.start = start
+
+	// the signature header is written by Close
+	_, err = outStream.Write(make([]byte, signatureHeaderLen))
+	if err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Create adds the file to the archive, the name ending with slash adds the
+// directory. The file is written until the next call of Create, CreateHeader
+// or Close.
+func (w *Writer) Create(name string) (io.Writer, error) {
+	return w.CreateHeader(&FileHeader{Name: name})
+}
+
+// CreateHeader adds the file described by fh to the archive, fh.Size is
+// ignored. The file is written until the next call of Create, CreateHeader
+// or Close.
+func (w *Writer) CreateHeader(fh *FileHeader) (io.Writer, error) {
+	if w.closed {
+		return nil, errWriterClosed
+	}
+
+	err := w.finishFile()
+	if err != nil {
+		return nil, err
+	}
+
+	isDir := fh.IsDir || strings.HasSuffix(fh.Name, "/")
+
+	attrib := fh.Attributes
+	if isDir {
+		attrib |= attrDirectory
+	}
+
+	w.files = append(w.files, fileEntry{
+		name:        strings.TrimSuffix(fh.Name, "/"),
+		isDir:       isDir,
+		attrib:      attrib,
+		hasAttrib:   true,
+		modified:    fh.Modified,
+		created:     fh.Created,
+		accessed:    fh.Accessed,
+		hasModified: !fh.Modified.IsZero(),
+	})
+
+	w.file = &fileWriter{
+		w:     w,
+		index: len(w.files) - 1,
+		isDir: isDir,
+		crc:   crc32.NewIEEE(),
+	}
+
+	return w.file, nil
+}
+
+type fileWriter struct {
+	w     *Writer
+	index int
+	isDir bool
+	crc   hash.Hash32
+	size  int64
+}
+
+func (fw *fileWriter) Write(p []byte) (n int, err error) {
+	w := fw.w
+
+	if w.file != fw {
+		return 0, errFileClosed
+	}
+
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if fw.isDir {
+		return 0, errWriteDir
+	}
+
+	if w.encoder == nil {
+		err = w.startFolder()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err = w.encoder.Write(p)
+	_, _ = fw.crc.Write(p[:n])
+	fw.size += int64(n)
+	w.folderSize += int64(n)
+
+	return n, err
+}
+
+// finishFile adds the substream of the current file, files without data
+// are stored as empty.
+func (w *Writer) finishFile() error {
+	fw := w.file
+	if fw == nil {
+		return nil
+	}
+
+	w.file = nil
+
+	if fw.size == 0 {
+		return nil
+	}
+
+	w.files[fw.index].hasStream = true
+	w.streams.substreams = append(w.streams.substreams, substream{
+		size:   fw.size,
+		hasCRC: true,
+		crc:    fw.crc.Sum32(),
+	})
+	w.inFolder++
+
+	if !w.cfg.Solid {
+		return w.finishFolder()
+	}
+
+	return nil
+}
+
+func (w *Writer) startFolder() error {
+	w.folderStart = w.counter.n
+	w.folderSize = 0
+	w.inFolder = 0
+
+	var out io.Writer = w.counter
+
+	if w.key != nil {
+		var err error
+
+		w.aes, w.aesCoder, err = w.newEncrypter(w.counter)
+		if err != nil {
+			return err
+		}
+
+		w.aesCounter = &countingWriter{w: w.aes}
+		out = w.aesCounter
+	}
+
+	switch w.cfg.Method {
+	case MethodCopy:
+		w.encoder = nopWriteCloser{out}
+	case MethodLZMA:
+		w.lzma1.Reset(out)
+		w.encoder = w.lzma1
+	case MethodLZMA2:
+		w.lzma2.Reset(out)
+		w.encoder = w.lzma2
+	}
+
+	return nil
+}
+
+// newEncrypter creates 7zAES encrypter with random IV and its coder.
+func (w *Writer) newEncrypter(outStream io.Writer) (*aesWriter, coder, error) {
+	p := aesProps{cycles: aesCycles}
+
+	_, err := rand.Read(p.iv[:])
+	if err != nil {
+		return nil, coder{}, err
+	}
+
+	aw, err := newAESWriter(outStream, w.key, p.iv[:])
+	if err != nil {
+		return nil, coder{}, err
+	}
+
+	return aw, coder{id: []byte(methodAES), numInStreams: 1, numOutStreams: 1, props: p.encode()}, nil
+}
+
+// encryptFolder prepends 7zAES coder whose output of size n is the packed
+// stream of the folder. The folder must have one packed stream.
+func encryptFolder(f *folder, c coder, n int64) {
+	for i := range f.bindPairs {
+		f.bindPairs[i].inIndex++
+		f.bindPairs[i].outIndex++
+	}
+
+	f.bindPairs = append(f.bindPairs, bindPair{inIndex: f.packedStreams[0] + 1, outIndex: 0})
+	f.packedStreams = []int{0}
+	f.coders = append([]coder{c}, f.coders...)
+	f.unpackSizes = append([]int64{n}, f.unpackSizes...)
+}
+
+// finishFolder flushes the encoder and adds the folder with its packed
+// stream.
+func (w *Writer) finishFolder() error {
+	if w.encoder == nil {
+		return nil
+	}
+
+	err := w.encoder.Close()
+	w.encoder = nil
+
+	if err != nil {
+		return err
+	}
+
+	f := &folder{
+		coders:        []coder{w.coder},
+		packedStreams: []int{0},
+		unpackSizes:   []int64{w.folderSize},
+	}
+
+	if w.aes != nil {
+		err = w.aes.Close()
+		if err != nil {
+			return err
+		}
+
+		encryptFolder(f, w.aesCoder, w.aesCounter.n)
+		w.aes = nil
+	}
+
+	s := &w.streams
+	s.packSizes = append(s.packSizes, w.counter.n-w.folderStart)
+	s.folders = append(s.folders, f)
+	s.numUnpackStreams = append(s.numUnpackStreams, w.inFolder)
+
+	return nil
+}
+
+// Close writes the header and the signature header. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return errWriterClosed
+	}
+
+	w.closed = true
+
+	err := w.finishFile()
+	if err != nil {
+		return err
+	}
+
+	err = w.finishFolder()
+	if err != nil {
+		return err
+	}
+
+	var sh startHeader
+
+	if len(w.files) > 0 {
+		hw := &headerWriter{}
+		hw.writeHeader(&header{streams: &w.streams, files: w.files})
+
+		buf, err := w.encodeHeader(hw.Bytes())
+		if err != nil {
+			return err
+		}
+
+		sh.nextHeaderOffset = w.counter.n
+		sh.nextHeaderSize = int64(len(buf))
+		sh.nextHeaderCRC = crc32.ChecksumIEEE(buf)
+
+		_, err = w.counter.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = w.outStream.Seek(w.start, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.outStream.Write(appendSignatureHeader(nil, sh))
+	if err != nil {
+		return err
+	}
+
+	_, err = w.outStream.Seek(w.start+signatureHeaderLen+w.counter.n, io.SeekStart)
+
+	return err
+}
+
+// encodeHeader compresses the header by LZMA and encrypts it if
+// EncryptHeader is set, writes it as the packed stream and returns the
+// encoded header which refers to it.
+func (w *Writer) encodeHeader(buf []byte) ([]byte, error) {
+	props := lzma.DefaultProperties()
+	props.DictSize = headerDictSize(len(buf))
+
+	var (
+		packed     bytes.Buffer
+		out        io.Writer = &packed
+		aw         *aesWriter
+		aesCoder   coder
+		aesCounter *countingWriter
+		err        error
+	)
+
+	if w.cfg.EncryptHeader {
+		aw, aesCoder, err = w.newEncrypter(&packed)
+		if err != nil {
+			return nil, err
+		}
+
+		aesCounter = &countingWriter{w: aw}
+		out = aesCounter
+	}
+
+	enc, err := lzma.NewRawWriter1(out, props, false)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = enc.Write(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	err = enc.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	f := &folder{
+		coders:        []coder{{id: []byte(methodLZMA), numInStreams: 1, numOutStreams: 1, props: props.Encode()}},
+		packedStreams: []int{0},
+		unpackSizes:   []int64{int64(len(buf))},
+		hasCRC:        true,
+		crc:           crc32.ChecksumIEEE(buf),
+	}
+
+	if aw != nil {
+		err = aw.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		encryptFolder(f, aesCoder, aesCounter.n)
+	}
+
+	s := &streamsInfo{
+		packPos:   w.counter.n,
+		packSizes: []int64{int64(packed.Len())},
+		folders:   []*folder{f},
+	}
+
+	_, err = w.counter.Write(packed.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	hw := &headerWriter{}
+	hw.writeByte(idEncodedHeader)
+	hw.writeStreamsInfo(s)
+
+	return hw.Bytes(), nil
+}
+
+// headerDictSize returns the smallest power of two dictionary that holds
+// the header.
+func headerDictSize(n int) uint32 {
+	size := uint32(1 << 12)
+	for size < uint32(n) && size < 1<<30 {
+		size <<= 1
+	}
+
+	return size
+}
+
+// SetMode sets the attributes of the file to the Windows attributes and
+// Unix mode as 7-Zip does.
+func (h *FileHeader) SetMode(mode fs.FileMode) {
+	h.Attributes = attrUnixExtension | fileModeToUnixMode(mode)<<16
+
+	if mode&0o200 == 0 {
+		h.Attributes |= attrReadOnly
+	}
+
+	if mode.IsDir() {
+		h.Attributes |= attrDirectory
+		h.IsDir = true
+	}
+}
+
+func fileModeToUnixMode(mode fs.FileMode) uint32 {
+	m := uint32(mode.Perm())
+
+	switch {
+	case mode&fs.ModeDir != 0:
+		m |= unixTypeDir
+	case mode&fs.ModeSymlink != 0:
+		m |= unixTypeSymlink
+	case mode&fs.ModeNamedPipe != 0:
+		m |= unixTypeFIFO
+	case mode&fs.ModeSocket != 0:
+		m |= unixTypeSocket
+	case mode&fs.ModeCharDevice != 0:
+		m |= unixTypeChar
+	case mode&fs.ModeDevice != 0:
+		m |= unixTypeBlock
+	default:
+		m |= 0o100000
+	}
+
+	if mode&fs.ModeSetuid != 0 {
+		m |= 0o4000
+	}
+
+	if mode&fs.ModeSetgid != 0 {
+		m |= 0o2000
+	}
+
+	if mode&fs.ModeSticky != 0 {
+		m |= 0o1000
+	}
+
+	return m
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func appendSignatureHeader(b []byte, h startHeader) []byte {
+	b = append(b, signature...)
+	b = append(b, versionMajor, versionMinor)
+
+	var buf [20]byte
+	binary.LittleEndian.PutUint64(buf[0:], uint64(h.nextHeaderOffset))
+	binary.LittleEndian.PutUint64(buf[8:], uint64(h.nextHeaderSize))
+	binary.LittleEndian.PutUint32(buf[16:], h.nextHeaderCRC)
+
+	b = binary.LittleEndian.AppendUint32(b, crc32.ChecksumIEEE(buf[:]))
+
+	return append(b, buf[:]...)
+}
@@ -0,0 +1,272 @@
+package sevenzip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kulaginds/lzma/internal/testgen"
+)
+
+// emptyArchive is the output of 7-Zip for no files.
+var emptyArchive = []byte{
+	0x37, 0x7a, 0xbc, 0xaf, 0x27, 0x1c, 0x00, 0x04, 0x8d, 0x9b, 0xd5, 0x0f,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+// seekBuffer is in-memory io.WriteSeeker.
+type seekBuffer struct {
+	buf []byte
+	pos int
+}
+
+func (b *seekBuffer) Write(p []byte) (int, error) {
+	if end := b.pos + len(p); end > len(b.buf) {
+		b.buf = append(b.buf, make([]byte, end-len(b.buf))...)
+	}
+
+	n := copy(b.buf[b.pos:], p)
+	b.pos += n
+
+	return n, nil
+}
+
+func (b *seekBuffer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += int64(b.pos)
+	case io.SeekEnd:
+		offset += int64(len(b.buf))
+	}
+
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	b.pos = int(offset)
+
+	return offset, nil
+}
+
+type testFile struct {
+	header FileHeader
+	data   []byte
+}
+
+func testFiles() []testFile {
+	modified := time.Date(2023, 5, 17, 10, 20, 30, 123456700, time.UTC)
+
+	exec := FileHeader{Name: "dir/run.sh", Modified: modified}
+	exec.SetMode(0o755)
+
+	dir := FileHeader{Name: "dir/sub", Modified: modified}
+	dir.SetMode(fs.ModeDir | 0o700)
+
+	return []testFile{
+		{header: FileHeader{Name: "dir/", Modified: modified}},
+		{header: FileHeader{Name: "dir/a.txt", Modified: modified}, data: testgen.Text(100000, 1)},
+		{header: FileHeader{Name: "empty", Modified: modified, Created: modified, Accessed: modified}},
+		{header: exec, data: []byte("#!/bin/sh\necho 7z\n")},
+		{header: dir},
+		{header: FileHeader{Name: "dir/sub/b.bin", Attributes: attrReadOnly}, data: testgen.Text(70000, 2)},
+		{header: FileHeader{Name: "dir/sub/c.bin"}, data: testgen.Text(1, 3)},
+	}
+}
+
+func writeArchive(t *testing.T, cfg WriterConfig, files []testFile) []byte {
+	t.Helper()
+
+	var out seekBuffer
+
+	w, err := NewWriterConfig(&out, cfg)
+	require.NoError(t, err)
+
+	for _, f := range files {
+		fh := f.header
+
+		fw, err := w.CreateHeader(&fh)
+		require.NoError(t, err)
+
+		// the data is written in two parts
+		half := len(f.data) / 2
+
+		_, err = fw.Write(f.data[:half])
+		require.NoError(t, err)
+
+		_, err = fw.Write(f.data[half:])
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, w.Close())
+
+	return out.buf
+}
+
+func TestWriter(t *testing.T) {
+	files := testFiles()
+
+	testCases := []struct {
+		name string
+
+		cfg     WriterConfig
+		folders int
+	}{
+		{
+			name:    "default",
+			cfg:     DefaultWriterConfig(),
+			folders: 1,
+		},
+		{
+			name:    "lzma2_non_solid",
+			cfg:     WriterConfig{Method: MethodLZMA2, DictSize: 1 << 16},
+			folders: 4,
+		},
+		{
+			name:    "lzma_solid",
+			cfg:     WriterConfig{Method: MethodLZMA, Solid: true},
+			folders: 1,
+		},
+		{
+			name:    "lzma_non_solid",
+			cfg:     WriterConfig{Method: MethodLZMA, DictSize: 1 << 16},
+			folders: 4,
+		},
+		{
+			name:    "copy",
+			cfg:     WriterConfig{Method: MethodCopy, Solid: true},
+			folders: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			archive := writeArchive(t, tc.cfg, files)
+
+			reader, err := NewReader(bytes.NewReader(archive), int64(len(archive)))
+			r.NoError(err)
+			r.Len(reader.File, len(files))
+			r.Len(reader.streams.folders, tc.folders)
+
+			for i, f := range reader.File {
+				expected := files[i].header
+				isDir := expected.IsDir || strings.HasSuffix(expected.Name, "/")
+
+				r.Equal(strings.TrimSuffix(expected.Name, "/"), f.Name)
+				r.Equal(isDir, f.IsDir, f.Name)
+				r.Equal(int64(len(files[i].data)), f.Size, f.Name)
+				r.True(expected.Modified.Equal(f.Modified), f.Name)
+				r.True(expected.Created.Equal(f.Created), f.Name)
+
+				if expected.Attributes&attrUnixExtension != 0 {
+					r.Equal(expected.Mode(), f.Mode(), f.Name)
+				}
+
+				rc, err := f.Open()
+				r.NoError(err)
+
+				actual, err := io.ReadAll(rc)
+				r.NoError(err)
+				r.NoError(rc.Close())
+
+				r.Equal(len(files[i].data), len(actual), f.Name)
+				r.True(bytes.Equal(files[i].data, actual), f.Name)
+			}
+
+			r.Equal(fs.FileMode(0o755), reader.File[3].Mode())
+			r.Equal(fs.ModeDir|0o700, reader.File[4].Mode())
+			r.Equal(fs.FileMode(0o444), reader.File[5].Mode())
+		})
+	}
+}
+
+func TestWriterEmpty(t *testing.T) {
+	r := require.New(t)
+
+	var out seekBuffer
+
+	w, err := NewWriter(&out)
+	r.NoError(err)
+	r.NoError(w.Close())
+
+	r.Equal(emptyArchive, out.buf)
+
+	reader, err := NewReader(bytes.NewReader(out.buf), int64(len(out.buf)))
+	r.NoError(err)
+	r.Empty(reader.File)
+}
+
+func TestWriterSFX(t *testing.T) {
+	r := require.New(t)
+
+	stub := bytes.Repeat([]byte("MZ stub "), 1000)
+	out := seekBuffer{buf: append([]byte{}, stub...), pos: len(stub)}
+
+	w, err := NewWriter(&out)
+	r.NoError(err)
+
+	fw, err := w.Create("a.txt")
+	r.NoError(err)
+
+	data := testgen.Text(10000, 4)
+
+	_, err = fw.Write(data)
+	r.NoError(err)
+	r.NoError(w.Close())
+
+	r.Equal(stub, out.buf[:len(stub)])
+
+	reader, err := NewReader(bytes.NewReader(out.buf), int64(len(out.buf)))
+	r.NoError(err)
+	r.Len(reader.File, 1)
+
+	rc, err := reader.File[0].Open()
+	r.NoError(err)
+
+	actual, err := io.ReadAll(rc)
+	r.NoError(err)
+	r.Equal(data, actual)
+}
+
+func TestWriterErrors(t *testing.T) {
+	r := require.New(t)
+
+	_, err := NewWriterConfig(&seekBuffer{}, WriterConfig{Method: Method(10)})
+	r.Error(err)
+
+	_, err = NewWriterConfig(&seekBuffer{}, WriterConfig{Method: MethodLZMA2, DictSize: 100})
+	r.Error(err)
+
+	w, err := NewWriter(&seekBuffer{})
+	r.NoError(err)
+
+	dir, err := w.Create("dir/")
+	r.NoError(err)
+
+	_, err = dir.Write([]byte("data"))
+	r.Error(err)
+
+	first, err := w.Create("first")
+	r.NoError(err)
+
+	_, err = w.Create("second")
+	r.NoError(err)
+
+	_, err = first.Write([]byte("data"))
+	r.Error(err)
+
+	r.NoError(w.Close())
+	r.Error(w.Close())
+
+	_, err = w.Create("third")
+	r.Error(err)
+}
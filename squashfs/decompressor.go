@@ -0,0 +1,232 @@
+// Package squashfs decompresses the metadata and data blocks of SquashFS
+// images compressed by xz or legacy lzma. Reading the image itself is left
+// to the caller.
+package squashfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+
+	"github.com/kulaginds/lzma"
+	"github.com/kulaginds/lzma/xz"
+)
+
+// Compression IDs of the superblock.
+const (
+	CompressionLZMA uint16 = 2
+	CompressionXZ   uint16 = 4
+)
+
+// Flags of BCJ filters in XZOptions, mksquashfs -Xbcj chooses among them the
+// filter which gives the smallest block.
+const (
+	XZFilterX86 uint32 = 1 << iota
+	XZFilterPowerPC
+	XZFilterIA64
+	XZFilterARM
+	XZFilterARMThumb
+	XZFilterSPARC
+
+	xzFiltersAll = XZFilterX86 | XZFilterPowerPC | XZFilterIA64 | XZFilterARM | XZFilterARMThumb | XZFilterSPARC
+)
+
+// xzOptionsLen is the size of xz compressor options.
+const xzOptionsLen = 8
+
+// XZOptions are xz compressor options stored after the superblock.
+type XZOptions struct {
+	DictSize uint32
+	Filters  uint32
+}
+
+// ParseXZOptions parses xz compressor options, the dictionary size must be
+// 2^n or 3*2^n and not less than 8 KiB as mksquashfs writes it.
+func ParseXZOptions(data []byte) (XZOptions, error) {
+	if len(data) != xzOptionsLen {
+		return XZOptions{}, ErrOptions
+	}
+
+	opts := XZOptions{
+		DictSize: binary.LittleEndian.Uint32(data),
+		Filters:  binary.LittleEndian.Uint32(data[4:]),
+	}
+
+	if opts.DictSize < 8192 {
+		return XZOptions{}, fmt.Errorf("%w: dictionary size %d", ErrOptions, opts.DictSize)
+	}
+
+	if n := opts.DictSize >> bits.TrailingZeros32(opts.DictSize); n != 1 && n != 3 {
+		return XZOptions{}, fmt.Errorf("%w: dictionary size %d", ErrOptions, opts.DictSize)
+	}
+
+	if opts.Filters&^xzFiltersAll != 0 {
+		return XZOptions{}, fmt.Errorf("%w: filters %#x", ErrOptions, opts.Filters)
+	}
+
+	return opts, nil
+}
+
+// Decompressor decompresses the blocks of one image. It keeps the decoder
+// between the blocks, so the window is allocated once for the buffer size.
+// It is not safe for concurrent use.
+type Decompressor struct {
+	compression uint16
+	options     XZOptions
+
+	src  bytes.Reader
+	xz   *xz.Reader
+	lzma *lzma.Reader1
+
+	// xzWindowMax is the window limit of xz, the largest buffer so far.
+	xzWindowMax int
+}
+
+// NewDecompressor creates the decompressor for the compression ID and the
+// compressor options of the superblock, options are nil if the image has
+// none. Legacy lzma has no options.
+func NewDecompressor(compression uint16, options []byte) (*Decompressor, error) {
+	d := &Decompressor{compression: compression}
+
+	switch compression {
+	case CompressionXZ:
+		if options != nil {
+			opts, err := ParseXZOptions(options)
+			if err != nil {
+				return nil, err
+			}
+
+			d.options = opts
+		}
+	case CompressionLZMA:
+		if len(options) != 0 {
+			return nil, ErrOptions
+		}
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedCompression, compression)
+	}
+
+	return d, nil
+}
+
+// XZOptions returns the xz compressor options, they are zero if the image
+// has none. The xz block names its filters itself, as in unsquashfs the
+// options are not needed to decode it.
+func (d *Decompressor) XZOptions() XZOptions {
+	return d.options
+}
+
+// Decompress decodes the compressed block src into dst and returns the size
+// of the block. The block must fit dst, usually of the block size of the
+// superblock or 8 KiB for metadata.
+func (d *Decompressor) Decompress(dst, src []byte) (int, error) {
+	d.src.Reset(src)
+
+	r, err := d.reset(len(dst))
+
+	n := 0
+	if err == nil {
+		n, err = readBlock(r, dst)
+	}
+
+	if err != nil && !errors.Is(err, ErrBlockTooLarge) {
+		err = fmt.Errorf("%w: %w", ErrCorrupted, err)
+	}
+
+	return n, err
+}
+
+// reset prepares the decoder for the block of at most size bytes.
+func (d *Decompressor) reset(size int) (io.Reader, error) {
+	if d.compression == CompressionLZMA {
+		err := d.resetLZMA(size)
+		if err != nil {
+			return nil, err
+		}
+
+		return d.lzma, nil
+	}
+
+	if d.xz != nil && size <= d.xzWindowMax {
+		err := d.xz.Reset(&d.src)
+		if err != nil {
+			return nil, err
+		}
+
+		return d.xz, nil
+	}
+
+	r, err := xz.NewReaderConfig(&d.src, xz.ReaderConfig{WindowMax: size})
+	if err != nil {
+		return nil, err
+	}
+
+	d.xz, d.xzWindowMax = r, size
+
+	return r, nil
+}
+
+// resetLZMA reads the header of lzma block. The window is sized by the
+// buffer, which holds the whole block, instead of the dictionary size, so
+// it is reused for all blocks.
+func (d *Decompressor) resetLZMA(size int) error {
+	var header [lzma.LZMAHeaderLen]byte
+
+	_, err := io.ReadFull(&d.src, header[:])
+	if err != nil {
+		return io.ErrUnexpectedEOF
+	}
+
+	props, err := lzma.DecodeProperties(header[:lzma.LZMAPropsLen])
+	if err != nil {
+		return err
+	}
+
+	unpackSize := lzma.DecodeUnpackSize(header[lzma.LZMAPropsLen:])
+	if unpackSize != lzma.UnpackSizeUnknown && unpackSize > uint64(size) {
+		return ErrBlockTooLarge
+	}
+
+	props.DictSize = uint32(size)
+
+	if d.lzma != nil {
+		return d.lzma.ResetRaw(&d.src, props, unpackSize)
+	}
+
+	d.lzma, err = lzma.NewRawReader1(&d.src, props, unpackSize, lzma.EndMarkerOptional)
+
+	return err
+}
+
+// readBlock reads r to the end into dst.
+func readBlock(r io.Reader, dst []byte) (int, error) {
+	var (
+		n     int
+		extra [1]byte
+	)
+
+	for {
+		buf := dst[n:]
+		if len(buf) == 0 {
+			buf = extra[:]
+		}
+
+		k, err := r.Read(buf)
+		if k > 0 && n == len(dst) {
+			return n, ErrBlockTooLarge
+		}
+
+		n += k
+
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		}
+
+		if err != nil {
+			return n, err
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package squashfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kulaginds/lzma"
+)
+
+// blockSize is the block size of the test image.
+const blockSize = 128 << 10
+
+func readFile(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+
+	return data
+}
+
+// lzmaBlock compresses data as squashfs-tools lzma_wrapper with LZMA SDK:
+// the header with the unpack size and no end marker.
+func lzmaBlock(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	props := lzma.DefaultProperties()
+	props.DictSize = blockSize
+
+	var buf bytes.Buffer
+
+	buf.Write(props.Encode())
+	_ = binary.Write(&buf, binary.LittleEndian, uint64(len(data)))
+
+	w, err := lzma.NewRawWriter1(&buf, props, false)
+	require.NoError(t, err)
+
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	return buf.Bytes()
+}
+
+func xzOptions(dictSize, filters uint32) []byte {
+	options := make([]byte, xzOptionsLen)
+	binary.LittleEndian.PutUint32(options, dictSize)
+	binary.LittleEndian.PutUint32(options[4:], filters)
+
+	return options
+}
+
+func TestDecompressXZ(t *testing.T) {
+	r := require.New(t)
+
+	d, err := NewDecompressor(CompressionXZ, xzOptions(blockSize, XZFilterX86))
+	r.NoError(err)
+	r.Equal(XZOptions{DictSize: blockSize, Filters: XZFilterX86}, d.XZOptions())
+
+	expected := readFile(t, "../testassets/a.txt")
+	x86 := readFile(t, "../testassets/x86.bin")
+
+	blocks := []struct {
+		name     string
+		expected []byte
+	}{
+		{name: "testassets/a.xz", expected: expected},
+		{name: "testassets/x86.xz", expected: x86},
+		{name: "testassets/a.xz", expected: expected},
+	}
+
+	dst := make([]byte, blockSize)
+
+	for _, block := range blocks {
+		n, err := d.Decompress(dst, readFile(t, block.name))
+		r.NoError(err, block.name)
+		r.True(bytes.Equal(block.expected, dst[:n]), block.name)
+	}
+}
+
+func TestDecompressXZWindowMax(t *testing.T) {
+	r := require.New(t)
+
+	d, err := NewDecompressor(CompressionXZ, nil)
+	r.NoError(err)
+
+	expected := readFile(t, "../testassets/a.txt")
+	x86 := readFile(t, "../testassets/x86.bin")
+
+	// The block of a.xz has 8 MiB dictionary, the window is sized by the
+	// metadata buffer.
+	var before, after runtime.MemStats
+
+	runtime.ReadMemStats(&before)
+
+	metadata := make([]byte, 8<<10)
+
+	n, err := d.Decompress(metadata, readFile(t, "testassets/a.xz"))
+	r.NoError(err)
+	r.Equal(expected, metadata[:n])
+
+	runtime.ReadMemStats(&after)
+
+	r.Less(after.TotalAlloc-before.TotalAlloc, uint64(1<<20))
+
+	// The larger buffer needs the larger window.
+	dst := make([]byte, blockSize)
+
+	n, err = d.Decompress(dst, readFile(t, "testassets/x86.xz"))
+	r.NoError(err)
+	r.Equal(x86, dst[:n])
+}
+
+func TestDecompressLZMA(t *testing.T) {
+	r := require.New(t)
+
+	d, err := NewDecompressor(CompressionLZMA, nil)
+	r.NoError(err)
+
+	expected := readFile(t, "../testassets/a.txt")
+	x86 := readFile(t, "../testassets/x86.bin")
+
+	blocks := []struct {
+		name     string
+		block    []byte
+		expected []byte
+	}{
+		{name: "lzma_xz_wrapper", block: readFile(t, "testassets/a_eos.lzma"), expected: expected},
+		{name: "lzma_wrapper", block: lzmaBlock(t, x86), expected: x86},
+		{name: "lzma_wrapper small", block: lzmaBlock(t, expected), expected: expected},
+		{name: "empty", block: lzmaBlock(t, nil), expected: []byte{}},
+		{name: "lzma_xz_wrapper again", block: readFile(t, "testassets/a_eos.lzma"), expected: expected},
+	}
+
+	dst := make([]byte, blockSize)
+
+	for _, block := range blocks {
+		n, err := d.Decompress(dst, block.block)
+		r.NoError(err, block.name)
+		r.Equal(block.expected, dst[:n], block.name)
+	}
+}
+
+func TestDecompressReusesWindow(t *testing.T) {
+	x86 := readFile(t, "../testassets/x86.bin")
+
+	tests := []struct {
+		compression uint16
+		block       []byte
+	}{
+		{compression: CompressionXZ, block: readFile(t, "testassets/x86.xz")},
+		{compression: CompressionLZMA, block: lzmaBlock(t, x86)},
+	}
+
+	for _, tt := range tests {
+		r := require.New(t)
+
+		d, err := NewDecompressor(tt.compression, nil)
+		r.NoError(err)
+
+		dst := make([]byte, blockSize)
+
+		_, err = d.Decompress(dst, tt.block)
+		r.NoError(err)
+
+		const blocks = 10
+
+		var before, after runtime.MemStats
+
+		runtime.ReadMemStats(&before)
+
+		for i := 0; i < blocks; i++ {
+			n, err := d.Decompress(dst, tt.block)
+			r.NoError(err)
+			r.Equal(x86, dst[:n])
+		}
+
+		runtime.ReadMemStats(&after)
+
+		// Every block would allocate the window of the block size.
+		r.Less(after.TotalAlloc-before.TotalAlloc, uint64(blocks*blockSize), tt.compression)
+	}
+}
+
+func TestDecompressErrors(t *testing.T) {
+	expected := readFile(t, "../testassets/a.txt")
+	xzBlock := readFile(t, "testassets/a.xz")
+	lzmaEOSBlock := readFile(t, "testassets/a_eos.lzma")
+
+	sizeUnknown := bytes.Clone(lzmaEOSBlock)
+	binary.LittleEndian.PutUint64(sizeUnknown[5:], lzma.UnpackSizeUnknown)
+
+	tests := []struct {
+		name        string
+		compression uint16
+		block       []byte
+		dstSize     int
+		err         error
+	}{
+		{name: "xz too large", compression: CompressionXZ, block: xzBlock, dstSize: len(expected) - 1, err: ErrBlockTooLarge},
+		{name: "xz fits", compression: CompressionXZ, block: xzBlock, dstSize: len(expected)},
+		{name: "xz truncated", compression: CompressionXZ, block: xzBlock[:len(xzBlock)-10], dstSize: blockSize, err: ErrCorrupted},
+		{name: "xz not xz", compression: CompressionXZ, block: lzmaEOSBlock, dstSize: blockSize, err: ErrCorrupted},
+		{name: "xz empty", compression: CompressionXZ, block: nil, dstSize: blockSize, err: ErrCorrupted},
+		{name: "lzma too large", compression: CompressionLZMA, block: lzmaEOSBlock, dstSize: len(expected) - 1, err: ErrBlockTooLarge},
+		{name: "lzma size unknown too large", compression: CompressionLZMA, block: sizeUnknown, dstSize: len(expected) - 1, err: ErrBlockTooLarge},
+		{name: "lzma size unknown", compression: CompressionLZMA, block: sizeUnknown, dstSize: blockSize},
+		{name: "lzma truncated", compression: CompressionLZMA, block: lzmaEOSBlock[:len(lzmaEOSBlock)-10], dstSize: blockSize, err: ErrCorrupted},
+		{name: "lzma short header", compression: CompressionLZMA, block: lzmaEOSBlock[:12], dstSize: blockSize, err: ErrCorrupted},
+		{name: "lzma bad properties", compression: CompressionLZMA, block: append([]byte{0xFF}, lzmaEOSBlock[1:]...), dstSize: blockSize, err: ErrCorrupted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := require.New(t)
+
+			d, err := NewDecompressor(tt.compression, nil)
+			r.NoError(err)
+
+			dst := make([]byte, tt.dstSize)
+
+			n, err := d.Decompress(dst, tt.block)
+			if tt.err != nil {
+				r.ErrorIs(err, tt.err)
+			} else {
+				r.NoError(err)
+				r.Equal(expected, dst[:n])
+			}
+
+			// The decompressor is usable after the error.
+			dst = make([]byte, blockSize)
+
+			valid := xzBlock
+			if tt.compression == CompressionLZMA {
+				valid = lzmaEOSBlock
+			}
+
+			n, err = d.Decompress(dst, valid)
+			r.NoError(err)
+			r.Equal(expected, dst[:n])
+		})
+	}
+}
+
+func TestNewDecompressor(t *testing.T) {
+	tests := []struct {
+		name        string
+		compression uint16
+		options     []byte
+		err         error
+	}{
+		{name: "xz", compression: CompressionXZ},
+		{name: "xz options", compression: CompressionXZ, options: xzOptions(3<<15, XZFilterARM|XZFilterSPARC)},
+		{name: "xz short options", compression: CompressionXZ, options: []byte{0, 0, 2, 0}, err: ErrOptions},
+		{name: "xz small dictionary", compression: CompressionXZ, options: xzOptions(4096, 0), err: ErrOptions},
+		{name: "xz odd dictionary", compression: CompressionXZ, options: xzOptions(5<<13, 0), err: ErrOptions},
+		{name: "xz unknown filter", compression: CompressionXZ, options: xzOptions(1<<17, 1<<6), err: ErrOptions},
+		{name: "lzma", compression: CompressionLZMA},
+		{name: "lzma options", compression: CompressionLZMA, options: xzOptions(1<<17, 0), err: ErrOptions},
+		{name: "gzip", compression: 1, err: ErrUnsupportedCompression},
+		{name: "zstd", compression: 6, err: ErrUnsupportedCompression},
+	}
+
+	for _, tt := range tests {
+		_, err := NewDecompressor(tt.compression, tt.options)
+		if tt.err != nil {
+			require.ErrorIs(t, err, tt.err, tt.name)
+		} else {
+			require.NoError(t, err, tt.name)
+		}
+	}
+}
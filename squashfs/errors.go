@@ -0,0 +1,10 @@
+package squashfs
+
+import "errors"
+
+var (
+	ErrUnsupportedCompression = errors.New("squashfs: unsupported compression")
+	ErrOptions                = errors.New("squashfs: invalid compressor options")
+	ErrBlockTooLarge          = errors.New("squashfs: block does not fit the buffer")
+	ErrCorrupted              = errors.New("squashfs: corrupted block")
+)
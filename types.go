@@ -2,7 +2,12 @@ package lzma
 
 import "unsafe"
 
-const lzmaHeaderLen = 13
+// Lengths of .lzma header: the properties with the dictionary size, followed
+// by the unpack size.
+const (
+	LZMAPropsLen  = 5
+	LZMAHeaderLen = LZMAPropsLen + 8
+)
 
 const (
 	lzmaDicMin = 1 << 12
@@ -98,3 +103,22 @@ const (
 type prob uint16
 
 const probSize = unsafe.Sizeof(prob(0))
+
+// Limits of LZMA2 chunks: the uncompressed size of LZMA chunk fits in 21
+// bits, the compressed size and the size of uncompressed chunk fit in 16 bits.
+const (
+	lzma2ChunkUnpackedMax     = 1 << 21
+	lzma2ChunkPackedMax       = 1 << 16
+	lzma2UncompressedChunkMax = 1 << 16
+
+	// lzma2ChunkPackedReserve is more than the largest symbol can take.
+	lzma2ChunkPackedReserve = 64
+)
+
+// Bits of LZMA chunk control byte.
+const (
+	controlLZMA               = 0x80
+	controlResetState         = 0x20
+	controlResetStateProp     = 0x40
+	controlResetStatePropDict = 0x60
+)
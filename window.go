@@ -15,12 +15,15 @@ type window struct {
 	//TotalPos uint32
 }
 
+// newWindow creates the window of windowSize(dictSize) bytes.
 func newWindow(dictSize uint32) *window {
+	size := windowSize(dictSize)
+
 	w := &window{
-		buf: make([]byte, dictSize),
+		buf: make([]byte, size),
 		pos: 0,
 		//TotalPos: 0,
-		size:   dictSize,
+		size:   size,
 		isFull: false,
 	}
 	w.bufPtr = &w.buf[0]
@@ -28,6 +31,21 @@ func newWindow(dictSize uint32) *window {
 	return w
 }
 
+// windowSize returns the size of the window of the dictionary: not less than
+// lzmaDicMin and multiple of 16, as the decoder derives the position state
+// from the window position.
+func windowSize(dictSize uint32) uint32 {
+	if dictSize < lzmaDicMin {
+		return lzmaDicMin
+	}
+
+	if dictSize > lzmaDicMax&^15 {
+		return lzmaDicMax &^ 15
+	}
+
+	return (dictSize + 15) &^ 15
+}
+
 func (w *window) PutByte(b byte) {
 	//w.TotalPos++
 	*(*byte)(unsafe.Pointer(uintptr(unsafe.Pointer(w.bufPtr)) + uintptr(w.pos))) = b
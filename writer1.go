@@ -0,0 +1,133 @@
+package lzma
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// Writer1 compresses data to LZMA stream.
+type Writer1 struct {
+	outStream *bufio.Writer
+	rangeEnc  *rangeEncoder
+	e         *encoder
+
+	header    []byte
+	endMarker bool
+	closed    bool
+}
+
+// NewWriter1 creates writer of .lzma files. The header stores unknown unpack
+// size, so the stream is terminated with the end marker.
+func NewWriter1(outStream io.Writer, props Properties) (*Writer1, error) {
+	w, err := NewRawWriter1(outStream, props, true)
+	if err != nil {
+		return nil, err
+	}
+
+	w.header = make([]byte, LZMAHeaderLen)
+	copy(w.header, props.Encode())
+
+	for i := 5; i < LZMAHeaderLen; i++ {
+		w.header[i] = 0xFF
+	}
+
+	_, err = w.outStream.Write(w.header)
+	if err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// NewRawWriter1 creates writer of LZMA stream without header, as stored in
+// 7z and lzip files. The end marker is written on Close if endMarker is set,
+// otherwise the reader has to know the unpack size.
+func NewRawWriter1(outStream io.Writer, props Properties, endMarker bool) (*Writer1, error) {
+	err := props.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	bw := bufio.NewWriter(outStream)
+	rangeEnc := newRangeEncoder(bw)
+
+	return &Writer1{
+		outStream: bw,
+		rangeEnc:  rangeEnc,
+		e:         newEncoder(rangeEnc, props, int(props.DictSize)),
+
+		endMarker: endMarker,
+	}, nil
+}
+
+var errWriterClosed = errors.New("lzma: writer is closed")
+
+// Reset discards the state of the writer and makes it write new stream to
+// outStream, with the header if the writer is created by NewWriter1. It
+// reuses the memory of the encoder.
+func (w *Writer1) Reset(outStream io.Writer) {
+	w.outStream.Reset(outStream)
+	w.e.Reset()
+	w.rangeEnc.Reopen(w.outStream)
+
+	if w.header != nil {
+		// the error of buffered writer is reported by next calls
+		_, _ = w.outStream.Write(w.header)
+	}
+
+	w.closed = false
+}
+
+func (w *Writer1) Write(p []byte) (n int, err error) {
+	if w.closed {
+		return 0, errWriterClosed
+	}
+
+	for len(p) > 0 {
+		k := w.e.mf.Write(p)
+		n += k
+		p = p[k:]
+
+		w.encode(false)
+
+		err = w.rangeEnc.Err()
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+func (w *Writer1) encode(flush bool) {
+	for {
+		avail := w.e.avail()
+		if avail == 0 || (!flush && avail <= encoderLookahead) {
+			return
+		}
+
+		w.e.encodeSymbol()
+	}
+}
+
+// Close finishes the stream. It does not close the underlying writer.
+func (w *Writer1) Close() error {
+	if w.closed {
+		return errWriterClosed
+	}
+
+	w.closed = true
+	w.encode(true)
+
+	if w.endMarker {
+		w.e.encodeEndMarker()
+	}
+
+	err := w.rangeEnc.Flush()
+	if err != nil {
+		return err
+	}
+
+	return w.outStream.Flush()
+}
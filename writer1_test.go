@@ -0,0 +1,143 @@
+package lzma
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readRandomFile(t testing.TB) []byte {
+	t.Helper()
+
+	compressedData, err := os.ReadFile("testassets/randomfile.dat.lzma2")
+	require.NoError(t, err)
+
+	r, err := NewReader2(bytes.NewReader(compressedData), 0)
+	require.NoError(t, err)
+
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	return data
+}
+
+func TestWriter1(t *testing.T) {
+	r := require.New(t)
+
+	randomFile := readRandomFile(t)
+
+	testCases := []struct {
+		name string
+
+		data  []byte
+		props Properties
+	}{
+		{
+			name:  "empty",
+			data:  nil,
+			props: DefaultProperties(),
+		},
+		{
+			name:  "one_byte",
+			data:  []byte{'a'},
+			props: DefaultProperties(),
+		},
+		{
+			name:  "text",
+			data:  bytes.Repeat([]byte("LZMA decoder test example. "), 1000),
+			props: DefaultProperties(),
+		},
+		{
+			name:  "random_file_small_dict",
+			data:  randomFile,
+			props: Properties{LC: 3, LP: 0, PB: 2, DictSize: 1 << 12},
+		},
+		{
+			name:  "random_file_lp1_lc2_pb1",
+			data:  randomFile,
+			props: Properties{LC: 2, LP: 1, PB: 1, DictSize: 1 << 16},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			w, err := NewWriter1(&buf, tc.props)
+			r.NoError(err)
+
+			_, err = w.Write(tc.data)
+			r.NoError(err)
+			r.NoError(w.Close())
+
+			reader, err := NewReader1(bufio.NewReader(&buf))
+			r.NoError(err)
+
+			actual, err := io.ReadAll(reader)
+			r.NoError(err)
+			r.Equal(len(tc.data), len(actual))
+			r.True(bytes.Equal(tc.data, actual))
+		})
+	}
+}
+
+func TestWriter1InvalidProperties(t *testing.T) {
+	_, err := NewWriter1(io.Discard, Properties{LC: 9, DictSize: 1 << 16})
+	require.Error(t, err)
+
+	_, err = NewWriter1(io.Discard, Properties{LC: 3, PB: 2, DictSize: 1})
+	require.ErrorIs(t, err, ErrDictOutOfRange)
+}
+
+func BenchmarkWriter1(b *testing.B) {
+	data := readRandomFile(b)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		w, err := NewWriter1(io.Discard, DefaultProperties())
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		_, err = w.Write(data)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		err = w.Close()
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.SetBytes(int64(len(data)))
+	}
+}
+
+func TestWriter1Reset(t *testing.T) {
+	r := require.New(t)
+
+	data := bytes.Repeat([]byte("LZMA decoder test example. "), 1000)
+
+	var buf1, buf2 bytes.Buffer
+
+	w, err := NewWriter1(&buf1, DefaultProperties())
+	r.NoError(err)
+
+	_, err = w.Write(data)
+	r.NoError(err)
+	r.NoError(w.Close())
+
+	w.Reset(&buf2)
+
+	_, err = w.Write(data)
+	r.NoError(err)
+	r.NoError(w.Close())
+
+	r.Equal(buf1.Bytes(), buf2.Bytes())
+}
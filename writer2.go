@@ -0,0 +1,251 @@
+package lzma
+
+import (
+	"bytes"
+	"io"
+)
+
+// Writer2 compresses data to LZMA2 stream with lc=3, lp=0, pb=2.
+type Writer2 struct {
+	outStream io.Writer
+
+	dictSize uint32
+	prop     byte
+
+	rangeEnc *rangeEncoder
+	e        *encoder
+
+	chunk         bytes.Buffer
+	chunkUnpacked uint32
+	header        []byte
+
+	needDictReset  bool
+	needProp       bool
+	needStateReset bool
+
+	closed bool
+}
+
+// NewWriter2 creates LZMA2 writer. The dictionary size is rounded up to the
+// value representable by LZMA2 dictionary size byte, see EncodeDictSize2.
+// Zero dictSize selects DefaultDictSize.
+func NewWriter2(outStream io.Writer, dictSize int) (*Writer2, error) {
+	if dictSize == 0 {
+		dictSize = DefaultDictSize
+	}
+
+	if dictSize < lzmaDicMin || uint64(dictSize) > lzmaDicMax {
+		return nil, ErrDictOutOfRange
+	}
+
+	props := DefaultProperties()
+	props.DictSize = uint32(dictSize)
+
+	w := &Writer2{
+		outStream: outStream,
+
+		dictSize: DecodeDictSize2(EncodeDictSize2(uint32(dictSize))),
+		prop:     EncodeProp(props.LC, props.PB, props.LP),
+
+		header: make([]byte, 0, 6),
+
+		needDictReset: true,
+		needProp:      true,
+	}
+
+	w.rangeEnc = newRangeEncoder(&w.chunk)
+	w.e = newEncoder(w.rangeEnc, props, lzma2ChunkUnpackedMax)
+
+	return w, nil
+}
+
+// Reset discards the state of the writer and makes it write new stream to
+// outStream. It reuses the memory of the encoder.
+func (w *Writer2) Reset(outStream io.Writer) {
+	w.outStream = outStream
+
+	w.e.Reset()
+	w.chunk.Reset()
+	w.rangeEnc.Reopen(&w.chunk)
+	w.chunkUnpacked = 0
+
+	w.needDictReset = true
+	w.needProp = true
+	w.needStateReset = false
+
+	w.closed = false
+}
+
+// DictSize returns the dictionary size the reader must use, it is encoded
+// by EncodeDictSize2 without loss.
+func (w *Writer2) DictSize() uint32 {
+	return w.dictSize
+}
+
+func (w *Writer2) Write(p []byte) (n int, err error) {
+	if w.closed {
+		return 0, errWriterClosed
+	}
+
+	for len(p) > 0 {
+		k := w.e.mf.Write(p)
+		n += k
+		p = p[k:]
+
+		err = w.encode(false)
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+func (w *Writer2) encode(flush bool) error {
+	for {
+		avail := w.e.avail()
+		if avail == 0 || (!flush && avail <= encoderLookahead) {
+			return nil
+		}
+
+		if w.chunkUnpacked > lzma2ChunkUnpackedMax-maxMatchLen ||
+			w.rangeEnc.Pending() > lzma2ChunkPackedMax-lzma2ChunkPackedReserve {
+			err := w.writeChunk()
+			if err != nil {
+				return err
+			}
+		}
+
+		if w.chunkUnpacked == 0 {
+			w.e.mf.keep = w.e.index()
+		}
+
+		w.chunkUnpacked += w.e.encodeSymbol()
+	}
+}
+
+// writeChunk writes the data encoded since the previous chunk. The data is
+// stored uncompressed when LZMA does not reduce its size, then the state of
+// the encoder is reset as the reader never sees it.
+func (w *Writer2) writeChunk() error {
+	err := w.rangeEnc.Flush()
+	if err != nil {
+		return err
+	}
+
+	unpacked := w.chunkUnpacked
+	packed := uint32(w.chunk.Len())
+
+	if packed >= unpacked {
+		err = w.writeUncompressed(w.e.mf.buf[w.e.mf.keep : w.e.mf.keep+int(unpacked)])
+		if err != nil {
+			return err
+		}
+
+		w.e.s.Reset()
+		w.needStateReset = true
+	} else {
+		control := byte(controlLZMA) | byte((unpacked-1)>>16)
+
+		switch {
+		case w.needDictReset:
+			control |= controlResetStatePropDict
+		case w.needProp:
+			control |= controlResetStateProp
+		case w.needStateReset:
+			control |= controlResetState
+		}
+
+		w.header = append(w.header[:0], control, byte((unpacked-1)>>8), byte(unpacked-1), byte((packed-1)>>8), byte(packed-1))
+		if w.needProp {
+			w.header = append(w.header, w.prop)
+		}
+
+		_, err = w.outStream.Write(w.header)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.outStream.Write(w.chunk.Bytes())
+		if err != nil {
+			return err
+		}
+
+		w.needDictReset = false
+		w.needProp = false
+		w.needStateReset = false
+	}
+
+	w.chunk.Reset()
+	w.rangeEnc.Reopen(&w.chunk)
+	w.chunkUnpacked = 0
+	w.e.mf.keep = -1
+
+	return nil
+}
+
+func (w *Writer2) writeUncompressed(data []byte) error {
+	for len(data) > 0 {
+		n := len(data)
+		if n > lzma2UncompressedChunkMax {
+			n = lzma2UncompressedChunkMax
+		}
+
+		control := byte(uncompressedNoResetDict)
+		if w.needDictReset {
+			control = uncompressedResetDict
+		}
+
+		w.header = append(w.header[:0], control, byte((n-1)>>8), byte(n-1))
+
+		_, err := w.outStream.Write(w.header)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.outStream.Write(data[:n])
+		if err != nil {
+			return err
+		}
+
+		w.needDictReset = false
+		data = data[n:]
+	}
+
+	return nil
+}
+
+// Flush encodes all buffered data and writes it as complete chunks, so the
+// reader can decode everything written so far. Frequent flushes hurt the
+// compression ratio.
+func (w *Writer2) Flush() error {
+	if w.closed {
+		return errWriterClosed
+	}
+
+	err := w.encode(true)
+	if err != nil {
+		return err
+	}
+
+	if w.chunkUnpacked == 0 {
+		return nil
+	}
+
+	return w.writeChunk()
+}
+
+// Close flushes the data and writes the end of stream marker. It does not
+// close the underlying writer.
+func (w *Writer2) Close() error {
+	err := w.Flush()
+	if err != nil {
+		return err
+	}
+
+	w.closed = true
+
+	_, err = w.outStream.Write([]byte{endOfStreamCode})
+
+	return err
+}
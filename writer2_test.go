@@ -0,0 +1,118 @@
+package lzma
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter2(t *testing.T) {
+	r := require.New(t)
+
+	randomFile := readRandomFile(t)
+
+	testCases := []struct {
+		name string
+
+		data     []byte
+		dictSize int
+		flushes  int
+	}{
+		{
+			name:     "empty",
+			data:     nil,
+			dictSize: 0,
+		},
+		{
+			name:     "text",
+			data:     bytes.Repeat([]byte("LZMA decoder test example. "), 100000),
+			dictSize: 1 << 16,
+		},
+		{
+			name:     "random_file",
+			data:     randomFile,
+			dictSize: 1 << 20,
+		},
+		{
+			name:     "random_file_with_flushes",
+			data:     randomFile,
+			dictSize: 1 << 12,
+			flushes:  7,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			w, err := NewWriter2(&buf, tc.dictSize)
+			r.NoError(err)
+
+			step := len(tc.data)/(tc.flushes+1) + 1
+			for p := tc.data; len(p) > 0; {
+				n := step
+				if n > len(p) {
+					n = len(p)
+				}
+
+				_, err = w.Write(p[:n])
+				r.NoError(err)
+				r.NoError(w.Flush())
+
+				p = p[n:]
+			}
+
+			r.NoError(w.Close())
+
+			reader, err := NewReader2(&buf, int(w.DictSize()))
+			r.NoError(err)
+
+			actual, err := io.ReadAll(reader)
+			r.NoError(err)
+			r.Equal(len(tc.data), len(actual))
+			r.True(bytes.Equal(tc.data, actual))
+		})
+	}
+}
+
+func TestWriter2Reset(t *testing.T) {
+	r := require.New(t)
+
+	data := bytes.Repeat([]byte("LZMA decoder test example. "), 1000)
+
+	var buf1, buf2 bytes.Buffer
+
+	w, err := NewWriter2(&buf1, 1<<16)
+	r.NoError(err)
+
+	_, err = w.Write(data)
+	r.NoError(err)
+	r.NoError(w.Close())
+
+	_, err = w.Write(data)
+	r.Error(err)
+
+	w.Reset(&buf2)
+
+	_, err = w.Write(data)
+	r.NoError(err)
+	r.NoError(w.Close())
+
+	r.Equal(buf1.Bytes(), buf2.Bytes())
+}
+
+func TestNewWriter2DictSize(t *testing.T) {
+	dictSizes := []int{-1, lzmaDicMin - 1}
+	if strconv.IntSize == 64 {
+		dictSizes = append(dictSizes, math.MaxInt)
+	}
+
+	for _, dictSize := range dictSizes {
+		_, err := NewWriter2(io.Discard, dictSize)
+		require.ErrorIs(t, err, ErrDictOutOfRange, dictSize)
+	}
+}
@@ -0,0 +1,91 @@
+package xz
+
+import (
+	"crypto/sha256"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+)
+
+// Check is the type of integrity check of the uncompressed data of blocks.
+type Check byte
+
+const (
+	CheckNone   Check = 0x00
+	CheckCRC32  Check = 0x01
+	CheckCRC64  Check = 0x04
+	CheckSHA256 Check = 0x0A
+)
+
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+func (c Check) String() string {
+	switch c {
+	case CheckNone:
+		return "None"
+	case CheckCRC32:
+		return "CRC32"
+	case CheckCRC64:
+		return "CRC64"
+	case CheckSHA256:
+		return "SHA-256"
+	}
+
+	return "Unknown-" + string("0123456789ABCDEF"[c&0x0F])
+}
+
+// Size returns the size of the check field. The size is defined for all
+// check IDs, so the unsupported checks can be skipped.
+func (c Check) Size() int {
+	if c == 0 {
+		return 0
+	}
+
+	return 4 << ((c - 1) / 3)
+}
+
+// Supported reports whether the check can be verified.
+func (c Check) Supported() bool {
+	switch c {
+	case CheckNone, CheckCRC32, CheckCRC64, CheckSHA256:
+		return true
+	}
+
+	return false
+}
+
+// newHash returns the hash of the check, it is nil for None and unsupported
+// checks.
+func (c Check) newHash() hash.Hash {
+	switch c {
+	case CheckCRC32:
+		return crc32.NewIEEE()
+	case CheckCRC64:
+		return crc64.New(crc64Table)
+	case CheckSHA256:
+		return sha256.New()
+	}
+
+	return nil
+}
+
+// sum appends the check value as stored in the file: CRC32 and CRC64 are
+// little endian.
+func sum(h hash.Hash, buf []byte) []byte {
+	start := len(buf)
+	buf = h.Sum(buf)
+
+	if _, ok := h.(hash.Hash32); ok {
+		reverse(buf[start:])
+	} else if _, ok := h.(hash.Hash64); ok {
+		reverse(buf[start:])
+	}
+
+	return buf
+}
+
+func reverse(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
@@ -0,0 +1,11 @@
+package xz
+
+import "errors"
+
+var (
+	ErrFormat             = errors.New("xz: file format not recognized")
+	ErrCorrupted          = errors.New("xz: corrupted")
+	ErrCheckMismatch      = errors.New("xz: check mismatch")
+	ErrUnsupportedOptions = errors.New("xz: unsupported options")
+	ErrUnsupportedFilter  = errors.New("xz: unsupported filter")
+)
@@ -0,0 +1,432 @@
+package xz
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/kulaginds/lzma"
+)
+
+const (
+	headerMagic = "\xFD7zXZ\x00"
+	footerMagic = "YZ"
+
+	streamHeaderLen = 12
+	streamFooterLen = 12
+
+	blockHeaderSizeMax = 1024
+	indexIndicator     = 0x00
+
+	vliLenMax = 9
+	vliMax    = 1<<63 - 1
+
+	dictSizeMin = 4096
+	dictSizeMax = 1<<32 - 1
+
+	// sizeUnknown marks the absent size fields of the block header.
+	sizeUnknown = -1
+)
+
+const (
+	blockFlagsFiltersMask      = 0x03
+	blockFlagsReserved         = 0x3C
+	blockFlagsCompressedSize   = 0x40
+	blockFlagsUncompressedSize = 0x80
+)
+
+// streamFlags is two bytes of stream flags from the stream header and footer.
+type streamFlags [2]byte
+
+func (f streamFlags) check() Check {
+	return Check(f[1] & 0x0F)
+}
+
+func (f streamFlags) valid() bool {
+	return f[0] == 0 && f[1]&0xF0 == 0
+}
+
+func newStreamFlags(check Check) streamFlags {
+	return streamFlags{0, byte(check)}
+}
+
+func readStreamHeader(inStream io.Reader) (streamFlags, error) {
+	var (
+		buf   [streamHeaderLen]byte
+		flags streamFlags
+	)
+
+	_, err := io.ReadFull(inStream, buf[:])
+	if err != nil {
+		return flags, unexpectedEOF(err)
+	}
+
+	return parseStreamHeader(buf[:])
+}
+
+func parseStreamHeader(buf []byte) (streamFlags, error) {
+	var flags streamFlags
+
+	if string(buf[:len(headerMagic)]) != headerMagic {
+		return flags, ErrFormat
+	}
+
+	copy(flags[:], buf[6:8])
+
+	if crc32.ChecksumIEEE(flags[:]) != binary.LittleEndian.Uint32(buf[8:12]) {
+		return flags, fmt.Errorf("%w: stream header", ErrCorrupted)
+	}
+
+	if !flags.valid() {
+		return flags, ErrUnsupportedOptions
+	}
+
+	return flags, nil
+}
+
+func appendStreamHeader(buf []byte, flags streamFlags) []byte {
+	buf = append(buf, headerMagic...)
+	buf = append(buf, flags[:]...)
+
+	return binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(flags[:]))
+}
+
+// streamFooter holds the fields of the stream footer.
+type streamFooter struct {
+	flags     streamFlags
+	indexSize int64
+}
+
+func parseStreamFooter(buf []byte) (streamFooter, error) {
+	var footer streamFooter
+
+	if string(buf[10:12]) != footerMagic {
+		return footer, ErrFormat
+	}
+
+	if crc32.ChecksumIEEE(buf[4:10]) != binary.LittleEndian.Uint32(buf[:4]) {
+		return footer, fmt.Errorf("%w: stream footer", ErrCorrupted)
+	}
+
+	copy(footer.flags[:], buf[8:10])
+	if !footer.flags.valid() {
+		return footer, ErrUnsupportedOptions
+	}
+
+	footer.indexSize = (int64(binary.LittleEndian.Uint32(buf[4:8])) + 1) * 4
+
+	return footer, nil
+}
+
+func appendStreamFooter(buf []byte, footer streamFooter) []byte {
+	start := len(buf)
+	buf = append(buf, 0, 0, 0, 0)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(footer.indexSize/4-1))
+	buf = append(buf, footer.flags[:]...)
+	binary.LittleEndian.PutUint32(buf[start:], crc32.ChecksumIEEE(buf[start+4:]))
+
+	return append(buf, footerMagic...)
+}
+
+// filter is an entry of the block filter chain.
+type filter struct {
+	id    uint64
+	props []byte
+}
+
+// blockHeader holds the fields of the block header, the sizes are
+// sizeUnknown when they are absent.
+type blockHeader struct {
+	size             int64
+	compressedSize   int64
+	uncompressedSize int64
+	filters          []filter
+}
+
+// readBlockHeader reads the block header whose first byte is already read,
+// the byte must not be the index indicator.
+func readBlockHeader(inStream io.Reader, first byte) (*blockHeader, error) {
+	if first == indexIndicator {
+		return nil, fmt.Errorf("%w: block header", ErrCorrupted)
+	}
+
+	size := (int(first) + 1) * 4
+
+	buf := make([]byte, size)
+	buf[0] = first
+
+	_, err := io.ReadFull(inStream, buf[1:])
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	return parseBlockHeader(buf)
+}
+
+func parseBlockHeader(buf []byte) (*blockHeader, error) {
+	size := len(buf)
+	if size < 8 {
+		return nil, fmt.Errorf("%w: block header", ErrCorrupted)
+	}
+
+	if crc32.ChecksumIEEE(buf[:size-4]) != binary.LittleEndian.Uint32(buf[size-4:]) {
+		return nil, fmt.Errorf("%w: block header", ErrCorrupted)
+	}
+
+	flags := buf[1]
+	if flags&blockFlagsReserved != 0 {
+		return nil, ErrUnsupportedOptions
+	}
+
+	h := &blockHeader{
+		size:             int64(size),
+		compressedSize:   sizeUnknown,
+		uncompressedSize: sizeUnknown,
+	}
+
+	br := bytes.NewReader(buf[2 : size-4])
+
+	if flags&blockFlagsCompressedSize != 0 {
+		v, err := readVLI(br)
+		if err != nil {
+			return nil, err
+		}
+
+		if v == 0 {
+			return nil, fmt.Errorf("%w: zero compressed size", ErrCorrupted)
+		}
+
+		h.compressedSize = int64(v)
+	}
+
+	if flags&blockFlagsUncompressedSize != 0 {
+		v, err := readVLI(br)
+		if err != nil {
+			return nil, err
+		}
+
+		h.uncompressedSize = int64(v)
+	}
+
+	numFilters := int(flags&blockFlagsFiltersMask) + 1
+	h.filters = make([]filter, numFilters)
+
+	for i := range h.filters {
+		id, err := readVLI(br)
+		if err != nil {
+			return nil, err
+		}
+
+		propsSize, err := readVLI(br)
+		if err != nil {
+			return nil, err
+		}
+
+		if propsSize > uint64(br.Len()) {
+			return nil, fmt.Errorf("%w: filter properties", ErrCorrupted)
+		}
+
+		props := make([]byte, propsSize)
+		_, _ = br.Read(props)
+
+		h.filters[i] = filter{id: id, props: props}
+	}
+
+	// header padding
+	for br.Len() > 0 {
+		b, _ := br.ReadByte()
+		if b != 0 {
+			return nil, ErrUnsupportedOptions
+		}
+	}
+
+	return h, nil
+}
+
+func (h *blockHeader) encode() ([]byte, error) {
+	if len(h.filters) == 0 || len(h.filters) > lzma.FiltersMax {
+		return nil, ErrUnsupportedOptions
+	}
+
+	buf := make([]byte, 2, 64)
+	buf[1] = byte(len(h.filters) - 1)
+
+	if h.compressedSize != sizeUnknown {
+		buf[1] |= blockFlagsCompressedSize
+		buf = appendVLI(buf, uint64(h.compressedSize))
+	}
+
+	if h.uncompressedSize != sizeUnknown {
+		buf[1] |= blockFlagsUncompressedSize
+		buf = appendVLI(buf, uint64(h.uncompressedSize))
+	}
+
+	for _, f := range h.filters {
+		buf = appendVLI(buf, f.id)
+		buf = appendVLI(buf, uint64(len(f.props)))
+		buf = append(buf, f.props...)
+	}
+
+	for len(buf)%4 != 0 {
+		buf = append(buf, 0)
+	}
+
+	size := len(buf) + 4
+	if size > blockHeaderSizeMax {
+		return nil, ErrUnsupportedOptions
+	}
+
+	buf[0] = byte(size/4 - 1)
+
+	return binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf)), nil
+}
+
+// record is an index record.
+type record struct {
+	unpaddedSize     int64
+	uncompressedSize int64
+}
+
+// readIndex reads the index whose indicator byte is already read. It returns
+// the records and the size of the index.
+func readIndex(inStream io.ByteReader) ([]record, int64, error) {
+	crc := crc32.NewIEEE()
+	_, _ = crc.Write([]byte{indexIndicator})
+
+	br := &hashByteReader{r: inStream, h: crc, n: 1}
+
+	count, err := readVLI(br)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// every record takes at least two bytes
+	if count > vliMax/2 {
+		return nil, 0, fmt.Errorf("%w: index", ErrCorrupted)
+	}
+
+	var records []record
+
+	for i := uint64(0); i < count; i++ {
+		unpaddedSize, err := readVLI(br)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		uncompressedSize, err := readVLI(br)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if unpaddedSize == 0 {
+			return nil, 0, fmt.Errorf("%w: index", ErrCorrupted)
+		}
+
+		records = append(records, record{
+			unpaddedSize:     int64(unpaddedSize),
+			uncompressedSize: int64(uncompressedSize),
+		})
+	}
+
+	for br.n%4 != 0 {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if b != 0 {
+			return nil, 0, fmt.Errorf("%w: index padding", ErrCorrupted)
+		}
+	}
+
+	sum := crc.Sum32()
+
+	var buf [4]byte
+	for i := range buf {
+		buf[i], err = inStream.ReadByte()
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if binary.LittleEndian.Uint32(buf[:]) != sum {
+		return nil, 0, fmt.Errorf("%w: index", ErrCorrupted)
+	}
+
+	return records, br.n + 4, nil
+}
+
+func appendIndex(buf []byte, records []record) []byte {
+	start := len(buf)
+
+	buf = append(buf, indexIndicator)
+	buf = appendVLI(buf, uint64(len(records)))
+
+	for _, rec := range records {
+		buf = appendVLI(buf, uint64(rec.unpaddedSize))
+		buf = appendVLI(buf, uint64(rec.uncompressedSize))
+	}
+
+	for (len(buf)-start)%4 != 0 {
+		buf = append(buf, 0)
+	}
+
+	return binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf[start:]))
+}
+
+// padLen returns the number of padding bytes to align size to four bytes.
+func padLen(size int64) int64 {
+	return (4 - size%4) % 4
+}
+
+func readVLI(br io.ByteReader) (uint64, error) {
+	var v uint64
+
+	for i := 0; i < vliLenMax; i++ {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, unexpectedEOF(err)
+		}
+
+		v |= uint64(b&0x7F) << (7 * i)
+
+		if b&0x80 == 0 {
+			if b == 0 && i > 0 {
+				return 0, fmt.Errorf("%w: non-minimal integer", ErrCorrupted)
+			}
+
+			return v, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: integer is too long", ErrCorrupted)
+}
+
+func appendVLI(buf []byte, v uint64) []byte {
+	for v >= 0x80 {
+		buf = append(buf, byte(v)|0x80)
+		v >>= 7
+	}
+
+	return append(buf, byte(v))
+}
+
+type hashByteReader struct {
+	r io.ByteReader
+	h io.Writer
+	n int64
+}
+
+func (r *hashByteReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	_, _ = r.h.Write([]byte{b})
+	r.n++
+
+	return b, nil
+}
@@ -0,0 +1,154 @@
+package xz
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// streamIndex is a stream located by its footer and index.
+type streamIndex struct {
+	offset  int64
+	flags   streamFlags
+	records []record
+
+	// indexSize is the size of the index, padding is the size of the stream
+	// padding after the stream.
+	indexSize int64
+	padding   int64
+}
+
+// size returns the size of the stream without the stream padding.
+func (s *streamIndex) size() int64 {
+	return streamHeaderLen + s.blocksSize() + s.indexSize + streamFooterLen
+}
+
+// blocksSize returns the size of all blocks of the stream.
+func (s *streamIndex) blocksSize() int64 {
+	var size int64
+
+	for _, rec := range s.records {
+		size += rec.unpaddedSize + padLen(rec.unpaddedSize)
+	}
+
+	return size
+}
+
+// readStreamIndexes locates the streams of the input from its end, reading only
+// the footers, the indexes and the stream headers.
+func readStreamIndexes(inStream io.ReaderAt, size int64) ([]streamIndex, error) {
+	if size%4 != 0 {
+		return nil, fmt.Errorf("%w: size is not multiple of four", ErrCorrupted)
+	}
+
+	var (
+		streams []streamIndex
+		buf     [streamFooterLen]byte
+	)
+
+	for end := size; end > 0 || len(streams) == 0; {
+		var padding int64
+
+		for end >= 4 {
+			_, err := inStream.ReadAt(buf[:4], end-4)
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+
+			if !bytes.Equal(buf[:4], []byte{0, 0, 0, 0}) {
+				break
+			}
+
+			end -= 4
+			padding += 4
+		}
+
+		if end < streamHeaderLen+streamFooterLen {
+			return nil, ErrFormat
+		}
+
+		s, err := readStreamIndex(inStream, end)
+		if err != nil {
+			return nil, err
+		}
+
+		s.padding = padding
+		streams = append(streams, s)
+		end = s.offset
+	}
+
+	// the streams are found from the last one
+	for i, j := 0, len(streams)-1; i < j; i, j = i+1, j-1 {
+		streams[i], streams[j] = streams[j], streams[i]
+	}
+
+	return streams, nil
+}
+
+// readStreamIndex reads the stream which ends at the offset end.
+func readStreamIndex(inStream io.ReaderAt, end int64) (streamIndex, error) {
+	var (
+		s   streamIndex
+		buf [streamHeaderLen]byte
+	)
+
+	_, err := inStream.ReadAt(buf[:], end-streamFooterLen)
+	if err != nil {
+		return s, unexpectedEOF(err)
+	}
+
+	footer, err := parseStreamFooter(buf[:])
+	if err != nil {
+		return s, err
+	}
+
+	indexStart := end - streamFooterLen - footer.indexSize
+	if indexStart < streamHeaderLen {
+		return s, fmt.Errorf("%w: backward size", ErrCorrupted)
+	}
+
+	index := make([]byte, footer.indexSize)
+
+	_, err = inStream.ReadAt(index, indexStart)
+	if err != nil {
+		return s, unexpectedEOF(err)
+	}
+
+	if index[0] != indexIndicator {
+		return s, fmt.Errorf("%w: index", ErrCorrupted)
+	}
+
+	records, indexSize, err := readIndex(bytes.NewReader(index[1:]))
+	if err != nil {
+		return s, unexpectedEOF(err)
+	}
+
+	if indexSize != footer.indexSize {
+		return s, fmt.Errorf("%w: backward size", ErrCorrupted)
+	}
+
+	s.flags = footer.flags
+	s.records = records
+	s.indexSize = indexSize
+	s.offset = indexStart - s.blocksSize() - streamHeaderLen
+
+	if s.offset < 0 {
+		return s, fmt.Errorf("%w: index", ErrCorrupted)
+	}
+
+	_, err = inStream.ReadAt(buf[:], s.offset)
+	if err != nil {
+		return s, unexpectedEOF(err)
+	}
+
+	flags, err := parseStreamHeader(buf[:])
+	if err != nil {
+		return s, err
+	}
+
+	if flags != footer.flags {
+		return s, fmt.Errorf("%w: stream flags mismatch", ErrCorrupted)
+	}
+
+	return s, nil
+}
@@ -0,0 +1,268 @@
+package xz
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/kulaginds/lzma"
+)
+
+// lzma2DecoderOverhead is the memory used by LZMA2 decoder besides the window:
+// the probabilities for lc+lp=4 and the input buffer.
+const lzma2DecoderOverhead = 40 << 10
+
+var errUnknownSize = errors.New("xz: size of input is unknown")
+
+// Info describes .xz file, it is returned by Inspect.
+type Info struct {
+	Streams []StreamInfo
+
+	CompressedSize   int64
+	UncompressedSize int64
+
+	// MemoryNeeded is the memory in bytes needed by Reader to decompress the
+	// largest block.
+	MemoryNeeded uint64
+}
+
+// Blocks returns the number of blocks in all streams.
+func (i *Info) Blocks() int {
+	var n int
+
+	for _, s := range i.Streams {
+		n += len(s.Blocks)
+	}
+
+	return n
+}
+
+// StreamInfo describes a stream of .xz file.
+type StreamInfo struct {
+	Blocks []BlockInfo
+	Check  Check
+
+	Offset             int64
+	UncompressedOffset int64
+	CompressedSize     int64
+	UncompressedSize   int64
+
+	// Padding is the size of the stream padding after the stream.
+	Padding int64
+}
+
+// BlockInfo describes a block of .xz stream.
+type BlockInfo struct {
+	Filters []FilterInfo
+
+	Offset             int64
+	UncompressedOffset int64
+
+	// TotalSize is the size of the block including the header, the padding
+	// and the check, CompressedSize is the size of the compressed data only.
+	TotalSize        int64
+	HeaderSize       int
+	CompressedSize   int64
+	UncompressedSize int64
+
+	// CompressedSizeInHeader and UncompressedSizeInHeader report whether the
+	// sizes are stored in the block header.
+	CompressedSizeInHeader   bool
+	UncompressedSizeInHeader bool
+
+	// CheckValue is the check as stored in the file, CRC32 and CRC64 are
+	// little endian.
+	CheckValue   []byte
+	MemoryNeeded uint64
+}
+
+// FilterInfo is a filter of the block filter chain.
+type FilterInfo struct {
+	ID    uint64
+	Props []byte
+
+	// DictSize is the dictionary size of LZMA2 filter.
+	DictSize uint32
+}
+
+// String returns the filter in the form of xz options.
+func (f FilterInfo) String() string {
+	if f.ID == lzma.XZFilterLZMA2 {
+		return "--lzma2=dict=" + formatSize(f.DictSize)
+	}
+
+	if f.ID == lzma.XZFilterDelta {
+		if distance, err := lzma.DecodeDeltaDistance(f.Props); err == nil {
+			return fmt.Sprintf("--delta=dist=%d", distance)
+		}
+	}
+
+	rf, ok := lzma.FilterByXZID(f.ID)
+	if ok && f.ID >= lzma.XZFilterX86 && f.ID <= lzma.XZFilterRISCV {
+		if startOffset, err := lzma.DecodeBCJStartOffset(f.Props); err == nil && startOffset != 0 {
+			return fmt.Sprintf("--%s=start=%d", rf.Name, startOffset)
+		}
+
+		return "--" + rf.Name
+	}
+
+	if ok && !rf.Last && len(f.Props) == 0 {
+		return "--" + rf.Name
+	}
+
+	return fmt.Sprintf("--filter=0x%X", f.ID)
+}
+
+// formatSize formats the dictionary size as xz does.
+func formatSize(size uint32) string {
+	switch {
+	case size%(1<<20) == 0:
+		return fmt.Sprintf("%dMiB", size>>20)
+	case size%(1<<10) == 0:
+		return fmt.Sprintf("%dKiB", size>>10)
+	}
+
+	return fmt.Sprintf("%dB", size)
+}
+
+// Inspect reads the indexes and the block headers of .xz file without
+// decompressing it, like xz -lvv does. The size of the file is taken from
+// Size method, as of bytes.Reader and io.SectionReader, or Stat method of
+// os.File.
+func Inspect(inStream io.ReaderAt) (*Info, error) {
+	size, err := readerAtSize(inStream)
+	if err != nil {
+		return nil, err
+	}
+
+	streams, err := readStreamIndexes(inStream, size)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{
+		Streams:        make([]StreamInfo, len(streams)),
+		CompressedSize: size,
+	}
+
+	for i := range streams {
+		s := &streams[i]
+		check := s.flags.check()
+
+		si := StreamInfo{
+			Blocks:             make([]BlockInfo, len(s.records)),
+			Check:              check,
+			Offset:             s.offset,
+			UncompressedOffset: info.UncompressedSize,
+			CompressedSize:     s.size(),
+			Padding:            s.padding,
+		}
+
+		offset := s.offset + streamHeaderLen
+
+		for j, rec := range s.records {
+			block, err := inspectBlock(inStream, offset, rec, check)
+			if err != nil {
+				return nil, err
+			}
+
+			block.UncompressedOffset = info.UncompressedSize
+			si.Blocks[j] = *block
+
+			offset += block.TotalSize
+			si.UncompressedSize += rec.uncompressedSize
+			info.UncompressedSize += rec.uncompressedSize
+
+			if block.MemoryNeeded > info.MemoryNeeded {
+				info.MemoryNeeded = block.MemoryNeeded
+			}
+		}
+
+		info.Streams[i] = si
+	}
+
+	return info, nil
+}
+
+func inspectBlock(inStream io.ReaderAt, offset int64, rec record, check Check) (*BlockInfo, error) {
+	var first [1]byte
+
+	_, err := inStream.ReadAt(first[:], offset)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	header, err := readBlockHeader(io.NewSectionReader(inStream, offset+1, blockHeaderSizeMax), first[0])
+	if err != nil {
+		return nil, err
+	}
+
+	block := &BlockInfo{
+		Filters:                  make([]FilterInfo, len(header.filters)),
+		Offset:                   offset,
+		TotalSize:                rec.unpaddedSize + padLen(rec.unpaddedSize),
+		HeaderSize:               int(header.size),
+		CompressedSize:           rec.unpaddedSize - header.size - int64(check.Size()),
+		UncompressedSize:         rec.uncompressedSize,
+		CompressedSizeInHeader:   header.compressedSize != sizeUnknown,
+		UncompressedSizeInHeader: header.uncompressedSize != sizeUnknown,
+		CheckValue:               make([]byte, check.Size()),
+	}
+
+	if block.CompressedSize <= 0 ||
+		(block.CompressedSizeInHeader && header.compressedSize != block.CompressedSize) ||
+		(block.UncompressedSizeInHeader && header.uncompressedSize != block.UncompressedSize) {
+		return nil, fmt.Errorf("%w: block header does not match index", ErrCorrupted)
+	}
+
+	_, err = inStream.ReadAt(block.CheckValue, offset+block.TotalSize-int64(check.Size()))
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	for i, f := range header.filters {
+		block.Filters[i] = FilterInfo{ID: f.id, Props: f.props}
+
+		if f.id == lzma.XZFilterLZMA2 {
+			dictSize, err := lzma2DictSize(f.props)
+			if err != nil {
+				return nil, err
+			}
+
+			block.Filters[i].DictSize = dictSize
+			block.MemoryNeeded = uint64(decoderDictSize(dictSize, header.uncompressedSize)) + lzma2DecoderOverhead
+		}
+	}
+
+	return block, nil
+}
+
+func readerAtSize(inStream io.ReaderAt) (int64, error) {
+	switch r := inStream.(type) {
+	case interface{ Size() int64 }:
+		return r.Size(), nil
+	case interface{ Stat() (fs.FileInfo, error) }:
+		fi, err := r.Stat()
+		if err != nil {
+			return 0, err
+		}
+
+		return fi.Size(), nil
+	}
+
+	return 0, errUnknownSize
+}
+
+// Verify decompresses .xz file and checks the sizes, the checks and the
+// indexes of all streams without producing output.
+func Verify(inStream io.Reader) error {
+	r, err := NewReader(inStream)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(io.Discard, r)
+
+	return err
+}
@@ -0,0 +1,139 @@
+package xz
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kulaginds/lzma"
+	"github.com/kulaginds/lzma/internal/testgen"
+)
+
+func TestInspect(t *testing.T) {
+	r := require.New(t)
+
+	input, err := os.Open("testassets/a_multistream.xz")
+	r.NoError(err)
+	defer input.Close()
+
+	info, err := Inspect(input)
+	r.NoError(err)
+
+	// the values are printed by xz -lvv
+	r.Equal(int64(356), info.CompressedSize)
+	r.Equal(int64(654), info.UncompressedSize)
+	r.Len(info.Streams, 2)
+	r.Equal(2, info.Blocks())
+
+	s := info.Streams[0]
+	r.Equal(CheckCRC64, s.Check)
+	r.Equal(int64(0), s.Offset)
+	r.Equal(int64(176), s.CompressedSize)
+	r.Equal(int64(327), s.UncompressedSize)
+	r.Equal(int64(8), s.Padding)
+
+	b := s.Blocks[0]
+	r.Equal(int64(12), b.Offset)
+	r.Equal(int64(140), b.TotalSize)
+	r.Equal(20, b.HeaderSize)
+	r.Equal(int64(111), b.CompressedSize)
+	r.Equal(int64(327), b.UncompressedSize)
+	r.True(b.CompressedSizeInHeader)
+	r.True(b.UncompressedSizeInHeader)
+	// xz prints CRC as number, it is stored little endian
+	r.Equal([]byte{0x3e, 0x0a, 0x19, 0xe1, 0xf3, 0x06, 0xe6, 0x78}, b.CheckValue)
+	r.Len(b.Filters, 1)
+	r.Equal("--lzma2=dict=8MiB", b.Filters[0].String())
+
+	s = info.Streams[1]
+	r.Equal(CheckCRC32, s.Check)
+	r.Equal(int64(184), s.Offset)
+	r.Equal(int64(327), s.UncompressedOffset)
+	r.Equal(int64(172), s.CompressedSize)
+	r.Equal(int64(0), s.Padding)
+
+	b = s.Blocks[0]
+	r.Equal(int64(196), b.Offset)
+	r.Equal(int64(327), b.UncompressedOffset)
+	r.Equal(int64(136), b.TotalSize)
+	r.Equal([]byte{0x94, 0x8f, 0xbf, 0x76}, b.CheckValue)
+}
+
+func TestInspectWriter(t *testing.T) {
+	r := require.New(t)
+
+	data := testgen.Text(10000, 1)
+	compressed := compressBlocks(t, data, 3000)
+
+	info, err := Inspect(bytes.NewReader(compressed))
+	r.NoError(err)
+	r.Equal(int64(len(data)), info.UncompressedSize)
+	r.Equal(4, info.Blocks())
+
+	for _, b := range info.Streams[0].Blocks {
+		r.Equal("--lzma2=dict=64KiB", b.Filters[0].String())
+		r.Equal(uint32(1<<16), b.Filters[0].DictSize)
+		r.Equal(uint64(decoderDictSize(1<<16, b.UncompressedSize))+lzma2DecoderOverhead, b.MemoryNeeded)
+	}
+
+	_, err = Inspect(bytes.NewReader(compressed[:len(compressed)-4]))
+	r.Error(err)
+}
+
+func TestInspectBadBlockHeader(t *testing.T) {
+	input, err := os.Open("testassets/bad_block_header.xz")
+	require.NoError(t, err)
+	defer input.Close()
+
+	_, err = Inspect(input)
+	require.ErrorIs(t, err, ErrCorrupted)
+}
+
+func TestVerify(t *testing.T) {
+	r := require.New(t)
+
+	testCases := []struct {
+		inputFile string
+		checkErr  func(err error, msgAndArgs ...interface{})
+	}{
+		{inputFile: "testassets/a.xz", checkErr: r.NoError},
+		{inputFile: "testassets/a_multiblock.xz", checkErr: r.NoError},
+		{inputFile: "testassets/a_multistream.xz", checkErr: r.NoError},
+		{inputFile: "testassets/bad_check.xz", checkErr: r.Error},
+		{inputFile: "testassets/bad_index.xz", checkErr: r.Error},
+		{inputFile: "testassets/bad_truncated.xz", checkErr: r.Error},
+		{inputFile: "testassets/bad_block_header.xz", checkErr: r.Error},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.inputFile, func(t *testing.T) {
+			input, err := os.Open(tc.inputFile)
+			r.NoError(err)
+			defer input.Close()
+
+			tc.checkErr(Verify(input))
+		})
+	}
+}
+
+func TestInspectFilters(t *testing.T) {
+	r := require.New(t)
+
+	input, err := os.Open("testassets/x86.xz")
+	r.NoError(err)
+	defer input.Close()
+
+	info, err := Inspect(input)
+	r.NoError(err)
+
+	filters := info.Streams[0].Blocks[0].Filters
+	r.Len(filters, 2)
+	r.Equal("--x86", filters[0].String())
+	r.Equal("--lzma2=dict=64KiB", filters[1].String())
+
+	r.Equal("--x86=start=4096", FilterInfo{ID: lzma.XZFilterX86, Props: []byte{0, 0x10, 0, 0}}.String())
+	r.Equal("--armthumb", FilterInfo{ID: lzma.XZFilterARMThumb}.String())
+	r.Equal("--delta=dist=4", FilterInfo{ID: lzma.XZFilterDelta, Props: []byte{3}}.String())
+}
@@ -0,0 +1,170 @@
+package xz
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"runtime"
+	"slices"
+)
+
+// parallelBlockMax limits the sizes of the block decoded in parallel, as the
+// block is kept in memory compressed and uncompressed.
+const parallelBlockMax = 256 << 20
+
+// decodeBlockBufLen is the initial size of the output of the block decoded in
+// parallel.
+const decodeBlockBufLen = 1 << 20
+
+// NewParallelReader creates the reader which decodes up to workers blocks at
+// once, zero workers selects runtime.GOMAXPROCS. Only the blocks with both
+// sizes in the header, as xz writes them in multithreaded mode or Writer with
+// BlockSize, can be decoded in parallel; others are decoded sequentially with
+// no extra memory. The memory is bounded by workers times the block size.
+func NewParallelReader(inStream io.Reader, workers int) (*Reader, error) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	r, err := NewReader(inStream)
+	if err != nil {
+		return nil, err
+	}
+
+	r.workers = workers
+
+	return r, nil
+}
+
+// parallel reports whether the block can be decoded in parallel.
+func (h *blockHeader) parallel() bool {
+	return h.compressedSize != sizeUnknown && h.compressedSize <= parallelBlockMax &&
+		h.uncompressedSize != sizeUnknown && h.uncompressedSize <= parallelBlockMax
+}
+
+// blockJob is the block decoded in its own goroutine. The goroutine is
+// started when the next block is pending too, the single block is decoded
+// sequentially from src.
+type blockJob struct {
+	done chan struct{}
+
+	header *blockHeader
+	src    []byte
+
+	data []byte
+	rec  record
+	err  error
+}
+
+// readJob reads the block data, the padding and the check.
+func (r *Reader) readJob(header *blockHeader) (*blockJob, error) {
+	check := r.flags.check()
+	compressedSize := header.compressedSize
+
+	src := make([]byte, compressedSize+padLen(compressedSize)+int64(check.Size()))
+
+	_, err := io.ReadFull(r.inStream, src)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	return &blockJob{header: header, src: src}, nil
+}
+
+// start starts decoding of the block unless it is started, the window of
+// the decoder is not larger than windowMax unless it is zero.
+func (job *blockJob) start(check Check, windowMax int) {
+	if job.done != nil {
+		return
+	}
+
+	job.done = make(chan struct{})
+
+	go func() {
+		defer close(job.done)
+
+		job.data, job.rec, job.err = decodeBlock(job.src, job.header, check, &decoderCache{max: windowMax})
+		job.src = nil
+	}()
+}
+
+// finishJob waits for the first pending block and makes its data the output.
+// The single block which is not started is decoded sequentially.
+func (r *Reader) finishJob() error {
+	job := r.pending[0]
+	r.pending = r.pending[1:]
+
+	if job.done == nil {
+		return r.startSrcBlock(job)
+	}
+
+	<-job.done
+
+	if job.err != nil {
+		return job.err
+	}
+
+	r.out = job.data
+	r.records = append(r.records, job.rec)
+
+	return nil
+}
+
+// startSrcBlock makes the block read ahead in job the current block.
+func (r *Reader) startSrcBlock(job *blockJob) error {
+	r.src = bytes.NewReader(job.src)
+	r.srcIn = bufio.NewReader(r.src)
+
+	block, err := newBlockReader(r.srcIn, job.header, r.flags.check(), &r.decoder)
+	if err != nil {
+		return err
+	}
+
+	r.block = block
+
+	return nil
+}
+
+// decodeBlock decodes and verifies the block whose data, padding and check
+// are in src.
+func decodeBlock(src []byte, header *blockHeader, check Check, decoder *decoderCache) ([]byte, record, error) {
+	br := bytes.NewReader(src)
+	inStream := bufio.NewReader(br)
+
+	block, err := newBlockReader(inStream, header, check, decoder)
+	if err != nil {
+		return nil, record{}, err
+	}
+
+	// The output grows as the block is decoded, so the size in the header
+	// is not allocated for the few bytes of corrupted block.
+	size := int(header.uncompressedSize)
+	data := make([]byte, 0, min(size, decodeBlockBufLen))
+
+	for len(data) < size {
+		if len(data) == cap(data) {
+			data = slices.Grow(data, min(len(data), size-len(data)))
+		}
+
+		n, err := io.ReadFull(block, data[len(data):min(cap(data), size)])
+		data = data[:len(data)+n]
+
+		if err != nil {
+			return nil, record{}, unexpectedEOF(err)
+		}
+	}
+
+	err = block.readEnd()
+	if err != nil {
+		return nil, record{}, err
+	}
+
+	compressedSize := int64(len(src)) - int64(br.Len()) - int64(inStream.Buffered())
+
+	rec, err := block.close(inStream, compressedSize, check)
+	if err != nil {
+		return nil, record{}, err
+	}
+
+	return data, rec, nil
+}
@@ -0,0 +1,181 @@
+package xz
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kulaginds/lzma/internal/testgen"
+)
+
+func TestParallelReader(t *testing.T) {
+	r := require.New(t)
+
+	expected, err := os.ReadFile("../testassets/a.txt")
+	r.NoError(err)
+
+	testCases := []struct {
+		name string
+
+		inputFile string
+		repeat    int
+
+		checkErr func(err error, msgAndArgs ...interface{})
+	}{
+		{
+			name:      "single_block",
+			inputFile: "testassets/a.xz",
+			repeat:    1,
+			checkErr:  r.NoError,
+		},
+		{
+			name:      "blocks_without_sizes",
+			inputFile: "testassets/a_multiblock.xz",
+			repeat:    1,
+			checkErr:  r.NoError,
+		},
+		{
+			name:      "blocks_with_sizes",
+			inputFile: "testassets/a_multiblock_sizes.xz",
+			repeat:    1,
+			checkErr:  r.NoError,
+		},
+		{
+			name:      "multiple_streams_with_padding",
+			inputFile: "testassets/a_multistream.xz",
+			repeat:    2,
+			checkErr:  r.NoError,
+		},
+		{
+			name:      "bad_check",
+			inputFile: "testassets/bad_check.xz",
+			checkErr:  r.Error,
+		},
+		{
+			name:      "bad_index",
+			inputFile: "testassets/bad_index.xz",
+			checkErr:  r.Error,
+		},
+		{
+			name:      "bad_truncated",
+			inputFile: "testassets/bad_truncated.xz",
+			checkErr:  r.Error,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			input, err := os.Open(tc.inputFile)
+			r.NoError(err)
+			defer input.Close()
+
+			reader, err := NewParallelReader(input, 3)
+			r.NoError(err)
+
+			actual, err := io.ReadAll(reader)
+			tc.checkErr(err)
+			if err != nil {
+				return
+			}
+
+			r.Equal(bytes.Repeat(expected, tc.repeat), actual)
+		})
+	}
+}
+
+func TestParallelReaderWriter(t *testing.T) {
+	r := require.New(t)
+
+	data := testgen.Text(300000, 1)
+	compressed := compressBlocks(t, data, 20000)
+
+	for _, workers := range []int{0, 1, 2, 4, 32} {
+		reader, err := NewParallelReader(bytes.NewReader(compressed), workers)
+		r.NoError(err)
+
+		actual, err := io.ReadAll(reader)
+		r.NoError(err)
+		r.Equal(data, actual)
+	}
+}
+
+func TestParallelReaderCorruptedBlock(t *testing.T) {
+	r := require.New(t)
+
+	data := testgen.Text(100000, 1)
+	compressed := compressBlocks(t, data, 20000)
+
+	info, err := Inspect(bytes.NewReader(compressed))
+	r.NoError(err)
+
+	// the check of the third block
+	b := info.Streams[0].Blocks[2]
+	compressed[b.Offset+b.TotalSize-1] ^= 1
+
+	reader, err := NewParallelReader(bytes.NewReader(compressed), 4)
+	r.NoError(err)
+
+	actual, err := io.ReadAll(reader)
+	r.ErrorIs(err, ErrCheckMismatch)
+	r.Equal(data[:b.UncompressedOffset], actual)
+
+	// The error is sticky, the next blocks are not decoded.
+	actual, err = io.ReadAll(reader)
+	r.ErrorIs(err, ErrCheckMismatch)
+	r.Empty(actual)
+}
+
+func TestParallelReaderSingleBlock(t *testing.T) {
+	r := require.New(t)
+
+	data := testgen.Text(100000, 1)
+	compressed := compressBlocks(t, data, 1<<20)
+
+	reader, err := NewParallelReader(bytes.NewReader(compressed), 4)
+	r.NoError(err)
+
+	buf := make([]byte, 1000)
+	_, err = io.ReadFull(reader, buf)
+	r.NoError(err)
+
+	// The block is not buffered by the goroutine as there is nothing to
+	// decode in parallel.
+	r.NotNil(reader.block)
+	r.Empty(reader.pending)
+
+	rest, err := io.ReadAll(reader)
+	r.NoError(err)
+	r.Equal(data, append(buf, rest...))
+}
+
+func TestDecodeBlockSizeInHeader(t *testing.T) {
+	r := require.New(t)
+
+	compressed := compressBlocks(t, testgen.Text(1000, 1), 1<<20)
+
+	info, err := Inspect(bytes.NewReader(compressed))
+	r.NoError(err)
+
+	b := info.Streams[0].Blocks[0]
+
+	header, err := parseBlockHeader(compressed[b.Offset : b.Offset+int64(b.HeaderSize)])
+	r.NoError(err)
+
+	// The few compressed bytes claim the largest block decoded in parallel.
+	header.uncompressedSize = parallelBlockMax
+
+	var before, after runtime.MemStats
+
+	runtime.ReadMemStats(&before)
+
+	_, _, err = decodeBlock(compressed[b.Offset+int64(b.HeaderSize):b.Offset+b.TotalSize], header, CheckCRC32, nil)
+	r.ErrorIs(err, io.ErrUnexpectedEOF)
+
+	runtime.ReadMemStats(&after)
+
+	r.Less(after.TotalAlloc-before.TotalAlloc, uint64(parallelBlockMax/4))
+}
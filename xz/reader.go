@@ -0,0 +1,601 @@
+package xz
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/kulaginds/lzma"
+)
+
+// Reader decompresses .xz files. Concatenated streams and stream padding
+// are supported, every block is verified against its header, check and the
+// index of the stream.
+type Reader struct {
+	inStream *bufio.Reader
+	counter  *countingReader
+
+	flags   streamFlags
+	records []record
+	block   *blockReader
+
+	// workers is the number of blocks decoded in parallel, pending are the
+	// blocks being decoded, out is the rest of the decoded pending block.
+	workers int
+	pending []*blockJob
+	out     []byte
+
+	// src is the data of the block read ahead by the parallel reader but
+	// decoded sequentially, srcIn is the input of the block.
+	src   *bytes.Reader
+	srcIn *bufio.Reader
+
+	// barrier is set when the input is read up to the block which must be
+	// decoded sequentially, its header is next, or up to the index. err is
+	// returned after the pending blocks, then it is returned by all reads.
+	barrier bool
+	next    *blockHeader
+	err     error
+
+	isEndOfStream bool
+
+	// decoder is kept for the next blocks of the sequential reader.
+	decoder decoderCache
+}
+
+// ReaderConfig holds the options of the reader.
+type ReaderConfig struct {
+	// WindowMax caps the window of LZMA2 decoder, zero means the window of
+	// the dictionary size, or of the block size if it is smaller. Set it to
+	// the limit of the decoded data, so the dictionary size of the block does
+	// not allocate more; the data referring farther fail with ErrCorrupted.
+	WindowMax int
+}
+
+// NewReader reads the stream header and creates the reader.
+func NewReader(inStream io.Reader) (*Reader, error) {
+	return NewReaderConfig(inStream, ReaderConfig{})
+}
+
+// NewReaderConfig reads the stream header and creates the reader with the
+// options.
+func NewReaderConfig(inStream io.Reader, cfg ReaderConfig) (*Reader, error) {
+	counter := &countingReader{r: inStream}
+
+	r := &Reader{
+		inStream: bufio.NewReader(counter),
+		counter:  counter,
+		workers:  1,
+	}
+
+	if cfg.WindowMax > 0 {
+		r.decoder.max = cfg.WindowMax
+	}
+
+	flags, err := readStreamHeader(r.inStream)
+	if err != nil {
+		return nil, err
+	}
+
+	r.flags = flags
+
+	return r, nil
+}
+
+func init() {
+	lzma.RegisterFormat(lzma.FormatXZ, headerMagic, func(inStream io.Reader) (io.Reader, error) {
+		return NewReader(inStream)
+	})
+}
+
+// Reset discards the state of the reader and makes it read new input from
+// inStream, as NewReader does. It reuses the buffers and the window of the
+// LZMA2 decoder when the next blocks fit in it.
+func (r *Reader) Reset(inStream io.Reader) error {
+	r.counter.r = inStream
+	r.counter.n = 0
+	r.inStream.Reset(r.counter)
+
+	r.records = r.records[:0]
+	r.block = nil
+	r.pending = nil
+	r.out = nil
+	r.src = nil
+	r.srcIn = nil
+	r.barrier = false
+	r.next = nil
+	r.err = nil
+	r.isEndOfStream = false
+
+	flags, err := readStreamHeader(r.inStream)
+	if err != nil {
+		return err
+	}
+
+	r.flags = flags
+
+	return nil
+}
+
+// Check returns the type of integrity check of the current stream.
+func (r *Reader) Check() Check {
+	return r.flags.check()
+}
+
+// offset returns the number of bytes consumed from the input.
+func (r *Reader) offset() int64 {
+	return r.counter.n - int64(r.inStream.Buffered())
+}
+
+func (r *Reader) Read(p []byte) (n int, err error) {
+	for {
+		if len(r.out) > 0 {
+			n = copy(p, r.out)
+			r.out = r.out[n:]
+
+			return n, nil
+		}
+
+		if r.block == nil {
+			if r.isEndOfStream {
+				return 0, io.EOF
+			}
+
+			err = r.nextBlock()
+			if errors.Is(err, io.EOF) {
+				r.isEndOfStream = true
+
+				return 0, io.EOF
+			}
+			if err != nil {
+				return 0, r.fail(err)
+			}
+
+			continue
+		}
+
+		n, err = r.block.Read(p)
+		if errors.Is(err, io.EOF) {
+			err = r.closeBlock()
+			if err != nil {
+				return n, r.fail(err)
+			}
+
+			if n == 0 {
+				continue
+			}
+		}
+
+		if err != nil {
+			return n, r.fail(err)
+		}
+
+		return n, nil
+	}
+}
+
+// fail makes err returned by all next reads: the pending blocks are dropped
+// and the barrier stops reading of the next ones.
+func (r *Reader) fail(err error) error {
+	r.err = err
+	r.block = nil
+	r.pending = nil
+	r.out = nil
+	r.barrier = true
+	r.next = nil
+
+	return err
+}
+
+// nextBlock starts the next block or takes the next decoded block. At the end
+// of the stream it verifies the index and the footer and moves to the next
+// stream; io.EOF is returned when there are no more streams.
+func (r *Reader) nextBlock() error {
+	for !r.barrier && len(r.pending) < r.workers {
+		err := r.scanBlock()
+		if err != nil {
+			if len(r.pending) == 0 {
+				return err
+			}
+
+			// the error is returned after the data of the pending blocks
+			r.err = err
+			r.barrier = true
+		}
+	}
+
+	if len(r.pending) > 0 {
+		return r.finishJob()
+	}
+
+	if r.err != nil {
+		return r.err
+	}
+
+	r.barrier = false
+
+	if r.next == nil {
+		err := r.readIndexAndFooter()
+		if err != nil {
+			return err
+		}
+
+		return r.nextStream()
+	}
+
+	header := r.next
+	r.next = nil
+
+	start := r.offset()
+
+	block, err := newBlockReader(r.inStream, header, r.flags.check(), &r.decoder)
+	if err != nil {
+		return err
+	}
+
+	block.start = start
+	r.block = block
+
+	return nil
+}
+
+// scanBlock reads the next block header and starts decoding of the block in
+// parallel or sets the barrier.
+func (r *Reader) scanBlock() error {
+	b, err := r.inStream.ReadByte()
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+
+	if b == indexIndicator {
+		r.barrier = true
+
+		return nil
+	}
+
+	header, err := readBlockHeader(r.inStream, b)
+	if err != nil {
+		return err
+	}
+
+	if r.workers > 1 && header.parallel() {
+		job, err := r.readJob(header)
+		if err != nil {
+			return err
+		}
+
+		r.pending = append(r.pending, job)
+
+		if len(r.pending) > 1 {
+			for _, job := range r.pending {
+				job.start(r.flags.check(), r.decoder.max)
+			}
+		}
+
+		return nil
+	}
+
+	r.barrier = true
+	r.next = header
+
+	return nil
+}
+
+// closeBlock verifies the end of the block and records it for the index.
+func (r *Reader) closeBlock() error {
+	block := r.block
+	r.block = nil
+
+	inStream, compressedSize := r.inStream, r.offset()-block.start
+	if r.src != nil {
+		inStream = r.srcIn
+		compressedSize = r.src.Size() - int64(r.src.Len()) - int64(r.srcIn.Buffered())
+		r.src, r.srcIn = nil, nil
+	}
+
+	rec, err := block.close(inStream, compressedSize, r.flags.check())
+	if err != nil {
+		return err
+	}
+
+	r.records = append(r.records, rec)
+
+	return nil
+}
+
+func (r *Reader) readIndexAndFooter() error {
+	records, indexSize, err := readIndex(r.inStream)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+
+	if len(records) != len(r.records) {
+		return fmt.Errorf("%w: index does not match blocks", ErrCorrupted)
+	}
+
+	for i := range records {
+		if records[i] != r.records[i] {
+			return fmt.Errorf("%w: index does not match blocks", ErrCorrupted)
+		}
+	}
+
+	var buf [streamFooterLen]byte
+
+	_, err = io.ReadFull(r.inStream, buf[:])
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+
+	footer, err := parseStreamFooter(buf[:])
+	if err != nil {
+		return err
+	}
+
+	if footer.flags != r.flags {
+		return fmt.Errorf("%w: stream flags mismatch", ErrCorrupted)
+	}
+
+	if footer.indexSize != indexSize {
+		return fmt.Errorf("%w: backward size", ErrCorrupted)
+	}
+
+	r.records = r.records[:0]
+
+	return nil
+}
+
+// nextStream skips the stream padding and reads the header of the next
+// stream. It returns io.EOF at the end of input.
+func (r *Reader) nextStream() error {
+	var buf [streamHeaderLen]byte
+
+	for {
+		n, err := io.ReadFull(r.inStream, buf[:4])
+		if n == 0 && errors.Is(err, io.EOF) {
+			return io.EOF
+		}
+		if err != nil {
+			return fmt.Errorf("%w: stream padding", ErrCorrupted)
+		}
+
+		if !bytes.Equal(buf[:4], []byte{0, 0, 0, 0}) {
+			break
+		}
+	}
+
+	_, err := io.ReadFull(r.inStream, buf[4:])
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+
+	flags, err := parseStreamHeader(buf[:])
+	if err != nil {
+		return err
+	}
+
+	r.flags = flags
+
+	return nil
+}
+
+type blockReader struct {
+	header *blockHeader
+	r      io.Reader
+	hash   hash.Hash
+
+	start            int64
+	uncompressedSize int64
+}
+
+func newBlockReader(inStream *bufio.Reader, header *blockHeader, check Check, decoder *decoderCache) (*blockReader, error) {
+	r, err := newFilterReader(inStream, header, decoder)
+	if err != nil {
+		return nil, err
+	}
+
+	return &blockReader{
+		header: header,
+		r:      r,
+		hash:   check.newHash(),
+	}, nil
+}
+
+// close verifies the sizes, the padding and the check of the block whose data
+// is read completely and returns its index record.
+func (b *blockReader) close(inStream *bufio.Reader, compressedSize int64, check Check) (record, error) {
+	var rec record
+
+	if b.header.compressedSize != sizeUnknown && b.header.compressedSize != compressedSize {
+		return rec, fmt.Errorf("%w: compressed size of block", ErrCorrupted)
+	}
+
+	if b.header.uncompressedSize != sizeUnknown && b.header.uncompressedSize != b.uncompressedSize {
+		return rec, fmt.Errorf("%w: uncompressed size of block", ErrCorrupted)
+	}
+
+	for i := padLen(compressedSize); i > 0; i-- {
+		c, err := inStream.ReadByte()
+		if err != nil {
+			return rec, unexpectedEOF(err)
+		}
+
+		if c != 0 {
+			return rec, fmt.Errorf("%w: block padding", ErrCorrupted)
+		}
+	}
+
+	stored := make([]byte, check.Size())
+
+	_, err := io.ReadFull(inStream, stored)
+	if err != nil {
+		return rec, unexpectedEOF(err)
+	}
+
+	if b.hash != nil && !bytes.Equal(sum(b.hash, nil), stored) {
+		return rec, ErrCheckMismatch
+	}
+
+	rec.unpaddedSize = b.header.size + compressedSize + int64(check.Size())
+	rec.uncompressedSize = b.uncompressedSize
+
+	return rec, nil
+}
+
+// readEnd reads the end of the data of the block whose uncompressed size is
+// already read.
+func (b *blockReader) readEnd() error {
+	var buf [1]byte
+
+	n, err := b.Read(buf[:])
+	if n > 0 || err == nil {
+		return fmt.Errorf("%w: uncompressed size of block", ErrCorrupted)
+	}
+
+	if !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	return nil
+}
+
+func (b *blockReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.uncompressedSize += int64(n)
+
+	if b.hash != nil {
+		_, _ = b.hash.Write(p[:n])
+	}
+
+	if b.header.uncompressedSize != sizeUnknown && b.uncompressedSize > b.header.uncompressedSize {
+		return n, fmt.Errorf("%w: uncompressed size of block", ErrCorrupted)
+	}
+
+	return n, err
+}
+
+// newFilterReader creates the decoder of the block filter chain, the last
+// filter is LZMA2 and the others convert its output. The LZMA2 decoder is
+// taken from the cache if it is not nil.
+func newFilterReader(inStream *bufio.Reader, header *blockHeader, decoder *decoderCache) (io.Reader, error) {
+	last := header.filters[len(header.filters)-1]
+	if last.id != lzma.XZFilterLZMA2 {
+		return nil, ErrUnsupportedFilter
+	}
+
+	dictSize, err := lzma2DictSize(last.props)
+	if err != nil {
+		return nil, err
+	}
+
+	var r io.Reader
+
+	r, err = decoder.newReader2(inStream, decoderDictSize(dictSize, header.uncompressedSize))
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(header.filters) - 2; i >= 0; i-- {
+		r, err = newFilterDecoder(r, header.filters[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// decoderCache keeps LZMA2 decoder to reuse its window for the next blocks,
+// the window is not larger than max unless it is zero.
+type decoderCache struct {
+	r    *lzma.Reader2
+	size int
+	max  int
+}
+
+// newReader2 resets the cached decoder if its window is not smaller than
+// size, otherwise it creates new decoder and caches it. The nil cache always
+// creates new decoder.
+func (c *decoderCache) newReader2(inStream *bufio.Reader, size int) (*lzma.Reader2, error) {
+	if c == nil {
+		return lzma.NewReader2(inStream, size)
+	}
+
+	if c.max > 0 && size > c.max {
+		size = c.max
+	}
+
+	if c.r != nil && c.size >= size {
+		return c.r, c.r.Reset(inStream)
+	}
+
+	r, err := lzma.NewReader2(inStream, size)
+	if err != nil {
+		return nil, err
+	}
+
+	c.r, c.size = r, size
+
+	return r, nil
+}
+
+// newFilterDecoder creates the decoder of the filter in front of LZMA2, the
+// filters are taken from the registry of lzma.RegisterFilter.
+func newFilterDecoder(r io.Reader, f filter) (io.Reader, error) {
+	rf, ok := lzma.FilterByXZID(f.id)
+	if !ok || rf.Last {
+		return nil, ErrUnsupportedFilter
+	}
+
+	r, err := rf.Coder.NewReader(r, f.props)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnsupportedOptions, err)
+	}
+
+	return r, nil
+}
+
+func lzma2DictSize(props []byte) (uint32, error) {
+	if len(props) != 1 || props[0] > 40 {
+		return 0, ErrUnsupportedOptions
+	}
+
+	if props[0] == 40 {
+		return 0xFFFFFFFF, nil
+	}
+
+	return lzma.DecodeDictSize2(props[0]), nil
+}
+
+// decoderDictSize returns the dictionary size of LZMA2 decoder, which does
+// not need to be larger than the block. It is at least 1, as NewReader2
+// takes zero for its default size.
+func decoderDictSize(dictSize uint32, uncompressedSize int64) int {
+	if uncompressedSize != sizeUnknown && uncompressedSize < int64(dictSize) {
+		return int(max(uncompressedSize, 1))
+	}
+
+	return int(dictSize)
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+
+	return n, err
+}
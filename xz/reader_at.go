@@ -0,0 +1,253 @@
+package xz
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+var (
+	errNegativeOffset = errors.New("xz: negative offset")
+	errInvalidWhence  = errors.New("xz: invalid whence")
+)
+
+// indexedBlock is a block located by the index.
+type indexedBlock struct {
+	record
+
+	// offset is the offset of the block header in the input,
+	// uncompressedOffset is the offset of the block data in the output.
+	offset             int64
+	uncompressedOffset int64
+	check              Check
+}
+
+// ReaderAt provides random access to the uncompressed data of .xz file. It
+// loads the indexes of all streams and decodes only the blocks holding the
+// requested range, so the access is fast when the file consists of many
+// blocks, see WriterConfig.BlockSize.
+//
+// ReadAt may be called concurrently, Read and Seek share the position and
+// must not.
+type ReaderAt struct {
+	inStream io.ReaderAt
+	blocks   []indexedBlock
+	size     int64
+
+	pos int64
+	cur *blockCursor
+}
+
+// NewReaderAt reads the indexes of the .xz file of size bytes.
+func NewReaderAt(inStream io.ReaderAt, size int64) (*ReaderAt, error) {
+	streams, err := readStreamIndexes(inStream, size)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ReaderAt{inStream: inStream}
+
+	for _, s := range streams {
+		offset := s.offset + streamHeaderLen
+
+		for _, rec := range s.records {
+			r.blocks = append(r.blocks, indexedBlock{
+				record:             rec,
+				offset:             offset,
+				uncompressedOffset: r.size,
+				check:              s.flags.check(),
+			})
+
+			offset += rec.unpaddedSize + padLen(rec.unpaddedSize)
+			r.size += rec.uncompressedSize
+		}
+	}
+
+	return r, nil
+}
+
+// Size returns the size of the uncompressed data.
+func (r *ReaderAt) Size() int64 {
+	return r.size
+}
+
+func (r *ReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+
+	for len(p) > 0 && off < r.size {
+		c, err := r.openBlock(off)
+		if err != nil {
+			return n, err
+		}
+
+		k, err := io.ReadFull(c, p[:min(int64(len(p)), c.end-off)])
+		n += k
+		p = p[k:]
+		off += int64(k)
+
+		if err != nil {
+			return n, unexpectedEOF(err)
+		}
+	}
+
+	if len(p) > 0 {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+func (r *ReaderAt) Read(p []byte) (n int, err error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.cur == nil || r.cur.pos != r.pos || r.cur.pos == r.cur.end {
+		r.cur, err = r.openBlock(r.pos)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err = r.cur.Read(p)
+	r.pos += int64(n)
+
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+
+	return n, err
+}
+
+func (r *ReaderAt) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errInvalidWhence
+	}
+
+	if offset < 0 {
+		return 0, errNegativeOffset
+	}
+
+	r.pos = offset
+
+	return offset, nil
+}
+
+// openBlock starts decoding of the block holding the offset off and skips the
+// data before it.
+func (r *ReaderAt) openBlock(off int64) (*blockCursor, error) {
+	i := sort.Search(len(r.blocks), func(i int) bool {
+		return r.blocks[i].uncompressedOffset+r.blocks[i].uncompressedSize > off
+	})
+
+	b := &r.blocks[i]
+
+	counter := &countingReader{
+		r: io.NewSectionReader(r.inStream, b.offset, b.unpaddedSize+padLen(b.unpaddedSize)),
+	}
+	inStream := bufio.NewReader(counter)
+
+	first, err := inStream.ReadByte()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	header, err := readBlockHeader(inStream, first)
+	if err != nil {
+		return nil, err
+	}
+
+	compressedSize := b.unpaddedSize - header.size - int64(b.check.Size())
+
+	if compressedSize <= 0 ||
+		(header.compressedSize != sizeUnknown && header.compressedSize != compressedSize) ||
+		(header.uncompressedSize != sizeUnknown && header.uncompressedSize != b.uncompressedSize) {
+		return nil, fmt.Errorf("%w: block header does not match index", ErrCorrupted)
+	}
+
+	// the index is verified against the headers, so the sizes can be trusted
+	header.compressedSize = compressedSize
+	header.uncompressedSize = b.uncompressedSize
+
+	block, err := newBlockReader(inStream, header, b.check, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &blockCursor{
+		inStream: inStream,
+		counter:  counter,
+		block:    block,
+		check:    b.check,
+		pos:      b.uncompressedOffset,
+		end:      b.uncompressedOffset + b.uncompressedSize,
+	}
+
+	_, err = io.CopyN(io.Discard, c, off-c.pos)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	return c, nil
+}
+
+// blockCursor reads the data of a block from the position pos, the block is
+// verified when its data is read up to the end.
+type blockCursor struct {
+	inStream *bufio.Reader
+	counter  *countingReader
+	block    *blockReader
+	check    Check
+
+	pos int64
+	end int64
+}
+
+func (c *blockCursor) Read(p []byte) (n int, err error) {
+	if c.pos == c.end {
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > c.end-c.pos {
+		p = p[:c.end-c.pos]
+	}
+
+	n, err = c.block.Read(p)
+	c.pos += int64(n)
+
+	if errors.Is(err, io.EOF) && c.pos < c.end {
+		return n, io.ErrUnexpectedEOF
+	}
+
+	if err != nil && !errors.Is(err, io.EOF) {
+		return n, err
+	}
+
+	if c.pos == c.end {
+		return n, c.finish()
+	}
+
+	return n, nil
+}
+
+// finish reads the end of the block data and verifies the block.
+func (c *blockCursor) finish() error {
+	err := c.block.readEnd()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.block.close(c.inStream, c.counter.n-int64(c.inStream.Buffered())-c.block.header.size, c.check)
+
+	return err
+}
@@ -0,0 +1,148 @@
+package xz
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kulaginds/lzma/internal/testgen"
+)
+
+func compressBlocks(t *testing.T, data []byte, blockSize int64) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	w, err := NewWriterConfig(&buf, WriterConfig{Check: CheckCRC32, DictSize: 1 << 16, BlockSize: blockSize})
+	require.NoError(t, err)
+
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	return buf.Bytes()
+}
+
+func TestReaderAt(t *testing.T) {
+	r := require.New(t)
+
+	data := testgen.Text(20000, 1)
+	compressed := compressBlocks(t, data, 3000)
+
+	reader, err := NewReaderAt(bytes.NewReader(compressed), int64(len(compressed)))
+	r.NoError(err)
+	r.Equal(int64(len(data)), reader.Size())
+	r.Len(reader.blocks, 7)
+
+	r.NoError(iotest.TestReader(reader, data))
+
+	// require must not be used out of the test goroutine
+	a := assert.New(t)
+	rnd := rand.New(rand.NewSource(1))
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		off := rnd.Int63n(int64(len(data)))
+		size := rnd.Intn(7000)
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			p := make([]byte, size)
+
+			n, err := reader.ReadAt(p, off)
+			if off+int64(size) > int64(len(data)) {
+				a.ErrorIs(err, io.EOF)
+			} else {
+				a.NoError(err)
+			}
+
+			a.Equal(data[off:off+int64(n)], p[:n])
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestReaderAtMultipleStreams(t *testing.T) {
+	r := require.New(t)
+
+	expected, err := os.ReadFile("../testassets/a.txt")
+	r.NoError(err)
+
+	compressed, err := os.ReadFile("testassets/a_multistream.xz")
+	r.NoError(err)
+
+	reader, err := NewReaderAt(bytes.NewReader(compressed), int64(len(compressed)))
+	r.NoError(err)
+	r.Len(reader.blocks, 2)
+
+	r.NoError(iotest.TestReader(reader, bytes.Repeat(expected, 2)))
+}
+
+func TestReaderAtCorrupted(t *testing.T) {
+	r := require.New(t)
+
+	testCases := []struct {
+		name string
+
+		inputFile string
+
+		checkErr1 func(err error, msgAndArgs ...interface{})
+		checkErr2 func(err error, msgAndArgs ...interface{})
+	}{
+		{
+			name:      "bad_check",
+			inputFile: "testassets/bad_check.xz",
+			checkErr1: r.NoError,
+			checkErr2: r.Error,
+		},
+		{
+			name:      "bad_index",
+			inputFile: "testassets/bad_index.xz",
+			checkErr1: r.Error,
+		},
+		{
+			name:      "bad_truncated",
+			inputFile: "testassets/bad_truncated.xz",
+			checkErr1: r.Error,
+		},
+		{
+			name:      "bad_block_header",
+			inputFile: "testassets/bad_block_header.xz",
+			checkErr1: r.NoError,
+			checkErr2: r.Error,
+		},
+		{
+			name:      "not_xz",
+			inputFile: "../testassets/a.lzma",
+			checkErr1: r.Error,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			compressed, err := os.ReadFile(tc.inputFile)
+			r.NoError(err)
+
+			reader, err := NewReaderAt(bytes.NewReader(compressed), int64(len(compressed)))
+			tc.checkErr1(err)
+			if err != nil {
+				return
+			}
+
+			_, err = io.ReadAll(reader)
+			tc.checkErr2(err)
+		})
+	}
+}
@@ -0,0 +1,335 @@
+package xz
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kulaginds/lzma"
+	"github.com/kulaginds/lzma/internal/testgen"
+)
+
+func TestReader(t *testing.T) {
+	r := require.New(t)
+
+	expected, err := os.ReadFile("../testassets/a.txt")
+	r.NoError(err)
+
+	testCases := []struct {
+		name string
+
+		inputFile string
+		repeat    int
+
+		checkErr1 func(err error, msgAndArgs ...interface{})
+		checkErr2 func(err error, msgAndArgs ...interface{})
+	}{
+		{
+			name:      "check_crc64",
+			inputFile: "testassets/a.xz",
+			repeat:    1,
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "check_crc32",
+			inputFile: "testassets/a_crc32.xz",
+			repeat:    1,
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "check_sha256",
+			inputFile: "testassets/a_sha256.xz",
+			repeat:    1,
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "check_none",
+			inputFile: "testassets/a_none.xz",
+			repeat:    1,
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "multiple_blocks",
+			inputFile: "testassets/a_multiblock.xz",
+			repeat:    1,
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "multiple_blocks_with_sizes",
+			inputFile: "testassets/a_multiblock_sizes.xz",
+			repeat:    1,
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "multiple_streams_with_padding",
+			inputFile: "testassets/a_multistream.xz",
+			repeat:    2,
+			checkErr1: r.NoError,
+			checkErr2: r.NoError,
+		},
+		{
+			name:      "bad_check",
+			inputFile: "testassets/bad_check.xz",
+			checkErr1: r.NoError,
+			checkErr2: r.Error,
+		},
+		{
+			name:      "bad_index",
+			inputFile: "testassets/bad_index.xz",
+			checkErr1: r.NoError,
+			checkErr2: r.Error,
+		},
+		{
+			name:      "bad_truncated",
+			inputFile: "testassets/bad_truncated.xz",
+			checkErr1: r.NoError,
+			checkErr2: r.Error,
+		},
+		{
+			name:      "bad_block_header",
+			inputFile: "testassets/bad_block_header.xz",
+			checkErr1: r.NoError,
+			checkErr2: r.Error,
+		},
+		{
+			name:      "not_xz",
+			inputFile: "../testassets/a.lzma",
+			checkErr1: r.Error,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			input, err := os.Open(tc.inputFile)
+			r.NoError(err)
+			defer input.Close()
+
+			reader, err := NewReader(input)
+			tc.checkErr1(err)
+			if err != nil {
+				return
+			}
+
+			actual, err := io.ReadAll(reader)
+			tc.checkErr2(err)
+			if err != nil {
+				return
+			}
+
+			r.Equal(bytes.Repeat(expected, tc.repeat), actual)
+		})
+	}
+}
+
+func TestReaderCheckMismatch(t *testing.T) {
+	input, err := os.Open("testassets/bad_check.xz")
+	require.NoError(t, err)
+	defer input.Close()
+
+	reader, err := NewReader(input)
+	require.NoError(t, err)
+
+	_, err = io.Copy(io.Discard, reader)
+	require.ErrorIs(t, err, ErrCheckMismatch)
+}
+
+func TestReaderFilters(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		inputFile    string
+		expectedFile string
+	}{
+		{
+			name:         "x86",
+			inputFile:    "testassets/x86.xz",
+			expectedFile: "../testassets/x86.bin",
+		},
+		{
+			name:         "arm",
+			inputFile:    "testassets/arm.xz",
+			expectedFile: "../testassets/arm.bin",
+		},
+		{
+			name:         "arm_thumb",
+			inputFile:    "testassets/armthumb.xz",
+			expectedFile: "../testassets/armthumb.bin",
+		},
+		{
+			name:         "powerpc",
+			inputFile:    "testassets/powerpc.xz",
+			expectedFile: "../testassets/powerpc.bin",
+		},
+		{
+			name:         "sparc",
+			inputFile:    "testassets/sparc.xz",
+			expectedFile: "../testassets/sparc.bin",
+		},
+		{
+			name:         "ia64",
+			inputFile:    "testassets/ia64.xz",
+			expectedFile: "../testassets/ia64.bin",
+		},
+		{
+			name:         "arm64",
+			inputFile:    "testassets/arm64.xz",
+			expectedFile: "../testassets/arm64.bin",
+		},
+		{
+			name:         "riscv",
+			inputFile:    "testassets/riscv.xz",
+			expectedFile: "../testassets/riscv.bin",
+		},
+		{
+			name:         "delta",
+			inputFile:    "testassets/delta.xz",
+			expectedFile: "../testassets/delta.bin",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			expected, err := os.ReadFile(tc.expectedFile)
+			r.NoError(err)
+
+			input, err := os.Open(tc.inputFile)
+			r.NoError(err)
+			defer input.Close()
+
+			reader, err := NewReader(input)
+			r.NoError(err)
+
+			actual, err := io.ReadAll(reader)
+			r.NoError(err)
+			r.True(bytes.Equal(expected, actual))
+		})
+	}
+}
+
+func TestReaderReset(t *testing.T) {
+	r := require.New(t)
+
+	expected, err := os.ReadFile("../testassets/a.txt")
+	r.NoError(err)
+
+	inputs := []struct {
+		name     string
+		expected []byte
+	}{
+		{name: "testassets/a.xz", expected: expected},
+		{name: "testassets/x86.xz"},
+		{name: "testassets/a_multiblock.xz", expected: expected},
+		{name: "testassets/a_multistream.xz"},
+		{name: "testassets/a.xz", expected: expected},
+	}
+
+	var reader *Reader
+
+	for _, input := range inputs {
+		data, err := os.ReadFile(input.name)
+		r.NoError(err)
+
+		fresh, err := NewReader(bytes.NewReader(data))
+		r.NoError(err)
+
+		want, err := io.ReadAll(fresh)
+		r.NoError(err)
+
+		if input.expected != nil {
+			r.Equal(input.expected, want)
+		}
+
+		if reader == nil {
+			reader, err = NewReader(bytes.NewReader(data))
+		} else {
+			err = reader.Reset(bytes.NewReader(data))
+		}
+		r.NoError(err, input.name)
+
+		actual, err := io.ReadAll(reader)
+		r.NoError(err, input.name)
+		r.True(bytes.Equal(want, actual), input.name)
+	}
+
+	r.ErrorIs(reader.Reset(bytes.NewReader([]byte("not xz at all"))), ErrFormat)
+}
+
+func TestReaderWindowMax(t *testing.T) {
+	r := require.New(t)
+
+	expected, err := os.ReadFile("../testassets/a.txt")
+	r.NoError(err)
+
+	// The block of a.xz has no sizes in the header and 8 MiB dictionary.
+	compressed, err := os.ReadFile("testassets/a.xz")
+	r.NoError(err)
+
+	for _, workers := range []int{1, 2} {
+		var before, after runtime.MemStats
+
+		runtime.ReadMemStats(&before)
+
+		reader, err := NewReaderConfig(bytes.NewReader(compressed), ReaderConfig{WindowMax: 1000})
+		r.NoError(err)
+
+		reader.workers = workers
+
+		actual, err := io.ReadAll(reader)
+		r.NoError(err)
+		r.Equal(expected, actual)
+
+		runtime.ReadMemStats(&after)
+
+		r.Less(after.TotalAlloc-before.TotalAlloc, uint64(1<<20))
+	}
+
+	// The data refers farther than the window.
+	data := testgen.Text(100000, 1)
+	data = append(data, data...)
+
+	var buf bytes.Buffer
+
+	w, err := NewWriterConfig(&buf, WriterConfig{Check: CheckCRC32, DictSize: 1 << 20})
+	r.NoError(err)
+
+	_, err = w.Write(data)
+	r.NoError(err)
+	r.NoError(w.Close())
+
+	reader, err := NewReaderConfig(&buf, ReaderConfig{WindowMax: 1 << 16})
+	r.NoError(err)
+
+	_, err = io.ReadAll(reader)
+	r.Error(err)
+}
+
+func TestDetect(t *testing.T) {
+	r := require.New(t)
+
+	input, err := os.Open("testassets/a_multistream.xz")
+	r.NoError(err)
+	defer input.Close()
+
+	reader, format, err := lzma.NewReader(input)
+	r.NoError(err)
+	r.Equal(lzma.FormatXZ, format)
+
+	actual, err := io.ReadAll(reader)
+	r.NoError(err)
+
+	expected, err := os.ReadFile("../testassets/a.txt")
+	r.NoError(err)
+	r.Equal(bytes.Repeat(expected, 2), actual)
+}
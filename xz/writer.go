@@ -0,0 +1,349 @@
+package xz
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/kulaginds/lzma"
+)
+
+// WriterConfig holds the options of Writer.
+type WriterConfig struct {
+	// Check is the integrity check of blocks.
+	Check Check
+	// DictSize is LZMA2 dictionary size, zero selects lzma.DefaultDictSize.
+	DictSize int
+	// BlockSize is the maximum uncompressed size of a block. Zero writes all
+	// data in one block whose header has no sizes. Otherwise every block is
+	// buffered in memory, so its header stores both sizes, as xz does in
+	// multithreaded mode.
+	BlockSize int64
+	// Filters are put in front of LZMA2 filter, up to three filters given by
+	// xz filter ID of lzma.RegisterFilter, for example Delta or BCJ.
+	Filters []lzma.FilterSpec
+}
+
+// DefaultWriterConfig returns the configuration of xz utility: CRC64 check,
+// 8 MiB dictionary and single block.
+func DefaultWriterConfig() WriterConfig {
+	return WriterConfig{
+		Check:    CheckCRC64,
+		DictSize: lzma.DefaultDictSize,
+	}
+}
+
+var (
+	errWriterClosed      = errors.New("xz: writer is closed")
+	errNegativeBlockSize = errors.New("xz: negative block size")
+)
+
+// Writer compresses data to .xz stream with LZMA2 filter and the optional
+// filters in front of it.
+type Writer struct {
+	outStream io.Writer
+	cfg       WriterConfig
+	flags     streamFlags
+	filters   []filter
+	coders    []lzma.Coder
+
+	records []record
+	lzma2   *lzma.Writer2
+	block   *blockWriter
+	blocks  bytes.Buffer
+	buf     []byte
+
+	closed bool
+}
+
+// NewWriter creates writer with DefaultWriterConfig.
+func NewWriter(outStream io.Writer) (*Writer, error) {
+	return NewWriterConfig(outStream, DefaultWriterConfig())
+}
+
+// NewWriterConfig writes the stream header and creates the writer.
+func NewWriterConfig(outStream io.Writer, cfg WriterConfig) (*Writer, error) {
+	if !cfg.Check.Supported() {
+		return nil, ErrUnsupportedOptions
+	}
+
+	if cfg.BlockSize < 0 {
+		return nil, errNegativeBlockSize
+	}
+
+	if cfg.DictSize == 0 {
+		cfg.DictSize = lzma.DefaultDictSize
+	}
+
+	if cfg.DictSize < dictSizeMin || int64(cfg.DictSize) > dictSizeMax {
+		return nil, lzma.ErrDictOutOfRange
+	}
+
+	w := &Writer{
+		outStream: outStream,
+		cfg:       cfg,
+		flags:     newStreamFlags(cfg.Check),
+	}
+
+	err := w.initFilters()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = outStream.Write(appendStreamHeader(nil, w.flags))
+	if err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// initFilters validates the filter chain of cfg and looks up the coders of
+// the filters in front of LZMA2.
+func (w *Writer) initFilters() error {
+	specs := make([]lzma.FilterSpec, 0, len(w.cfg.Filters)+1)
+	for _, f := range w.cfg.Filters {
+		specs = append(specs, lzma.FilterSpec{XZID: f.XZID, Props: f.Props})
+	}
+
+	specs = append(specs, lzma.FilterSpec{
+		XZID:  lzma.XZFilterLZMA2,
+		Props: []byte{lzma.EncodeDictSize2(uint32(w.cfg.DictSize))},
+	})
+
+	chain, err := lzma.NewChain(specs...)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUnsupportedFilter, err)
+	}
+
+	for i, f := range chain.Filters() {
+		w.filters = append(w.filters, filter{id: specs[i].XZID, props: specs[i].Props})
+
+		if !f.Last {
+			w.coders = append(w.coders, f.Coder)
+		}
+	}
+
+	return nil
+}
+
+func (w *Writer) Write(p []byte) (n int, err error) {
+	if w.closed {
+		return 0, errWriterClosed
+	}
+
+	for len(p) > 0 {
+		if w.block == nil {
+			err = w.startBlock()
+			if err != nil {
+				return n, err
+			}
+		}
+
+		k := len(p)
+		if w.cfg.BlockSize > 0 && int64(k) > w.cfg.BlockSize-w.block.uncompressedSize {
+			k = int(w.cfg.BlockSize - w.block.uncompressedSize)
+		}
+
+		k, err = w.block.Write(p[:k])
+		n += k
+		p = p[k:]
+
+		if err != nil {
+			return n, err
+		}
+
+		if w.block.uncompressedSize == w.cfg.BlockSize {
+			err = w.finishBlock()
+			if err != nil {
+				return n, err
+			}
+		}
+	}
+
+	return n, nil
+}
+
+func (w *Writer) startBlock() error {
+	header := &blockHeader{
+		compressedSize:   sizeUnknown,
+		uncompressedSize: sizeUnknown,
+		filters:          w.filters,
+	}
+
+	out := &countingWriter{w: w.outStream}
+
+	if w.cfg.BlockSize > 0 {
+		w.blocks.Reset()
+		out.w = &w.blocks
+	} else {
+		buf, err := header.encode()
+		if err != nil {
+			return err
+		}
+
+		_, err = w.outStream.Write(buf)
+		if err != nil {
+			return err
+		}
+
+		header.size = int64(len(buf))
+	}
+
+	if w.lzma2 == nil {
+		lzma2, err := lzma.NewWriter2(out, w.cfg.DictSize)
+		if err != nil {
+			return err
+		}
+
+		w.lzma2 = lzma2
+	} else {
+		w.lzma2.Reset(out)
+	}
+
+	w.block = &blockWriter{
+		header:  header,
+		out:     out,
+		lzma2:   w.lzma2,
+		w:       w.lzma2,
+		filters: make([]io.WriteCloser, len(w.coders)),
+		hash:    w.cfg.Check.newHash(),
+	}
+
+	for i := len(w.coders) - 1; i >= 0; i-- {
+		fw, err := w.coders[i].NewWriter(w.block.w, w.filters[i].props)
+		if err != nil {
+			return err
+		}
+
+		w.block.filters[i] = fw
+		w.block.w = fw
+	}
+
+	return nil
+}
+
+// finishBlock writes the rest of the block: the header and the data if the
+// block is buffered, the padding and the check.
+func (w *Writer) finishBlock() error {
+	block := w.block
+	w.block = nil
+
+	for _, fw := range block.filters {
+		err := fw.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := block.lzma2.Close()
+	if err != nil {
+		return err
+	}
+
+	header := block.header
+
+	if w.cfg.BlockSize > 0 {
+		header.compressedSize = block.out.n
+		header.uncompressedSize = block.uncompressedSize
+
+		buf, err := header.encode()
+		if err != nil {
+			return err
+		}
+
+		header.size = int64(len(buf))
+
+		_, err = w.outStream.Write(buf)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.outStream.Write(w.blocks.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+
+	w.buf = append(w.buf[:0], make([]byte, padLen(block.out.n))...)
+	if block.hash != nil {
+		w.buf = sum(block.hash, w.buf)
+	}
+
+	_, err = w.outStream.Write(w.buf)
+	if err != nil {
+		return err
+	}
+
+	w.records = append(w.records, record{
+		unpaddedSize:     header.size + block.out.n + int64(w.cfg.Check.Size()),
+		uncompressedSize: block.uncompressedSize,
+	})
+
+	return nil
+}
+
+// Close finishes the last block and writes the index and the stream footer.
+// It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return errWriterClosed
+	}
+
+	w.closed = true
+
+	if w.block != nil {
+		err := w.finishBlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	w.buf = appendIndex(w.buf[:0], w.records)
+	w.buf = appendStreamFooter(w.buf, streamFooter{
+		flags:     w.flags,
+		indexSize: int64(len(w.buf)),
+	})
+
+	_, err := w.outStream.Write(w.buf)
+
+	return err
+}
+
+type blockWriter struct {
+	header *blockHeader
+	out    *countingWriter
+	lzma2  *lzma.Writer2
+	hash   hash.Hash
+
+	// w is the first of filters or lzma2 if there are no filters.
+	w       io.Writer
+	filters []io.WriteCloser
+
+	uncompressedSize int64
+}
+
+func (b *blockWriter) Write(p []byte) (int, error) {
+	n, err := b.w.Write(p)
+	b.uncompressedSize += int64(n)
+
+	if b.hash != nil {
+		_, _ = b.hash.Write(p[:n])
+	}
+
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
@@ -0,0 +1,225 @@
+package xz
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/kulaginds/lzma"
+	"github.com/kulaginds/lzma/internal/testgen"
+	"github.com/stretchr/testify/require"
+)
+
+// emptyStream is the output of xz for empty input.
+var emptyStream = []byte{
+	0xfd, 0x37, 0x7a, 0x58, 0x5a, 0x00, 0x00, 0x04, 0xe6, 0xd6, 0xb4, 0x46,
+	0x00, 0x00, 0x00, 0x00, 0x1c, 0xdf, 0x44, 0x21, 0x1f, 0xb6, 0xf3, 0x7d,
+	0x01, 0x00, 0x00, 0x00, 0x00, 0x04, 0x59, 0x5a,
+}
+
+func TestWriterEmpty(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := NewWriter(&buf)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	require.Equal(t, emptyStream, buf.Bytes())
+}
+
+func TestWriter(t *testing.T) {
+	data := testgen.Text(300000, 1)
+
+	testCases := []struct {
+		name string
+
+		cfg    WriterConfig
+		blocks int
+	}{
+		{
+			name:   "default",
+			cfg:    DefaultWriterConfig(),
+			blocks: 1,
+		},
+		{
+			name:   "check_none",
+			cfg:    WriterConfig{Check: CheckNone, DictSize: 1 << 16},
+			blocks: 1,
+		},
+		{
+			name:   "check_crc32",
+			cfg:    WriterConfig{Check: CheckCRC32, DictSize: 1 << 16},
+			blocks: 1,
+		},
+		{
+			name:   "check_sha256",
+			cfg:    WriterConfig{Check: CheckSHA256, DictSize: 1 << 16},
+			blocks: 1,
+		},
+		{
+			name:   "blocks",
+			cfg:    WriterConfig{Check: CheckCRC64, DictSize: 1 << 16, BlockSize: 100000},
+			blocks: 3,
+		},
+		{
+			name:   "blocks_with_tail",
+			cfg:    WriterConfig{Check: CheckCRC32, DictSize: 1 << 16, BlockSize: 70000},
+			blocks: 5,
+		},
+		{
+			name: "filters",
+			cfg: WriterConfig{
+				Check:    CheckCRC64,
+				DictSize: 1 << 16,
+				Filters: []lzma.FilterSpec{
+					{XZID: lzma.XZFilterDelta, Props: []byte{0}},
+					{XZID: lzma.XZFilterX86, Props: []byte{0, 0x10, 0, 0}},
+				},
+			},
+			blocks: 1,
+		},
+		{
+			name: "filters_blocks",
+			cfg: WriterConfig{
+				Check:     CheckCRC32,
+				DictSize:  1 << 16,
+				BlockSize: 100000,
+				Filters:   []lzma.FilterSpec{{XZID: lzma.XZFilterARM64}},
+			},
+			blocks: 3,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			var buf bytes.Buffer
+
+			w, err := NewWriterConfig(&buf, tc.cfg)
+			r.NoError(err)
+
+			// uneven writes cross the block boundaries
+			for p := data; len(p) > 0; {
+				n := 30000
+				if n > len(p) {
+					n = len(p)
+				}
+
+				_, err = w.Write(p[:n])
+				r.NoError(err)
+				p = p[n:]
+			}
+
+			r.NoError(w.Close())
+			r.Less(buf.Len(), len(data)/2)
+
+			reader, err := NewReader(bytes.NewReader(buf.Bytes()))
+			r.NoError(err)
+			r.Equal(tc.cfg.Check, reader.Check())
+
+			actual, err := io.ReadAll(reader)
+			r.NoError(err)
+			r.Equal(data, actual)
+			r.Len(reader.records, 0)
+
+			footer, err := parseStreamFooter(buf.Bytes()[buf.Len()-streamFooterLen:])
+			r.NoError(err)
+
+			index := buf.Bytes()[buf.Len()-streamFooterLen-int(footer.indexSize):]
+			records, _, err := readIndex(bytes.NewReader(index[1:]))
+			r.NoError(err)
+			r.Len(records, tc.blocks)
+		})
+	}
+}
+
+// notFilter is the third-party filter inverting the bytes.
+type notFilter struct{}
+
+const notFilterID = 0x4000
+
+func (notFilter) NewReader(inStream io.Reader, _ []byte) (io.Reader, error) {
+	return notReader{inStream}, nil
+}
+
+func (notFilter) NewWriter(outStream io.Writer, _ []byte) (io.WriteCloser, error) {
+	return notWriter{outStream}, nil
+}
+
+type notReader struct{ r io.Reader }
+
+func (n notReader) Read(p []byte) (int, error) {
+	k, err := n.r.Read(p)
+	for i := range p[:k] {
+		p[i] = ^p[i]
+	}
+
+	return k, err
+}
+
+type notWriter struct{ w io.Writer }
+
+func (n notWriter) Write(p []byte) (int, error) {
+	buf := make([]byte, len(p))
+	for i, b := range p {
+		buf[i] = ^b
+	}
+
+	return n.w.Write(buf)
+}
+
+func (notWriter) Close() error {
+	return nil
+}
+
+func init() {
+	lzma.RegisterFilter(lzma.Filter{Name: "not", XZID: notFilterID, Coder: notFilter{}})
+}
+
+func TestWriterThirdPartyFilter(t *testing.T) {
+	r := require.New(t)
+	data := testgen.Text(100000, 1)
+
+	var buf bytes.Buffer
+
+	w, err := NewWriterConfig(&buf, WriterConfig{
+		Check:    CheckCRC32,
+		DictSize: 1 << 16,
+		Filters:  []lzma.FilterSpec{{XZID: notFilterID}, {XZID: lzma.XZFilterX86}},
+	})
+	r.NoError(err)
+
+	_, err = w.Write(data)
+	r.NoError(err)
+	r.NoError(w.Close())
+
+	reader, err := NewReader(bytes.NewReader(buf.Bytes()))
+	r.NoError(err)
+
+	actual, err := io.ReadAll(reader)
+	r.NoError(err)
+	r.Equal(data, actual)
+
+	info, err := Inspect(bytes.NewReader(buf.Bytes()))
+	r.NoError(err)
+	r.Equal("--not", info.Streams[0].Blocks[0].Filters[0].String())
+}
+
+func TestWriterFiltersErrors(t *testing.T) {
+	x86 := lzma.FilterSpec{XZID: lzma.XZFilterX86}
+
+	for _, filters := range [][]lzma.FilterSpec{
+		{x86, x86, x86, x86},
+		{{XZID: 0x7F}},
+		{{XZID: lzma.XZFilterLZMA2, Props: []byte{16}}},
+	} {
+		_, err := NewWriterConfig(io.Discard, WriterConfig{Filters: filters})
+		require.ErrorIs(t, err, ErrUnsupportedFilter)
+	}
+}
+
+func TestWriterUnsupportedCheck(t *testing.T) {
+	_, err := NewWriterConfig(io.Discard, WriterConfig{Check: 0x02})
+	require.ErrorIs(t, err, ErrUnsupportedOptions)
+}
@@ -0,0 +1,210 @@
+package lzma
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+// ZipMethodLZMA is the compression method of LZMA entries of ZIP files.
+const ZipMethodLZMA = 14
+
+// ZipFlagEOS is the general purpose flag of ZIP entry whose LZMA stream is
+// terminated by the end marker.
+const ZipFlagEOS = 0x2
+
+// The header of LZMA data in ZIP entry: version of LZMA SDK, the size of
+// the properties and the properties.
+const (
+	zipVersionMajor = 9
+	zipVersionMinor = 20
+	zipHeaderLen    = 4 + LZMAPropsLen
+)
+
+var (
+	errZipHeader    = errors.New("lzma: invalid LZMA header of ZIP entry")
+	errZipMethod    = errors.New("lzma: ZIP entry is not compressed by LZMA")
+	errZipSize      = errors.New("lzma: ZIP entry size mismatch")
+	errZipChecksum  = errors.New("lzma: ZIP entry checksum error")
+	registerZipOnce sync.Once
+)
+
+// RegisterZip registers ZipDecompressor and ZipCompressor for ZipMethodLZMA
+// in archive/zip, repeated calls do nothing.
+func RegisterZip() {
+	registerZipOnce.Do(func() {
+		zip.RegisterDecompressor(ZipMethodLZMA, ZipDecompressor)
+		zip.RegisterCompressor(ZipMethodLZMA, ZipCompressor)
+	})
+}
+
+// ZipDecompressor is zip.Decompressor of LZMA entries. It does not know the
+// uncompressed size, so it decodes up to the end marker or the end of the
+// compressed data, archive/zip checks the size and CRC. OpenZipFile uses
+// the size of the entry.
+func ZipDecompressor(r io.Reader) io.ReadCloser {
+	return &zipReader{inStream: bufio.NewReader(r), unpackSize: ^uint64(0)}
+}
+
+// ZipCompressor is zip.Compressor of LZMA entries with default properties.
+// The stream is terminated by the end marker, so ZipFlagEOS should be set in
+// the header of the entry.
+func ZipCompressor(w io.Writer) (io.WriteCloser, error) {
+	return &zipWriter{outStream: w}, nil
+}
+
+// zipWriter writes the header on the first write, archive/zip creates the
+// compressor before it writes the header of the entry.
+type zipWriter struct {
+	outStream io.Writer
+	w         *Writer1
+}
+
+func (z *zipWriter) start() error {
+	props := DefaultProperties()
+
+	header := make([]byte, 0, zipHeaderLen)
+	header = append(header, zipVersionMajor, zipVersionMinor)
+	header = binary.LittleEndian.AppendUint16(header, LZMAPropsLen)
+	header = append(header, props.Encode()...)
+
+	_, err := z.outStream.Write(header)
+	if err != nil {
+		return err
+	}
+
+	z.w, err = NewRawWriter1(z.outStream, props, true)
+
+	return err
+}
+
+func (z *zipWriter) Write(p []byte) (int, error) {
+	if z.w == nil {
+		err := z.start()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return z.w.Write(p)
+}
+
+func (z *zipWriter) Close() error {
+	if z.w == nil {
+		err := z.start()
+		if err != nil {
+			return err
+		}
+	}
+
+	return z.w.Close()
+}
+
+// OpenZipFile opens LZMA entry of ZIP file. The decoder uses the
+// uncompressed size of the entry, the end marker is read if ZipFlagEOS is
+// set. The size and CRC are verified at the end.
+func OpenZipFile(f *zip.File) (io.ReadCloser, error) {
+	if f.Method != ZipMethodLZMA {
+		return nil, errZipMethod
+	}
+
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	return &zipFileReader{
+		zipReader: zipReader{
+			inStream:   bufio.NewReader(raw),
+			unpackSize: f.UncompressedSize64,
+		},
+		f:   f,
+		crc: crc32.NewIEEE(),
+	}, nil
+}
+
+type zipReader struct {
+	inStream   *bufio.Reader
+	unpackSize uint64
+
+	r   *Reader1
+	err error
+}
+
+func (z *zipReader) Read(p []byte) (int, error) {
+	if z.r == nil && z.err == nil {
+		z.r, z.err = newZipReader1(z.inStream, z.unpackSize)
+	}
+
+	if z.err != nil {
+		return 0, z.err
+	}
+
+	return z.r.Read(p)
+}
+
+func (z *zipReader) Close() error {
+	return nil
+}
+
+// newZipReader1 reads the header and creates the decoder of LZMA data.
+func newZipReader1(inStream *bufio.Reader, unpackSize uint64) (*Reader1, error) {
+	var header [zipHeaderLen]byte
+
+	_, err := io.ReadFull(inStream, header[:])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errZipHeader, err)
+	}
+
+	if binary.LittleEndian.Uint16(header[2:4]) != LZMAPropsLen {
+		return nil, errZipHeader
+	}
+
+	lc, pb, lp, err := DecodeProp(header[4])
+	if err != nil {
+		return nil, err
+	}
+
+	dictSize, err := DecodeDictSize(header[5:9])
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reader1{
+		rangeDec:  newRangeDecoder(inStream),
+		outWindow: newWindow(dictSize),
+	}
+
+	return r, r.initialize(lc, pb, lp, unpackSize)
+}
+
+type zipFileReader struct {
+	zipReader
+
+	f   *zip.File
+	crc hash.Hash32
+	n   uint64
+}
+
+func (z *zipFileReader) Read(p []byte) (int, error) {
+	n, err := z.zipReader.Read(p)
+	_, _ = z.crc.Write(p[:n])
+	z.n += uint64(n)
+
+	if errors.Is(err, io.EOF) {
+		switch {
+		case z.n != z.f.UncompressedSize64:
+			err = errZipSize
+		case z.crc.Sum32() != z.f.CRC32:
+			err = errZipChecksum
+		}
+	}
+
+	return n, err
+}
@@ -0,0 +1,183 @@
+package lzma
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"hash/crc32"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readA(t *testing.T) []byte {
+	t.Helper()
+
+	input, err := os.Open("testassets/a.lzma")
+	require.NoError(t, err)
+	defer input.Close()
+
+	r, err := NewReader1(bufio.NewReader(input))
+	require.NoError(t, err)
+
+	expected, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	return expected
+}
+
+// zipSized returns ZIP file with LZMA entry without end marker, which must
+// be decoded by the size of the entry.
+func zipSized(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var compressed bytes.Buffer
+
+	props := DefaultProperties()
+	compressed.Write([]byte{zipVersionMajor, zipVersionMinor, LZMAPropsLen, 0})
+	compressed.Write(props.Encode())
+
+	w1, err := NewRawWriter1(&compressed, props, false)
+	require.NoError(t, err)
+
+	_, err = w1.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w1.Close())
+
+	var out bytes.Buffer
+
+	zw := zip.NewWriter(&out)
+
+	fw, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "sized",
+		Method:             ZipMethodLZMA,
+		CRC32:              crc32.ChecksumIEEE(data),
+		CompressedSize64:   uint64(compressed.Len()),
+		UncompressedSize64: uint64(len(data)),
+	})
+	require.NoError(t, err)
+
+	_, err = fw.Write(compressed.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	return out.Bytes()
+}
+
+func TestZip(t *testing.T) {
+	r := require.New(t)
+
+	RegisterZip()
+	RegisterZip()
+
+	a := readA(t)
+	b := bytes.Repeat(func() []byte {
+		b := make([]byte, 256)
+		for i := range b {
+			b[i] = byte(i)
+		}
+
+		return b
+	}(), 40)
+
+	// python zipfile writes the end marker
+	python, err := os.ReadFile("testassets/a.zip")
+	r.NoError(err)
+
+	var written bytes.Buffer
+
+	zw := zip.NewWriter(&written)
+
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{{"a.txt", a}, {"empty", nil}, {"b.bin", b}} {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: ZipMethodLZMA, Flags: ZipFlagEOS})
+		r.NoError(err)
+
+		_, err = fw.Write(f.data)
+		r.NoError(err)
+	}
+
+	r.NoError(zw.Close())
+
+	testCases := []struct {
+		name string
+
+		input    []byte
+		expected map[string][]byte
+	}{
+		{
+			name:     "python",
+			input:    python,
+			expected: map[string][]byte{"a.txt": a, "empty": {}, "b.bin": b},
+		},
+		{
+			name:     "compressor",
+			input:    written.Bytes(),
+			expected: map[string][]byte{"a.txt": a, "empty": {}, "b.bin": b},
+		},
+		{
+			name:     "sized",
+			input:    zipSized(t, b),
+			expected: map[string][]byte{"sized": b},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			zr, err := zip.NewReader(bytes.NewReader(tc.input), int64(len(tc.input)))
+			r.NoError(err)
+			r.Len(zr.File, len(tc.expected))
+
+			for _, f := range zr.File {
+				r.Equal(uint16(ZipMethodLZMA), f.Method)
+
+				for _, open := range []func() (io.ReadCloser, error){f.Open, func() (io.ReadCloser, error) { return OpenZipFile(f) }} {
+					rc, err := open()
+					r.NoError(err)
+
+					actual, err := io.ReadAll(rc)
+					r.NoError(err, f.Name)
+					r.NoError(rc.Close())
+					r.Equal(tc.expected[f.Name], append([]byte{}, actual...), f.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenZipFileErrors(t *testing.T) {
+	r := require.New(t)
+
+	input := zipSized(t, readA(t))
+
+	// the CRC of the central directory
+	bad := bytes.Clone(input)
+	i := bytes.LastIndex(bad, []byte("PK\x01\x02"))
+	bad[i+16] ^= 0xFF
+
+	zr, err := zip.NewReader(bytes.NewReader(bad), int64(len(bad)))
+	r.NoError(err)
+
+	rc, err := OpenZipFile(zr.File[0])
+	r.NoError(err)
+
+	_, err = io.ReadAll(rc)
+	r.Error(err)
+
+	var stored bytes.Buffer
+
+	zw := zip.NewWriter(&stored)
+	_, err = zw.CreateHeader(&zip.FileHeader{Name: "stored", Method: zip.Store})
+	r.NoError(err)
+	r.NoError(zw.Close())
+
+	zr, err = zip.NewReader(bytes.NewReader(stored.Bytes()), int64(stored.Len()))
+	r.NoError(err)
+
+	_, err = OpenZipFile(zr.File[0])
+	r.Error(err)
+}